@@ -1,8 +1,11 @@
 package pongo2
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 )
 
 var reIdentifiers = regexp.MustCompile("^[a-zA-Z0-9_]+$")
@@ -45,7 +48,9 @@ func (c Context) Update(other Context) Context {
 // If you're writing a custom tag, your tag's Execute()-function will
 // have access to the ExecutionContext. This struct stores anything
 // about the current rendering process's Context including
-// the Context provided by the user (field Public).
+// the Context provided by the user (field Public). The set's Globals are
+// not copied into Public; they are consulted by reference after it (use
+// Lookup to resolve a name the way templates do).
 // You can safely use the Private context to provide data to the user's
 // template (like a 'forloop'-information). The Shared-context is used
 // to share data between tags. All ExecutionContexts share this context.
@@ -57,6 +62,26 @@ func (c Context) Update(other Context) Context {
 // NewChildExecutionContext(parent) function.
 type ExecutionContext struct {
 	template *Template
+	limits   *executionLimits // shared by all contexts of an execution
+	globals  Context          // the set's Globals (read-only)
+
+	// Templates which extend the executed template dynamically ({% extends
+	// variable %}), the most derived one first; their blocks take precedence
+	extendedBy []*Template
+
+	// The templates from the one being executed to the root of its
+	// inheritance chain (see withInheritanceStack)
+	inheritance []*Template
+
+	// Filter applied by the autoescaping ("escape" for HTML, changed by
+	// e. g. {% autoescape js %})
+	escapeFilter string
+
+	// Positions of the cycle-tags within this execution
+	cycles map[*tagCycleNode]int
+
+	// Names of the blocks being executed, outermost first (for {% debug %})
+	blockStack []string
 
 	Autoescape bool
 	Public     Context
@@ -76,16 +101,38 @@ func newExecutionContext(tpl *Template, ctx Context) *ExecutionContext {
 
 	return &ExecutionContext{
 		template: tpl,
+		globals:  tpl.set.Globals,
 
 		Public:     ctx,
 		Private:    privateCtx,
-		Autoescape: true,
+		Autoescape: tpl.autoescape(),
+
+		escapeFilter: "escape",
+		cycles:       make(map[*tagCycleNode]int),
 	}
 }
 
+// escape applies the active autoescaping mode's escaper to value (the
+// caller checks whether autoescaping is enabled at all).
+func (ctx *ExecutionContext) escape(value *Value) (*Value, *Error) {
+	f, has := ctx.template.set.lookupFilter(ctx.escapeFilter)
+	if !has {
+		return nil, ctx.Error(fmt.Sprintf("Filter '%s' not found.", ctx.escapeFilter), nil)
+	}
+	return f.fn(ctx, value, nil, nil)
+}
+
 func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	newctx := &ExecutionContext{
 		template: parent.template,
+		limits:   parent.limits,
+		globals:  parent.globals,
+
+		extendedBy:   parent.extendedBy,
+		inheritance:  parent.inheritance,
+		escapeFilter: parent.escapeFilter,
+		cycles:       parent.cycles,
+		blockStack:   parent.blockStack,
 
 		Public:     parent.Public,
 		Private:    make(Context),
@@ -99,15 +146,235 @@ func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	return newctx
 }
 
+// Lookup resolves a name like templates do: the Private context shadows the
+// Public context, which shadows the set's Globals.
+func (ctx *ExecutionContext) Lookup(name string) (interface{}, bool) {
+	if val, has := ctx.Private[name]; has {
+		return val, true
+	}
+	if val, has := ctx.Public[name]; has {
+		return val, true
+	}
+	val, has := ctx.globals[name]
+	return val, has
+}
+
+// executionLimits are the limits of a single execution (see ExecuteOptions,
+// TemplateSet.MaxOutputSize and TemplateSet.MaxLoopIterations) and the
+// other options it's executed with.
+type executionLimits struct {
+	set *TemplateSet
+
+	timeout  time.Duration
+	deadline time.Time
+
+	maxOutputSize  int
+	outputSize     int  // written and currently buffered bytes
+	outputExceeded bool // stays set once the limit was exceeded
+
+	maxLoopIterations int
+	loopIterations    int
+
+	// Templates included at execution time (see enterInclude)
+	includeStack []string
+
+	// ExecuteOptions.Undefined
+	undefined UndefinedPolicy
+}
+
+// newExecutionLimits returns nil if the execution isn't limited at all (and has
+// no other options).
+func newExecutionLimits(set *TemplateSet, opts ExecuteOptions) *executionLimits {
+	maxLoopIterations := set.MaxLoopIterations
+	if opts.MaxLoopIterations != 0 {
+		maxLoopIterations = opts.MaxLoopIterations
+	}
+	if opts.Timeout <= 0 && set.MaxOutputSize <= 0 && maxLoopIterations <= 0 && opts.Undefined == nil {
+		return nil
+	}
+	limits := &executionLimits{
+		set:               set,
+		timeout:           opts.Timeout,
+		maxOutputSize:     set.MaxOutputSize,
+		maxLoopIterations: maxLoopIterations,
+		undefined:         opts.Undefined,
+	}
+	if opts.Timeout > 0 {
+		limits.deadline = time.Now().Add(opts.Timeout)
+	}
+	return limits
+}
+
+// checkLimits is called after every element was executed; token identifies
+// the element.
+func (ctx *ExecutionContext) checkLimits(token *Token) *Error {
+	if ctx.limits == nil {
+		return nil
+	}
+	if ctx.limits.outputExceeded {
+		return ctx.limitError(fmt.Sprintf("Output size limit of %d bytes exceeded.", ctx.limits.maxOutputSize), token)
+	}
+	if !ctx.limits.deadline.IsZero() && time.Now().After(ctx.limits.deadline) {
+		return ctx.limitError(fmt.Sprintf("Execution timeout of %s exceeded.", ctx.limits.timeout), token)
+	}
+	return nil
+}
+
+// limitError returns the error of an exceeded limit, which the execution
+// error handler can't handle (see TemplateSet.OnExecutionError).
+func (ctx *ExecutionContext) limitError(msg string, token *Token) *Error {
+	err := ctx.Error(msg, token)
+	err.limitExceeded = true
+	return err
+}
+
+// countLoopIteration is called by loops for every iteration; token
+// identifies the loop.
+func (ctx *ExecutionContext) countLoopIteration(token *Token) *Error {
+	if ctx.limits == nil || ctx.limits.maxLoopIterations <= 0 {
+		return nil
+	}
+	ctx.limits.loopIterations++
+	if ctx.limits.loopIterations <= ctx.limits.maxLoopIterations {
+		return nil
+	}
+
+	limit := ctx.limits.maxLoopIterations
+	if ctx.limits.set.LoopLimitError == nil {
+		return ctx.limitError(fmt.Sprintf("Loop iteration limit of %d exceeded.", limit), token)
+	}
+	err := ctx.limits.set.LoopLimitError(limit)
+	if e, ok := err.(*Error); ok {
+		// Don't modify the hook's error, it might be shared
+		located := *e
+		if located.Filename == "" {
+			located.Filename = token.Filename
+		}
+		located.limitExceeded = true
+		return located.updateFromTokenIfNeeded(ctx.template, token)
+	}
+	return ctx.limitError(err.Error(), token)
+}
+
+// enterInclude is called before a template is included at execution time
+// (the filename of lazy includes is only known then, so recursions can't be
+// detected during compilation). It returns the limits to execute the
+// included template with; call leaveInclude on them afterwards.
+func (ctx *ExecutionContext) enterInclude(filename string) (*executionLimits, *Error) {
+	limits := ctx.limits
+	if limits == nil {
+		limits = &executionLimits{set: ctx.template.set}
+	}
+	if maxDepth := limits.set.maxIncludeDepth(); len(limits.includeStack) >= maxDepth {
+		return nil, ctx.limitError(fmt.Sprintf("Maximum include depth of %d exceeded: %s",
+			maxDepth, strings.Join(append(limits.includeStack, filename), " -> ")), nil)
+	}
+	limits.includeStack = append(limits.includeStack, filename)
+	return limits, nil
+}
+
+func (limits *executionLimits) leaveInclude() {
+	limits.includeStack = limits.includeStack[:len(limits.includeStack)-1]
+}
+
+// wrapWriter returns the writer to render into, enforcing the output size
+// limit. limits may be nil.
+func (limits *executionLimits) wrapWriter(writer TemplateWriter) TemplateWriter {
+	if limits == nil || limits.maxOutputSize <= 0 {
+		return writer
+	}
+	return &limitedWriter{w: writer, limits: limits}
+}
+
+// limitedWriter counts the bytes written during an execution and discards
+// everything beyond the output size limit. The limit violation is reported
+// by checkLimits after the current element was executed.
+type limitedWriter struct {
+	w      TemplateWriter
+	limits *executionLimits
+}
+
+func (lw *limitedWriter) Write(b []byte) (int, error) {
+	if !lw.limits.count(len(b)) {
+		return len(b), nil
+	}
+	return lw.w.Write(b)
+}
+
+func (lw *limitedWriter) WriteString(s string) (int, error) {
+	if !lw.limits.count(len(s)) {
+		return len(s), nil
+	}
+	return lw.w.WriteString(s)
+}
+
+// count adds n bytes to the output size and reports whether they are
+// still within the limit.
+func (limits *executionLimits) count(n int) bool {
+	limits.outputSize += n
+	if limits.outputSize > limits.maxOutputSize {
+		limits.outputExceeded = true
+	}
+	return !limits.outputExceeded
+}
+
+// wrapBuffer returns b as writer for elements rendering their body into
+// memory first (like {% filter %}). The buffered bytes count towards the
+// output size limit (and are discarded beyond it) until the buffer is
+// released, so a body can't grow without bounds before its content reaches
+// the output. limits may be nil.
+func (limits *executionLimits) wrapBuffer(b *bytes.Buffer) *limitedBuffer {
+	return &limitedBuffer{Buffer: b, limits: limits}
+}
+
+type limitedBuffer struct {
+	*bytes.Buffer
+	limits  *executionLimits
+	counted int
+}
+
+func (lb *limitedBuffer) Write(b []byte) (int, error) {
+	if lb.limits == nil || lb.limits.maxOutputSize <= 0 {
+		return lb.Buffer.Write(b)
+	}
+	lb.counted += len(b)
+	if !lb.limits.count(len(b)) {
+		return len(b), nil
+	}
+	return lb.Buffer.Write(b)
+}
+
+func (lb *limitedBuffer) WriteString(s string) (int, error) {
+	if lb.limits == nil || lb.limits.maxOutputSize <= 0 {
+		return lb.Buffer.WriteString(s)
+	}
+	lb.counted += len(s)
+	if !lb.limits.count(len(s)) {
+		return len(s), nil
+	}
+	return lb.Buffer.WriteString(s)
+}
+
+// release stops counting the buffered bytes; call it before the buffer's
+// content is written to the outer writer (which counts it again).
+func (lb *limitedBuffer) release() {
+	if lb.limits != nil {
+		lb.limits.outputSize -= lb.counted
+	}
+	lb.counted = 0
+}
+
 func (ctx *ExecutionContext) Error(msg string, token *Token) *Error {
 	filename := ctx.template.name
 	var line, col int
+	var excerpt string
 	if token != nil {
 		// No tokens available
 		// TODO: Add location (from where?)
 		filename = token.Filename
 		line = token.Line
 		col = token.Col
+		excerpt = ctx.template.excerpt(filename, line, col)
 	}
 	return &Error{
 		Template: ctx.template,
@@ -117,6 +384,7 @@ func (ctx *ExecutionContext) Error(msg string, token *Token) *Error {
 		Token:    token,
 		Sender:   "execution",
 		ErrorMsg: msg,
+		Excerpt:  excerpt,
 	}
 }
 
@@ -0,0 +1,184 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefixes of formats to select the format syntax explicitly: formats are
+// Go reference layouts (like "2006-01-02 15:04") unless they are prefixed
+// with "django:" to use Django's format characters (like "django:Y-m-d H:i").
+// "go:" is optional.
+const (
+	goTimeLayoutPrefix = "go:"
+	djangoDatePrefix   = "django:"
+)
+
+// formatTime formats t using either a Go layout or a Django format string
+// (see the prefixes above).
+func formatTime(t time.Time, format string) string {
+	if strings.HasPrefix(format, djangoDatePrefix) {
+		return formatDjangoDate(t, format[len(djangoDatePrefix):])
+	}
+	return t.Format(strings.TrimPrefix(format, goTimeLayoutPrefix))
+}
+
+var apMonths = [...]string{"Jan.", "Feb.", "March", "April", "May", "June",
+	"July", "Aug.", "Sept.", "Oct.", "Nov.", "Dec."}
+
+// formatDjangoDate formats t like Django's date filter, see
+// https://docs.djangoproject.com/en/dev/ref/templates/builtins/#date
+// A backslash escapes the following character. Unknown characters are
+// written as they are.
+func formatDjangoDate(t time.Time, format string) string {
+	var b bytes.Buffer
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch c {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteRune(runes[i])
+			}
+		case 'a':
+			if t.Hour() < 12 {
+				b.WriteString("a.m.")
+			} else {
+				b.WriteString("p.m.")
+			}
+		case 'A':
+			b.WriteString(t.Format("PM"))
+		case 'b':
+			b.WriteString(strings.ToLower(t.Format("Jan")))
+		case 'c':
+			if t.Nanosecond()/1000 == 0 {
+				b.WriteString(t.Format("2006-01-02T15:04:05-07:00"))
+			} else {
+				b.WriteString(t.Format("2006-01-02T15:04:05.000000-07:00"))
+			}
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'D':
+			b.WriteString(t.Format("Mon"))
+		case 'e', 'T':
+			b.WriteString(t.Format("MST"))
+		case 'E', 'F':
+			b.WriteString(t.Format("January"))
+		case 'f':
+			b.WriteString(djangoTimeShort(t))
+		case 'g':
+			b.WriteString(t.Format("3"))
+		case 'G':
+			b.WriteString(strconv.Itoa(t.Hour()))
+		case 'h':
+			b.WriteString(t.Format("03"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'i':
+			b.WriteString(t.Format("04"))
+		case 'I':
+			if t.IsDST() {
+				b.WriteString("1")
+			} else {
+				b.WriteString("0")
+			}
+		case 'j':
+			b.WriteString(strconv.Itoa(t.Day()))
+		case 'l':
+			b.WriteString(t.Format("Monday"))
+		case 'L':
+			if isLeapYear(t.Year()) {
+				b.WriteString("True")
+			} else {
+				b.WriteString("False")
+			}
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'M':
+			b.WriteString(t.Format("Jan"))
+		case 'n':
+			b.WriteString(strconv.Itoa(int(t.Month())))
+		case 'N':
+			b.WriteString(apMonths[t.Month()-1])
+		case 'o':
+			year, _ := t.ISOWeek()
+			b.WriteString(strconv.Itoa(year))
+		case 'O':
+			b.WriteString(t.Format("-0700"))
+		case 'P':
+			switch {
+			case t.Hour() == 0 && t.Minute() == 0:
+				b.WriteString("midnight")
+			case t.Hour() == 12 && t.Minute() == 0:
+				b.WriteString("noon")
+			default:
+				b.WriteString(djangoTimeShort(t))
+				if t.Hour() < 12 {
+					b.WriteString(" a.m.")
+				} else {
+					b.WriteString(" p.m.")
+				}
+			}
+		case 'r':
+			b.WriteString(t.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+		case 's':
+			b.WriteString(t.Format("05"))
+		case 'S':
+			b.WriteString(ordinalSuffix(t.Day()))
+		case 't':
+			b.WriteString(strconv.Itoa(time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()))
+		case 'u':
+			b.WriteString(fmt.Sprintf("%06d", t.Nanosecond()/1000))
+		case 'U':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'w':
+			b.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'W':
+			_, week := t.ISOWeek()
+			b.WriteString(strconv.Itoa(week))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'Y':
+			b.WriteString(strconv.Itoa(t.Year()))
+		case 'z':
+			b.WriteString(strconv.Itoa(t.YearDay()))
+		case 'Z':
+			_, offset := t.Zone()
+			b.WriteString(strconv.Itoa(offset))
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// djangoTimeShort returns the 12-hour time with the minutes left off if
+// they're zero, e. g. "1" or "1:30" (Django's "f" format character).
+func djangoTimeShort(t time.Time) string {
+	if t.Minute() == 0 {
+		return t.Format("3")
+	}
+	return t.Format("3:04")
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+func ordinalSuffix(day int) string {
+	switch {
+	case day >= 11 && day <= 13:
+		return "th"
+	case day%10 == 1:
+		return "st"
+	case day%10 == 2:
+		return "nd"
+	case day%10 == 3:
+		return "rd"
+	}
+	return "th"
+}
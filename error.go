@@ -3,7 +3,9 @@ package pongo2
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
 // The Error type is being used to address an error during lexing, parsing or
@@ -20,6 +22,60 @@ type Error struct {
 	Token    *Token
 	Sender   string
 	ErrorMsg string
+
+	// Details of a failed filter: its name and the Go type of its input
+	// (e. g. "int" or "[]string"; "nil" for nil)
+	Filter    string
+	InputType string
+
+	// Excerpt of the template line the error occurred in with a caret
+	// below the column (empty if the source isn't available)
+	Excerpt string
+
+	// Positions of the include, embed, ssi and extends tags which led to
+	// the template the error occurred in, outermost first
+	Stack []StackFrame
+
+	// All errors of a template failing to compile if there's more than
+	// one; the error itself is the first of them with a note about the
+	// others appended to its ErrorMsg
+	Errors ErrorList
+
+	limitExceeded bool // see ExecutionContext.limitError
+	unhandled     bool // declined by the execution error handler already
+}
+
+// StackFrame is a position in a template which includes (or extends,
+// embeds) another one (see Error.Stack).
+type StackFrame struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s (Line %d Col %d)", f.Filename, f.Line, f.Column)
+}
+
+// withFrames returns a copy of e with the positions of the given tokens
+// prepended to its stack (errors might be shared, e. g. by hooks).
+func (e *Error) withFrames(tokens ...*Token) *Error {
+	located := *e
+	located.Stack = make([]StackFrame, 0, len(tokens)+len(e.Stack))
+	for _, t := range tokens {
+		located.Stack = append(located.Stack, StackFrame{Filename: t.Filename, Line: t.Line, Column: t.Col})
+	}
+	located.Stack = append(located.Stack, e.Stack...)
+	return &located
+}
+
+// outermostFilename returns the name of the template at the bottom of the
+// error's stack.
+func (e *Error) outermostFilename() string {
+	if len(e.Stack) > 0 {
+		return e.Stack[0].Filename
+	}
+	return e.Filename
 }
 
 func (e *Error) updateFromTokenIfNeeded(template *Template, t *Token) *Error {
@@ -29,20 +85,90 @@ func (e *Error) updateFromTokenIfNeeded(template *Template, t *Token) *Error {
 
 	if e.Token == nil {
 		e.Token = t
+		if e.Filename == "" {
+			e.Filename = t.Filename
+		}
 		if e.Line <= 0 {
 			e.Line = t.Line
 			e.Column = t.Col
 		}
 	}
 
+	if e.Excerpt == "" && e.Line > 0 && e.Template != nil {
+		e.Excerpt = e.Template.excerpt(e.Filename, e.Line, e.Column)
+	}
+
 	return e
 }
 
+// Lines longer than this are cut around the column in excerpts
+const maxExcerptWidth = 80
+
+// excerpt renders line of source with a caret below column (a byte
+// offset like Token.Col), e. g.:
+//
+//	{{ user.name|upper:2 }}
+//	             ^
+func excerpt(source string, line, column int) string {
+	lines := strings.Split(source, "\n")
+	if line <= 0 || line > len(lines) {
+		return ""
+	}
+	text := strings.TrimRight(lines[line-1], "\r")
+	offset := column - 1
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(text) {
+		offset = len(text)
+	}
+
+	before, after := []rune(text[:offset]), []rune(text[offset:])
+	prefix, suffix := "", ""
+	if len(before) > maxExcerptWidth/2 {
+		before = before[len(before)-maxExcerptWidth/2:]
+		prefix = "..."
+	}
+	if len(after) > maxExcerptWidth/2 {
+		after = after[:maxExcerptWidth/2]
+		suffix = "..."
+	}
+
+	// Keep tabs, so the caret lines up
+	padding := []rune(prefix + string(before))
+	for i, r := range padding {
+		if r != '\t' {
+			padding[i] = ' '
+		}
+	}
+	return prefix + string(before) + string(after) + suffix + "\n" + string(padding) + "^"
+}
+
+// excerpt renders the excerpt of an error in the template named filename:
+// the template itself or one it's related to through inheritance.
+func (tpl *Template) excerpt(filename string, line, column int) string {
+	for t := tpl; t != nil; t = t.parent {
+		if t.name == filename {
+			return excerpt(t.tpl, line, column)
+		}
+	}
+	for t := tpl.child; t != nil; t = t.child {
+		if t.name == filename {
+			return excerpt(t.tpl, line, column)
+		}
+	}
+	return ""
+}
+
 // Returns a nice formatted error string.
 func (e *Error) Error() string {
 	s := "[Error"
 	if e.Sender != "" {
-		s += " (where: " + e.Sender + ")"
+		s += " (where: " + e.Sender
+		if e.InputType != "" {
+			s += ", input type: " + e.InputType
+		}
+		s += ")"
 	}
 	if e.Filename != "" {
 		s += " in " + e.Filename
@@ -55,31 +181,76 @@ func (e *Error) Error() string {
 	}
 	s += "] "
 	s += e.ErrorMsg
+	if len(e.Stack) > 0 {
+		frames := make([]string, 0, len(e.Stack)+1)
+		for _, f := range e.Stack {
+			frames = append(frames, f.String())
+		}
+		frames = append(frames, StackFrame{Filename: e.Filename, Line: e.Line, Column: e.Column}.String())
+		s += "\n    Template stack: " + strings.Join(frames, " -> ")
+	}
+	if e.Excerpt != "" {
+		s += "\n    " + strings.Replace(e.Excerpt, "\n", "\n    ", -1)
+	}
 	return s
 }
 
+// ErrorList collects multiple errors (e. g. of all templates failing to
+// compile during PreloadDir).
+type ErrorList []*Error
+
+// Returns all errors, one per line.
+func (el ErrorList) Error() string {
+	msgs := make([]string, 0, len(el))
+	for _, e := range el {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// toError returns err as *Error, wrapping it if necessary.
+func toError(filename, sender string, err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{
+		Filename: filename,
+		Sender:   sender,
+		ErrorMsg: err.Error(),
+	}
+}
+
 // RawLine returns the affected line from the original template, if available.
 func (e *Error) RawLine() (line string, available bool) {
 	if e.Line <= 0 || e.Filename == "<string>" {
 		return "", false
 	}
 
-	filename := e.Filename
+	var r io.Reader
 	if e.Template != nil {
-		filename = e.Template.set.resolveFilename(e.Template, e.Filename)
-	}
-	file, err := os.Open(filename)
-	if err != nil {
-		panic(err)
-	}
-	defer func() {
-		err := file.Close()
+		// Read the template through its set's loader (which might not be
+		// backed by the local file system)
+		filename := e.Template.set.resolveFilename(e.Template, e.Filename)
+		fd, err := e.Template.set.getTemplateReader(filename)
+		if err != nil {
+			return "", false
+		}
+		r = fd
+	} else {
+		file, err := os.Open(e.Filename)
 		if err != nil {
 			panic(err)
 		}
-	}()
+		defer func() {
+			err := file.Close()
+			if err != nil {
+				panic(err)
+			}
+		}()
+		r = file
+	}
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	l := 0
 	for scanner.Scan() {
 		l++
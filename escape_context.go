@@ -0,0 +1,384 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// escapeContext is the HTML context a variable is output in (see
+// TemplateSet.ContextualAutoescape).
+type escapeContext int
+
+const (
+	escapeContextHTML     escapeContext = iota // element content, quoted attribute values
+	escapeContextJS                            // <script> content, event handler attributes
+	escapeContextCSS                           // <style> content, style attributes
+	escapeContextURL                           // start of a URL attribute's value
+	escapeContextURLPath                       // path of a URL attribute's value
+	escapeContextURLQuery                      // query or fragment of a URL attribute's value
+)
+
+// Schemes URLs output at the start of URL attributes may have; other URLs
+// (e. g. "javascript:...") are replaced by unsafeURLReplacement.
+var safeURLSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"tel":    true,
+	"ftp":    true,
+}
+
+const unsafeURLReplacement = "#unsafe-url"
+
+// Attributes holding URLs
+var urlAttributes = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"xlink:href": true,
+}
+
+// Escapers of the contexts but HTML; their output is safe within quoted
+// attribute values and raw text except for escapeContextURL's, which is
+// HTML-escaped in addition.
+var contextEscapers = map[escapeContext]func(s string) string{
+	escapeContextJS:  escapeJS,
+	escapeContextCSS: escapeCSS,
+	escapeContextURL: sanitizeURL,
+	escapeContextURLPath: func(s string) string {
+		return escapeURL(s, true)
+	},
+	escapeContextURLQuery: func(s string) string {
+		return escapeURL(s, false)
+	},
+}
+
+// escapeIn applies the escaper of the HTML context ec to value, unless an
+// explicit autoescape mode (like {% autoescape js %}) is active. Values of
+// unquoted attributes are escaped using escapeHTMLUnquoted in addition.
+func (ctx *ExecutionContext) escapeIn(value *Value, ec escapeContext, unquoted bool) (*Value, *Error) {
+	if ctx.escapeFilter != "escape" {
+		return ctx.escape(value)
+	}
+	escaper, has := contextEscapers[ec]
+	switch {
+	case unquoted && has:
+		return AsValue(escapeHTMLUnquoted(escaper(value.String()))), nil
+	case unquoted:
+		return AsValue(escapeHTMLUnquoted(value.String())), nil
+	case ec == escapeContextURL:
+		return AsValue(escapeHTML(escaper(value.String()))), nil
+	case has:
+		return AsValue(escaper(value.String())), nil
+	}
+	return ctx.escape(value)
+}
+
+func escapeHTML(s string) string {
+	out, _ := filterEscape(AsValue(s), nil)
+	return out.String()
+}
+
+// escapeHTMLUnquoted escapes all characters but letters and digits as
+// numeric character references, so the output can't end an unquoted
+// attribute value (HTML escaping alone leaves spaces, "=" and backticks).
+func escapeHTMLUnquoted(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&b, "&#x%X;", r)
+	}
+	return b.String()
+}
+
+func escapeJS(s string) string {
+	out, _ := filterEscapejs(AsValue(s), nil)
+	return out.String()
+}
+
+// escapeCSS escapes all characters but letters, digits and spaces using
+// CSS hex escapes (terminated by a space), so the output can't leave a
+// CSS string or value.
+func escapeCSS(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == ' ' {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&b, `\%X `, r)
+	}
+	return b.String()
+}
+
+// escapeURL percent-encodes all characters but the unreserved ones of RFC
+// 3986 (letters, digits, "-", ".", "_" and "~") and, if keepSlashes is set,
+// slashes (to insert paths).
+func escapeURL(s string, keepSlashes bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' || (keepSlashes && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// sanitizeURL returns s unless it's a URL with a scheme which isn't in
+// safeURLSchemes (relative URLs are fine).
+func sanitizeURL(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if idx := strings.IndexAny(trimmed, ":/?#"); idx >= 0 && trimmed[idx] == ':' {
+		if !safeURLSchemes[strings.ToLower(trimmed[:idx])] {
+			return unsafeURLReplacement
+		}
+	}
+	return s
+}
+
+// checkAttributeOutput warns about a variable output in an event handler
+// attribute or an unquoted attribute value, where HTML escaping doesn't
+// prevent XSS (unless ContextualAutoescape is enabled, which escapes those
+// accordingly).
+func (tpl *Template) checkAttributeOutput(node *nodeVariable) {
+	sc := tpl.htmlScanner
+	if !sc.inAttrValue() || tpl.profile() != OutputHTML || node.FilterApplied("safe") {
+		return
+	}
+	switch {
+	case strings.HasPrefix(sc.attrName, "on") && !node.FilterApplied("escapejs"):
+		tpl.warnf(node.locationToken, "Variable output in event handler attribute '%s' is only HTML-escaped; use the escapejs filter or ContextualAutoescape.", sc.attrName)
+	case sc.unquoted() && !node.FilterApplied("escapeurl") && !node.FilterApplied("urlencode"):
+		tpl.warnf(node.locationToken, "Variable output in the unquoted value of attribute '%s' is only HTML-escaped; quote the value.", sc.attrName)
+	}
+}
+
+type htmlState int
+
+const (
+	htmlStateText htmlState = iota
+	htmlStateComment
+	htmlStateRawText // content of <script> and <style>
+	htmlStateTag     // within a tag, between attributes
+	htmlStateAttrName
+	htmlStateAfterAttrName
+	htmlStateBeforeAttrValue
+	htmlStateAttrValue
+)
+
+// htmlContextScanner tracks the HTML context while a template is parsed:
+// it's fed with the template's text in source order and tells the context
+// of the variables in between.
+type htmlContextScanner struct {
+	state htmlState
+
+	tagName    string // of the current tag
+	closingTag bool
+	rawElement string // "script" or "style" (htmlStateRawText)
+
+	attrName     string
+	quote        byte // of the attribute's value, 0 if unquoted
+	valueStarted bool // whether the value has any content yet
+	inURLQuery   bool // whether the value contains a '?' or '#' yet
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isHTMLTagNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == ':'
+}
+
+func lowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// feed scans text of the template.
+func (sc *htmlContextScanner) feed(s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch sc.state {
+		case htmlStateText:
+			if c != '<' {
+				continue
+			}
+			if strings.HasPrefix(s[i:], "<!--") {
+				sc.state = htmlStateComment
+				i += 3
+				continue
+			}
+			start := i + 1
+			closing := start < len(s) && s[start] == '/'
+			if closing {
+				start++
+			}
+			end := start
+			for end < len(s) && isHTMLTagNameChar(s[end]) {
+				end++
+			}
+			if end > start {
+				sc.startTag(strings.ToLower(s[start:end]), closing)
+				i = end - 1
+			}
+		case htmlStateComment:
+			if strings.HasPrefix(s[i:], "-->") {
+				sc.state = htmlStateText
+				i += 2
+			}
+		case htmlStateRawText:
+			end := "</" + sc.rawElement
+			if c == '<' && len(s)-i >= len(end) && strings.EqualFold(s[i:i+len(end)], end) {
+				sc.startTag(sc.rawElement, true)
+				i += len(end) - 1
+			}
+		case htmlStateTag:
+			switch {
+			case c == '>':
+				sc.endTag()
+			case isHTMLSpace(c) || c == '/':
+			default:
+				sc.state = htmlStateAttrName
+				sc.attrName = string(lowerASCII(c))
+			}
+		case htmlStateAttrName, htmlStateAfterAttrName:
+			switch {
+			case c == '=':
+				sc.state = htmlStateBeforeAttrValue
+			case c == '>':
+				sc.endTag()
+			case isHTMLSpace(c):
+				sc.state = htmlStateAfterAttrName
+			case c == '/':
+				sc.state = htmlStateTag
+			case sc.state == htmlStateAfterAttrName:
+				// Attribute without value, followed by the next one
+				sc.state = htmlStateAttrName
+				sc.attrName = string(lowerASCII(c))
+			default:
+				sc.attrName += string(lowerASCII(c))
+			}
+		case htmlStateBeforeAttrValue:
+			switch {
+			case isHTMLSpace(c):
+			case c == '>':
+				sc.endTag()
+			case c == '"' || c == '\'':
+				sc.startAttrValue(c)
+			default:
+				sc.startAttrValue(0)
+				sc.attrValueChar(c)
+			}
+		case htmlStateAttrValue:
+			switch {
+			case sc.quote != 0 && c == sc.quote:
+				sc.state = htmlStateTag
+			case sc.quote == 0 && isHTMLSpace(c):
+				sc.state = htmlStateTag
+			case sc.quote == 0 && c == '>':
+				sc.endTag()
+			default:
+				sc.attrValueChar(c)
+			}
+		}
+	}
+}
+
+func (sc *htmlContextScanner) startTag(name string, closing bool) {
+	sc.state = htmlStateTag
+	sc.tagName = name
+	sc.closingTag = closing
+}
+
+func (sc *htmlContextScanner) endTag() {
+	if !sc.closingTag && (sc.tagName == "script" || sc.tagName == "style") {
+		sc.state = htmlStateRawText
+		sc.rawElement = sc.tagName
+		return
+	}
+	sc.state = htmlStateText
+}
+
+func (sc *htmlContextScanner) startAttrValue(quote byte) {
+	sc.state = htmlStateAttrValue
+	sc.quote = quote
+	sc.valueStarted = false
+	sc.inURLQuery = false
+}
+
+func (sc *htmlContextScanner) attrValueChar(c byte) {
+	sc.valueStarted = true
+	if c == '?' || c == '#' {
+		sc.inURLQuery = true
+	}
+}
+
+// context returns the context of a variable output at the current position.
+func (sc *htmlContextScanner) context() escapeContext {
+	switch sc.state {
+	case htmlStateRawText:
+		if sc.rawElement == "script" {
+			return escapeContextJS
+		}
+		return escapeContextCSS
+	case htmlStateBeforeAttrValue, htmlStateAttrValue:
+		switch {
+		case strings.HasPrefix(sc.attrName, "on"):
+			return escapeContextJS
+		case sc.attrName == "style":
+			return escapeContextCSS
+		case urlAttributes[sc.attrName]:
+			if sc.state == htmlStateBeforeAttrValue || !sc.valueStarted {
+				return escapeContextURL
+			}
+			if sc.inURLQuery {
+				return escapeContextURLQuery
+			}
+			return escapeContextURLPath
+		}
+	}
+	return escapeContextHTML
+}
+
+// inAttrValue returns whether a variable output at the current position is
+// (part of) an attribute's value.
+func (sc *htmlContextScanner) inAttrValue() bool {
+	return sc.state == htmlStateBeforeAttrValue || sc.state == htmlStateAttrValue
+}
+
+// unquoted returns whether a variable output at the current position is
+// (part of) an unquoted attribute value.
+func (sc *htmlContextScanner) unquoted() bool {
+	return sc.state == htmlStateBeforeAttrValue || (sc.state == htmlStateAttrValue && sc.quote == 0)
+}
+
+// output is called after a variable was output at the current position.
+func (sc *htmlContextScanner) output() {
+	switch sc.state {
+	case htmlStateBeforeAttrValue:
+		// Unquoted value
+		sc.startAttrValue(0)
+		sc.valueStarted = true
+	case htmlStateAttrValue:
+		sc.valueStarted = true
+	}
+}
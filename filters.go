@@ -2,14 +2,136 @@ package pongo2
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
 type FilterFunction func(in *Value, param *Value) (out *Value, err *Error)
 
-var filters map[string]FilterFunction
+// FilterArgsFunction is the signature of filters taking several positional
+// and/or keyword arguments (see RegisterFilterWithArgs()). args holds the
+// positional arguments and kwargs the keyword arguments by their names
+// (only the ones given in the template).
+type FilterArgsFunction func(in *Value, args []*Value, kwargs map[string]*Value) (out *Value, err *Error)
+
+// FilterSignature declares the arguments a filter accepts. The arguments of
+// every filter call are checked against it when the template is parsed.
+type FilterSignature struct {
+	// Number of positional arguments the filter requires and accepts at
+	// most (a negative MaxArgs means there's no upper limit)
+	MinArgs, MaxArgs int
+
+	// Names of the accepted keyword arguments
+	Kwargs []string
+}
+
+// accepts checks whether the filter name can be called with the given
+// number of positional arguments and keyword arguments.
+func (sig *FilterSignature) accepts(name string, argCount int, kwargs []string) string {
+	switch {
+	case argCount < sig.MinArgs:
+		return fmt.Sprintf("Filter '%s' requires at least %d argument(s), got %d.", name, sig.MinArgs, argCount)
+	case sig.MaxArgs >= 0 && argCount > sig.MaxArgs:
+		if sig.MaxArgs == 0 {
+			return fmt.Sprintf("Filter '%s' does not take any arguments.", name)
+		}
+		return fmt.Sprintf("Filter '%s' takes at most %d argument(s), got %d.", name, sig.MaxArgs, argCount)
+	}
+	for _, kwarg := range kwargs {
+		found := false
+		for _, accepted := range sig.Kwargs {
+			if kwarg == accepted {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if len(sig.Kwargs) == 0 {
+				return fmt.Sprintf("Filter '%s' does not take keyword arguments.", name)
+			}
+			accepted := append([]string(nil), sig.Kwargs...)
+			sort.Strings(accepted)
+			return fmt.Sprintf("Unknown keyword argument '%s' for filter '%s' (valid: %s).", kwarg, name, strings.Join(accepted, ", "))
+		}
+	}
+	return ""
+}
+
+// FilterContextFunction is the signature of context-aware filters (see
+// RegisterContextFilter()): they additionally receive the execution context
+// of the template, e. g. to access request-scoped values like the locale
+// using ctx.Lookup() or to check ctx.Autoescape.
+type FilterContextFunction func(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (out *Value, err *Error)
+
+type filter struct {
+	fn        FilterContextFunction
+	signature FilterSignature
+}
+
+// newParamFilter wraps a single-parameter filter; its parameter is optional
+// (filters validate it themselves).
+func newParamFilter(fn FilterFunction) *filter {
+	return &filter{
+		fn: func(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+			param := AsValue(nil)
+			if len(args) > 0 {
+				param = args[0]
+			}
+			return fn(in, param)
+		},
+		signature: FilterSignature{MinArgs: 0, MaxArgs: 1},
+	}
+}
+
+// newSetParamFilter wraps a single-parameter filter depending on the
+// configuration of the executing template's set (like the separators of
+// TemplateSet.SetNumberSeparators()). set is nil if the filter is applied
+// outside of a template (ApplyFilter()).
+func newSetParamFilter(fn func(set *TemplateSet, in *Value, param *Value) (*Value, *Error)) *filter {
+	return &filter{
+		fn: func(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+			var set *TemplateSet
+			if ctx != nil {
+				set = ctx.template.set
+			}
+			param := AsValue(nil)
+			if len(args) > 0 {
+				param = args[0]
+			}
+			return fn(set, in, param)
+		},
+		signature: FilterSignature{MinArgs: 0, MaxArgs: 1},
+	}
+}
+
+// newSetArgsFilter is like newSetParamFilter() for filters taking the
+// arguments declared by signature.
+func newSetArgsFilter(signature FilterSignature, fn func(set *TemplateSet, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error)) *filter {
+	return &filter{
+		fn: func(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+			var set *TemplateSet
+			if ctx != nil {
+				set = ctx.template.set
+			}
+			return fn(set, in, args, kwargs)
+		},
+		signature: signature,
+	}
+}
+
+func newArgsFilter(signature FilterSignature, fn FilterArgsFunction) *filter {
+	return &filter{
+		fn: func(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+			return fn(in, args, kwargs)
+		},
+		signature: signature,
+	}
+}
+
+var filters map[string]*filter
 
 func init() {
-	filters = make(map[string]FilterFunction)
+	filters = make(map[string]*filter)
 }
 
 // Registers a new filter. If there's already a filter with the same
@@ -20,11 +142,45 @@ func init() {
 // See http://www.florian-schlachter.de/post/pongo2/ for more about
 // writing filters and tags.
 func RegisterFilter(name string, fn FilterFunction) {
+	registerFilter(name, newParamFilter(fn))
+}
+
+// RegisterFilterWithArgs registers a new filter which takes the arguments
+// declared by signature, given as positional and/or keyword arguments in
+// parentheses:
+//
+//	{{ value|date(format="Y-m-d", tz="UTC") }}
+//
+// Like RegisterFilter(), it panics if there's already a filter with the
+// same name.
+func RegisterFilterWithArgs(name string, signature FilterSignature, fn FilterArgsFunction) {
+	registerFilter(name, newArgsFilter(signature, fn))
+}
+
+// RegisterContextFilter registers a new filter which receives the execution
+// context in addition to its input and the arguments declared by signature
+// (see RegisterFilterWithArgs()). It's needed for filters depending on the
+// rendering's state, e. g. a trans filter looking up the "locale" variable:
+//
+//	pongo2.RegisterContextFilter("trans", pongo2.FilterSignature{},
+//		func(ctx *pongo2.ExecutionContext, in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+//			locale, _ := ctx.Lookup("locale")
+//			return pongo2.AsValue(translate(in.String(), locale)), nil
+//		})
+//
+// The context is nil if the filter is applied outside of a template (e. g.
+// using ApplyFilter()). Like RegisterFilter(), it panics if there's already
+// a filter with the same name.
+func RegisterContextFilter(name string, signature FilterSignature, fn FilterContextFunction) {
+	registerFilter(name, &filter{fn: fn, signature: signature})
+}
+
+func registerFilter(name string, f *filter) {
 	_, existing := filters[name]
 	if existing {
 		panic(fmt.Sprintf("Filter with name '%s' is already registered.", name))
 	}
-	filters[name] = fn
+	filters[name] = f
 }
 
 // Replaces an already registered filter with a new implementation. Use this
@@ -34,7 +190,31 @@ func ReplaceFilter(name string, fn FilterFunction) {
 	if !existing {
 		panic(fmt.Sprintf("Filter with name '%s' does not exist (therefore cannot be overridden).", name))
 	}
-	filters[name] = fn
+	filters[name] = newParamFilter(fn)
+}
+
+// ReplaceFilterWithArgs is like ReplaceFilter() but replaces the filter
+// with one taking the arguments declared by signature (see
+// RegisterFilterWithArgs()).
+func ReplaceFilterWithArgs(name string, signature FilterSignature, fn FilterArgsFunction) {
+	_, existing := filters[name]
+	if !existing {
+		panic(fmt.Sprintf("Filter with name '%s' does not exist (therefore cannot be overridden).", name))
+	}
+	filters[name] = newArgsFilter(signature, fn)
+}
+
+// AliasFilter registers the filter called name under the additional name
+// alias, e. g. AliasFilter("strftime", "date"). The alias refers to the
+// filter's current implementation (replacing the filter afterwards doesn't
+// affect the alias). It panics if there's no filter called name or if
+// there's already a filter called alias.
+func AliasFilter(alias string, name string) {
+	f, existing := filters[name]
+	if !existing {
+		panic(fmt.Sprintf("Filter with name '%s' does not exist (therefore cannot be aliased).", name))
+	}
+	registerFilter(alias, f)
 }
 
 // Like ApplyFilter, but panics on an error
@@ -48,7 +228,19 @@ func MustApplyFilter(name string, value *Value, param *Value) *Value {
 
 // Applies a filter to a given value using the given parameters. Returns a *pongo2.Value or an error.
 func ApplyFilter(name string, value *Value, param *Value) (*Value, *Error) {
-	fn, existing := filters[name]
+	var args []*Value
+	if param != nil {
+		args = []*Value{param}
+	}
+	return ApplyFilterWithArgs(name, value, args, nil)
+}
+
+// ApplyFilterWithArgs applies a filter to a given value using the given
+// positional and keyword arguments, which are checked against the filter's
+// signature. Returns a *pongo2.Value or an error. Context-aware filters
+// receive a nil execution context.
+func ApplyFilterWithArgs(name string, value *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	f, existing := filters[name]
 	if !existing {
 		return nil, &Error{
 			Sender:   "applyfilter",
@@ -56,44 +248,82 @@ func ApplyFilter(name string, value *Value, param *Value) (*Value, *Error) {
 		}
 	}
 
-	// Make sure param is a *Value
-	if param == nil {
-		param = AsValue(nil)
+	kwargNames := make([]string, 0, len(kwargs))
+	for kwarg := range kwargs {
+		kwargNames = append(kwargNames, kwarg)
+	}
+	sort.Strings(kwargNames)
+	if msg := f.signature.accepts(name, len(args), kwargNames); msg != "" {
+		return nil, &Error{
+			Sender:   "applyfilter",
+			ErrorMsg: msg,
+		}
 	}
 
-	return fn(value, param)
+	out, err := f.fn(nil, value, args, kwargs)
+	if err != nil {
+		return nil, filterError(name, value, err)
+	}
+	return out, nil
+}
+
+// filterError returns a copy of the error a filter returned (which might be
+// shared) annotated with the filter's name and the type of its input.
+func filterError(name string, in *Value, err *Error) *Error {
+	e := *err
+	if e.Sender == "" {
+		e.Sender = "filter:" + name
+	}
+	if e.Filter == "" {
+		e.Filter = name
+		e.InputType = "nil"
+		if in != nil && in.val.IsValid() {
+			e.InputType = in.val.Type().String()
+		}
+	}
+	return &e
 }
 
 type filterCall struct {
 	token *Token
 
-	name      string
-	parameter IEvaluator
+	name   string
+	args   []IEvaluator
+	kwargs map[string]IEvaluator
 
-	filterFunc FilterFunction
+	filter *filter
 }
 
 func (fc *filterCall) Execute(v *Value, ctx *ExecutionContext) (*Value, *Error) {
-	var param *Value
-	var err *Error
-
-	if fc.parameter != nil {
-		param, err = fc.parameter.Evaluate(ctx)
+	args := make([]*Value, 0, len(fc.args))
+	for _, evaluator := range fc.args {
+		arg, err := evaluator.Evaluate(ctx)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		param = AsValue(nil)
+		args = append(args, arg)
+	}
+
+	var kwargs map[string]*Value
+	if len(fc.kwargs) > 0 {
+		kwargs = make(map[string]*Value, len(fc.kwargs))
+		for name, evaluator := range fc.kwargs {
+			kwarg, err := evaluator.Evaluate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			kwargs[name] = kwarg
+		}
 	}
 
-	filteredValue, err := fc.filterFunc(v, param)
+	filteredValue, err := fc.filter.fn(ctx, v, args, kwargs)
 	if err != nil {
-		return nil, err.updateFromTokenIfNeeded(ctx.template, fc.token)
+		return nil, filterError(fc.name, v, err).updateFromTokenIfNeeded(ctx.template, fc.token)
 	}
 	return filteredValue, nil
 }
 
-// Filter = IDENT | IDENT ":" FilterArg | IDENT "|" Filter
+// Filter = IDENT | IDENT ":" FilterArg { "," FilterArg } | IDENT "(" FilterArgs ")" | IDENT "|" Filter
 func (p *Parser) parseFilter() (*filterCall, *Error) {
 	identToken := p.MatchType(TokenIdentifier)
 
@@ -102,18 +332,20 @@ func (p *Parser) parseFilter() (*filterCall, *Error) {
 		return nil, p.Error("Filter name must be an identifier.", nil)
 	}
 
-	filter := &filterCall{
+	fc := &filterCall{
 		token: identToken,
 		name:  identToken.Val,
 	}
 
-	// Get the appropriate filter function and bind it
-	filterFn, exists := filters[identToken.Val]
+	// Get the appropriate filter and bind it
+	f, exists := p.template.set.lookupFilter(identToken.Val)
 	if !exists {
 		return nil, p.Error(fmt.Sprintf("Filter '%s' does not exist.", identToken.Val), identToken)
 	}
-
-	filter.filterFunc = filterFn
+	if hint, deprecated := deprecatedFilters[identToken.Val]; deprecated {
+		p.template.warnf(identToken, "Filter '%s' is deprecated; %s.", identToken.Val, hint)
+	}
+	fc.filter = f
 
 	// Check for filter-argument (2 tokens needed: ':' ARG)
 	if p.Match(TokenSymbol, ":") != nil {
@@ -126,8 +358,76 @@ func (p *Parser) parseFilter() (*filterCall, *Error) {
 		if err != nil {
 			return nil, err
 		}
-		filter.parameter = v
+		fc.args = append(fc.args, v)
+
+		// Filters taking more than one argument get comma-separated
+		// arguments, e. g. replace:"a","b" (the comma is only consumed for
+		// them so it still separates the arguments of e. g. macro calls)
+		if f.signature.MaxArgs < 0 || f.signature.MaxArgs > 1 {
+			for p.Match(TokenSymbol, ",") != nil {
+				v, err := p.parseVariableOrLiteral()
+				if err != nil {
+					return nil, err
+				}
+				fc.args = append(fc.args, v)
+			}
+		}
+	} else if p.Match(TokenSymbol, "(") != nil {
+		if err := p.parseFilterArgs(fc); err != nil {
+			return nil, err
+		}
 	}
 
-	return filter, nil
+	kwargNames := make([]string, 0, len(fc.kwargs))
+	for kwarg := range fc.kwargs {
+		kwargNames = append(kwargNames, kwarg)
+	}
+	sort.Strings(kwargNames)
+	if msg := f.signature.accepts(fc.name, len(fc.args), kwargNames); msg != "" {
+		return nil, p.Error(msg, identToken)
+	}
+
+	return fc, nil
+}
+
+// FilterArgs = [ FilterArg { "," FilterArg } ] ")"
+// FilterArg = Expression | IDENT "=" Expression
+// (positional arguments must precede the keyword arguments)
+func (p *Parser) parseFilterArgs(fc *filterCall) *Error {
+	for p.Match(TokenSymbol, ")") == nil {
+		if len(fc.args)+len(fc.kwargs) > 0 {
+			if p.Match(TokenSymbol, ",") == nil {
+				return p.Error("Expected ',' or ')' in the filter's argument list.", nil)
+			}
+		}
+
+		if keyToken := p.PeekType(TokenIdentifier); keyToken != nil && p.PeekN(1, TokenSymbol, "=") != nil {
+			p.ConsumeN(2)
+			if _, has := fc.kwargs[keyToken.Val]; has {
+				return p.Error(fmt.Sprintf("Keyword argument '%s' given more than once.", keyToken.Val), keyToken)
+			}
+			expr, err := p.ParseExpression()
+			if err != nil {
+				return err
+			}
+			if fc.kwargs == nil {
+				fc.kwargs = make(map[string]IEvaluator)
+			}
+			fc.kwargs[keyToken.Val] = expr
+			continue
+		}
+
+		if len(fc.kwargs) > 0 {
+			return p.Error("Positional arguments must not follow keyword arguments.", nil)
+		}
+		if p.Remaining() == 0 {
+			return p.Error("Unexpected EOF, expected ')'.", p.lastToken)
+		}
+		expr, err := p.ParseExpression()
+		if err != nil {
+			return err
+		}
+		fc.args = append(fc.args, expr)
+	}
+	return nil
 }
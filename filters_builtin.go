@@ -1,14 +1,6 @@
 package pongo2
 
-/* Filters that are provided through github.com/flosch/pongo2-addons:
-   ------------------------------------------------------------------
-
-   filesizeformat
-   slugify
-   timesince
-   timeuntil
-
-   Filters that won't be added:
+/* Filters that won't be added:
    ----------------------------
 
    get_static_prefix (reason: web-framework specific)
@@ -20,13 +12,13 @@ package pongo2
 
    force_escape (reason: not yet needed since this is the behaviour of pongo2's escape filter)
    safeseq (reason: same reason as `force_escape`)
-   unordered_list (python-specific; not sure whether needed or not)
    dictsort (python-specific; maybe one could add a filter to sort a list of structs by a specific field name)
    dictsortreversed (see dictsort)
 */
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/url"
@@ -34,6 +26,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf16"
 	"unicode/utf8"
 )
 
@@ -43,13 +36,16 @@ func init() {
 	RegisterFilter("escape", filterEscape)
 	RegisterFilter("safe", filterSafe)
 	RegisterFilter("escapejs", filterEscapejs)
+	RegisterFilter("escapecss", filterEscapecss) // pongo-specific
+	RegisterFilter("escapeurl", filterEscapeurl) // pongo-specific
 
 	RegisterFilter("add", filterAdd)
 	RegisterFilter("addslashes", filterAddslashes)
 	RegisterFilter("capfirst", filterCapfirst)
 	RegisterFilter("center", filterCenter)
+	RegisterFilter("coalesce", filterCoalesce) // pongo-specific
 	RegisterFilter("cut", filterCut)
-	RegisterFilter("date", filterDate)
+	RegisterFilterWithArgs("date", dateFilterSignature, filterDate)
 	RegisterFilter("default", filterDefault)
 	RegisterFilter("default_if_none", filterDefaultIfNone)
 	RegisterFilter("divisibleby", filterDivisibleby)
@@ -71,22 +67,26 @@ func init() {
 	RegisterFilter("pluralize", filterPluralize)
 	RegisterFilter("random", filterRandom)
 	RegisterFilter("removetags", filterRemovetags)
+	RegisterFilterWithArgs("replace", FilterSignature{MinArgs: 2, MaxArgs: 3, Kwargs: []string{"count"}}, filterReplace) // pongo-specific
 	RegisterFilter("rjust", filterRjust)
 	RegisterFilter("slice", filterSlice)
 	RegisterFilter("stringformat", filterStringformat)
 	RegisterFilter("striptags", filterStriptags)
-	RegisterFilter("time", filterDate) // time uses filterDate (same golang-format)
+	RegisterFilter("striptags_except", filterStriptagsExcept)       // pongo-specific
+	RegisterFilterWithArgs("time", dateFilterSignature, filterDate) // time uses filterDate (same formats)
 	RegisterFilter("title", filterTitle)
+	RegisterFilter("tojson", filterTojson) // pongo-specific
 	RegisterFilter("truncatechars", filterTruncatechars)
 	RegisterFilter("truncatechars_html", filterTruncatecharsHTML)
 	RegisterFilter("truncatewords", filterTruncatewords)
 	RegisterFilter("truncatewords_html", filterTruncatewordsHTML)
+	RegisterFilter("unordered_list", filterUnorderedList)
 	RegisterFilter("upper", filterUpper)
 	RegisterFilter("urlencode", filterUrlencode)
-	RegisterFilter("urlize", filterUrlize)
-	RegisterFilter("urlizetrunc", filterUrlizetrunc)
+	registerFilter("urlize", newSetParamFilter(filterUrlize))
+	registerFilter("urlizetrunc", newSetParamFilter(filterUrlizetrunc))
 	RegisterFilter("wordcount", filterWordcount)
-	RegisterFilter("wordwrap", filterWordwrap)
+	RegisterFilterWithArgs("wordwrap", FilterSignature{MaxArgs: 1, Kwargs: []string{"width", "break", "long"}}, filterWordwrap)
 	RegisterFilter("yesno", filterYesno)
 
 	RegisterFilter("float", filterFloat)     // pongo-specific
@@ -324,6 +324,14 @@ func filterSafe(in *Value, param *Value) (*Value, *Error) {
 	return in, nil // nothing to do here, just to keep track of the safe application
 }
 
+// filterEscapejs escapes the input for use in JavaScript string literals
+// (within <script> elements and event handler attributes): all characters
+// but ASCII letters, spaces and slashes are written as \uXXXX escapes, so
+// the output can neither terminate the string (quotes, backslashes, line
+// terminators including U+2028 and U+2029) nor the element (e. g.
+// "</script>" or "-->"). Characters outside the Basic Multilingual Plane
+// are written as UTF-16 surrogate pairs. Like Django's escapejs, it doesn't
+// make the input safe for use outside of string literals.
 func filterEscapejs(in *Value, param *Value) (*Value, *Error) {
 	sin := in.String()
 
@@ -363,6 +371,8 @@ func filterEscapejs(in *Value, param *Value) (*Value, *Error) {
 
 		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == ' ' || c == '/' {
 			b.WriteRune(c)
+		} else if r1, r2 := utf16.EncodeRune(c); r1 != utf8.RuneError {
+			b.WriteString(fmt.Sprintf(`\u%04X\u%04X`, r1, r2))
 		} else {
 			b.WriteString(fmt.Sprintf(`\u%04X`, c))
 		}
@@ -373,6 +383,34 @@ func filterEscapejs(in *Value, param *Value) (*Value, *Error) {
 	return AsValue(b.String()), nil
 }
 
+// filterEscapecss escapes the input for use in CSS values and strings
+// (within <style> elements and style attributes): all characters but ASCII
+// letters, digits and spaces are written as hex escapes like "\3B ", so the
+// output can't terminate the value, the declaration or the element.
+func filterEscapecss(in *Value, param *Value) (*Value, *Error) {
+	return AsValue(escapeCSS(in.String())), nil
+}
+
+// filterEscapeurl percent-encodes the input as a URL component according to
+// RFC 3986 (only letters, digits, "-", ".", "_" and "~" are kept; spaces
+// become "%20"). The optional parameter selects the mode: "query" (the
+// default) for query parameters and other components, "path" to insert a
+// path whose slashes are kept:
+//
+//	<a href="/files/{{ path|escapeurl:"path" }}?q={{ query|escapeurl }}">
+func filterEscapeurl(in *Value, param *Value) (*Value, *Error) {
+	switch param.String() {
+	case "", "query":
+		return AsValue(escapeURL(in.String(), false)), nil
+	case "path":
+		return AsValue(escapeURL(in.String(), true)), nil
+	}
+	return nil, &Error{
+		Sender:   "filter:escapeurl",
+		ErrorMsg: fmt.Sprintf("Unknown mode '%s' (valid modes are 'query' and 'path').", param.String()),
+	}
+}
+
 func filterAdd(in *Value, param *Value) (*Value, *Error) {
 	if in.IsNumber() && param.IsNumber() {
 		if in.IsFloat() || param.IsFloat() {
@@ -411,8 +449,27 @@ func filterDefault(in *Value, param *Value) (*Value, *Error) {
 	return in, nil
 }
 
+// The defaulting filters differ in which inputs they replace:
+//
+//	input            default  default_if_none  coalesce
+//	nil              yes      yes              yes
+//	""               yes      no               yes
+//	0, false, []     yes      no               no
+//
+// (nil includes nil pointers, maps and slices, see Value.isNone)
+
 func filterDefaultIfNone(in *Value, param *Value) (*Value, *Error) {
-	if in.IsNil() {
+	if in.isNone() {
+		return param, nil
+	}
+	return in, nil
+}
+
+// filterCoalesce replaces missing (nil) and blank (empty string) inputs but
+// keeps zero numbers and false, e. g. for optional numeric fields:
+// {{ product.Discount|coalesce:"n/a" }} renders a discount of 0 as "0".
+func filterCoalesce(in *Value, param *Value) (*Value, *Error) {
+	if in.isNone() || (in.IsString() && in.String() == "") {
 		return param, nil
 	}
 	return in, nil
@@ -426,6 +483,12 @@ func filterDivisibleby(in *Value, param *Value) (*Value, *Error) {
 }
 
 func filterFirst(in *Value, param *Value) (*Value, *Error) {
+	if in.IsIterator() {
+		if item, ok := in.nextItem(); ok {
+			return item, nil
+		}
+		return AsValue(""), nil
+	}
 	if in.CanSlice() && in.Len() > 0 {
 		return in.Index(0), nil
 	}
@@ -489,6 +552,9 @@ func filterIriencode(in *Value, param *Value) (*Value, *Error) {
 }
 
 func filterJoin(in *Value, param *Value) (*Value, *Error) {
+	if in.IsIterator() {
+		in = AsValue(in.iteratorItems(-1))
+	}
 	if !in.CanSlice() {
 		return in, nil
 	}
@@ -501,6 +567,9 @@ func filterJoin(in *Value, param *Value) (*Value, *Error) {
 }
 
 func filterLast(in *Value, param *Value) (*Value, *Error) {
+	if in.IsIterator() {
+		in = AsValue(in.iteratorItems(-1))
+	}
 	if in.CanSlice() && in.Len() > 0 {
 		return in.Index(in.Len() - 1), nil
 	}
@@ -548,7 +617,12 @@ func filterCenter(in *Value, param *Value) (*Value, *Error) {
 		in.String(), strings.Repeat(" ", right))), nil
 }
 
-func filterDate(in *Value, param *Value) (*Value, *Error) {
+// The date and time filters take the format either as parameter or as
+// keyword argument and optionally the time zone to convert the time to:
+// {{ now|date(format="2006-01-02 15:04", tz="Europe/Berlin") }}
+var dateFilterSignature = FilterSignature{MinArgs: 0, MaxArgs: 1, Kwargs: []string{"format", "tz"}}
+
+func filterDate(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
 	t, isTime := in.Interface().(time.Time)
 	if !isTime {
 		return nil, &Error{
@@ -556,7 +630,33 @@ func filterDate(in *Value, param *Value) (*Value, *Error) {
 			ErrorMsg: "Filter input argument must be of type 'time.Time'.",
 		}
 	}
-	return AsValue(t.Format(param.String())), nil
+
+	format := ""
+	if len(args) > 0 {
+		format = args[0].String()
+	}
+	if f, has := kwargs["format"]; has {
+		if len(args) > 0 {
+			return nil, &Error{
+				Sender:   "filter:date",
+				ErrorMsg: "The format must not be given both as parameter and as keyword argument.",
+			}
+		}
+		format = f.String()
+	}
+
+	if tz, has := kwargs["tz"]; has {
+		loc, err := time.LoadLocation(tz.String())
+		if err != nil {
+			return nil, &Error{
+				Sender:   "filter:date",
+				ErrorMsg: fmt.Sprintf("Unknown time zone '%s'.", tz.String()),
+			}
+		}
+		t = t.In(loc)
+	}
+
+	return AsValue(formatTime(t, format)), nil
 }
 
 func filterFloat(in *Value, param *Value) (*Value, *Error) {
@@ -640,8 +740,68 @@ func filterUrlencode(in *Value, param *Value) (*Value, *Error) {
 var filterUrlizeURLRegexp = regexp.MustCompile(`((((http|https)://)|www\.|((^|[ ])[0-9A-Za-z_\-]+(\.com|\.net|\.org|\.info|\.biz|\.de))))(?U:.*)([ ]+|$)`)
 var filterUrlizeEmailRegexp = regexp.MustCompile(`(\w+@\w+\.\w{2,4})`)
 
-func filterUrlizeHelper(input string, autoescape bool, trunc int) string {
-	sout := filterUrlizeURLRegexp.ReplaceAllStringFunc(input, func(raw_url string) string {
+// SetUrlizeRel sets the rel attribute of the links created by the urlize
+// and urlizetrunc filters of the set's templates (default "nofollow", e. g.
+// to keep search engines from following links in user-generated content).
+// "" omits the attribute.
+func (set *TemplateSet) SetUrlizeRel(rel string) {
+	set.urlizeRel = rel
+}
+
+// linkRel returns the rel attribute of urlize's links; set may be nil (see
+// newSetParamFilter).
+func (set *TemplateSet) linkRel() string {
+	if set == nil {
+		return "nofollow"
+	}
+	return set.urlizeRel
+}
+
+// filterUrlizeTruncate shortens title to at most trunc characters
+// (including the "..." it's ending with then); trunc <= 3 disables it.
+func filterUrlizeTruncate(title string, trunc int) string {
+	runes := []rune(title)
+	if trunc > 3 && len(runes) > trunc {
+		return fmt.Sprintf("%s...", string(runes[:trunc-3]))
+	}
+	return title
+}
+
+func filterUrlizeEscape(s string, autoescape bool) string {
+	if !autoescape {
+		return s
+	}
+	t, _ := filterEscape(AsValue(s), nil)
+	return t.String()
+}
+
+// filterUrlizeEmails links the email addresses in text (which contains no
+// URLs); the remaining text is escaped if autoescape is true.
+func filterUrlizeEmails(b *bytes.Buffer, text string, autoescape bool, trunc int) {
+	last := 0
+	for _, loc := range filterUrlizeEmailRegexp.FindAllStringIndex(text, -1) {
+		b.WriteString(filterUrlizeEscape(text[last:loc[0]], autoescape))
+		mail := text[loc[0]:loc[1]]
+		title := filterUrlizeTruncate(mail, trunc)
+		fmt.Fprintf(b, `<a href="mailto:%s">%s</a>`, mail, filterUrlizeEscape(title, autoescape))
+		last = loc[1]
+	}
+	b.WriteString(filterUrlizeEscape(text[last:], autoescape))
+}
+
+func filterUrlizeHelper(input string, autoescape bool, trunc int, linkRel string) string {
+	rel := ""
+	if linkRel != "" {
+		rel = fmt.Sprintf(` rel="%s"`, filterUrlizeEscape(linkRel, true))
+	}
+
+	var b bytes.Buffer
+	last := 0
+	for _, loc := range filterUrlizeURLRegexp.FindAllStringIndex(input, -1) {
+		filterUrlizeEmails(&b, input[last:loc[0]], autoescape, trunc)
+		last = loc[1]
+
+		raw_url := input[loc[0]:loc[1]]
 		var prefix string
 		var suffix string
 		if strings.HasPrefix(raw_url, " ") {
@@ -663,48 +823,27 @@ func filterUrlizeHelper(input string, autoescape bool, trunc int) string {
 			url = fmt.Sprintf("http://%s", url)
 		}
 
-		title := raw_url
-
-		if trunc > 3 && len(title) > trunc {
-			title = fmt.Sprintf("%s...", title[:trunc-3])
-		}
-
-		if autoescape {
-			t, err := ApplyFilter("escape", AsValue(title), nil)
-			if err != nil {
-				panic(err)
-			}
-			title = t.String()
-		}
-
-		return fmt.Sprintf(`%s<a href="%s" rel="nofollow">%s</a>%s`, prefix, url, title, suffix)
-	})
-
-	sout = filterUrlizeEmailRegexp.ReplaceAllStringFunc(sout, func(mail string) string {
-
-		title := mail
-
-		if trunc > 3 && len(title) > trunc {
-			title = fmt.Sprintf("%s...", title[:trunc-3])
-		}
+		title := filterUrlizeTruncate(raw_url, trunc)
 
-		return fmt.Sprintf(`<a href="mailto:%s">%s</a>`, mail, title)
-	})
+		fmt.Fprintf(&b, `%s<a href="%s"%s>%s</a>%s`, prefix, filterUrlizeEscape(url, autoescape), rel,
+			filterUrlizeEscape(title, autoescape), suffix)
+	}
+	filterUrlizeEmails(&b, input[last:], autoescape, trunc)
 
-	return sout
+	return b.String()
 }
 
-func filterUrlize(in *Value, param *Value) (*Value, *Error) {
+func filterUrlize(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
 	autoescape := true
 	if param.IsBool() {
 		autoescape = param.Bool()
 	}
 
-	return AsValue(filterUrlizeHelper(in.String(), autoescape, -1)), nil
+	return AsValue(filterUrlizeHelper(in.String(), autoescape, -1, set.linkRel())), nil
 }
 
-func filterUrlizetrunc(in *Value, param *Value) (*Value, *Error) {
-	return AsValue(filterUrlizeHelper(in.String(), true, param.Integer())), nil
+func filterUrlizetrunc(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	return AsValue(filterUrlizeHelper(in.String(), true, param.Integer(), set.linkRel())), nil
 }
 
 func filterStringformat(in *Value, param *Value) (*Value, *Error) {
@@ -722,6 +861,61 @@ func filterStriptags(in *Value, param *Value) (*Value, *Error) {
 	return AsValue(strings.TrimSpace(s)), nil
 }
 
+var (
+	reStriptagsExceptTag  = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)\b([^>]*?)(/?)>`)
+	reStriptagsExceptHref = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	reStriptagsExceptURL  = regexp.MustCompile(`(?i)^(https?:|mailto:|[^:]*$)`)
+)
+
+// filterStriptagsExcept removes all HTML tags except the ones given as
+// comma-separated allowlist (e. g. striptags_except:"b,i,a") and escapes
+// the remaining text. The allowed tags are stripped of their attributes
+// (so no event handlers or styles pass), except the href attribute of
+// links with a http(s), mailto or relative URL. The output is safe.
+func filterStriptagsExcept(in *Value, param *Value) (*Value, *Error) {
+	allowed := make(map[string]bool)
+	for _, tag := range strings.Split(param.String(), ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			allowed[tag] = true
+		}
+	}
+
+	s := in.String()
+	var b bytes.Buffer
+	last := 0
+	for _, m := range reStriptagsExceptTag.FindAllStringSubmatchIndex(s, -1) {
+		text, _ := filterEscape(AsValue(s[last:m[0]]), nil)
+		b.WriteString(text.String())
+		last = m[1]
+
+		name := strings.ToLower(s[m[4]:m[5]])
+		if !allowed[name] {
+			continue
+		}
+		closing := s[m[2]:m[3]] == "/"
+		b.WriteString("<")
+		if closing {
+			b.WriteString("/")
+		}
+		b.WriteString(name)
+		if href := reStriptagsExceptHref.FindStringSubmatch(s[m[6]:m[7]]); !closing && name == "a" && href != nil {
+			url := strings.TrimSpace(href[1] + href[2] + href[3])
+			if reStriptagsExceptURL.MatchString(url) {
+				escaped, _ := filterEscape(AsValue(url), nil)
+				fmt.Fprintf(&b, ` href="%s"`, escaped.String())
+			}
+		}
+		if s[m[8]:m[9]] == "/" {
+			b.WriteString(" /")
+		}
+		b.WriteString(">")
+	}
+	text, _ := filterEscape(AsValue(s[last:]), nil)
+	b.WriteString(text.String())
+
+	return AsSafeValue(b.String()), nil
+}
+
 // https://en.wikipedia.org/wiki/Phoneword
 var filterPhone2numericMap = map[string]string{
 	"a": "2", "b": "2", "c": "2", "d": "3", "e": "3", "f": "3", "g": "4", "h": "4", "i": "4", "j": "5", "k": "5",
@@ -797,6 +991,26 @@ func filterRemovetags(in *Value, param *Value) (*Value, *Error) {
 	return AsValue(strings.TrimSpace(s)), nil
 }
 
+// filterReplace replaces the occurrences of the first argument by the
+// second one: {{ s|replace:"a","b" }}. The optional third argument (or the
+// count keyword argument) limits the number of replacements.
+func filterReplace(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	count := -1
+	if len(args) > 2 {
+		count = args[2].Integer()
+	}
+	if c, has := kwargs["count"]; has {
+		if len(args) > 2 {
+			return nil, &Error{
+				Sender:   "filter:replace",
+				ErrorMsg: "The count must not be given both as parameter and as keyword argument.",
+			}
+		}
+		count = c.Integer()
+	}
+	return AsValue(strings.Replace(in.String(), args[0].String(), args[1].String(), count)), nil
+}
+
 func filterRjust(in *Value, param *Value) (*Value, *Error) {
 	return AsValue(fmt.Sprintf(fmt.Sprintf("%%%ds", param.Integer()), in.String())), nil
 }
@@ -810,6 +1024,15 @@ func filterSlice(in *Value, param *Value) (*Value, *Error) {
 		}
 	}
 
+	if in.IsIterator() {
+		// Only consume the items up to the end of the slice
+		limit := -1
+		if comp[1] != "" {
+			limit = AsValue(comp[1]).Integer()
+		}
+		in = AsValue(in.iteratorItems(limit))
+	}
+
 	if !in.CanSlice() {
 		return in, nil
 	}
@@ -836,24 +1059,188 @@ func filterTitle(in *Value, param *Value) (*Value, *Error) {
 	return AsValue(strings.Title(strings.ToLower(in.String()))), nil
 }
 
+// filterTojson marshals the input to JSON which is safe to embed in
+// <script> elements: encoding/json escapes <, > and & (so "</script>"
+// can't end the element) as well as U+2028 and U+2029.
+// The optional parameter is the number of spaces to indent with.
+func filterTojson(in *Value, param *Value) (*Value, *Error) {
+	var b []byte
+	var err error
+	if param.IsNil() {
+		b, err = json.Marshal(in.Interface())
+	} else if param.Integer() < 0 {
+		return nil, &Error{
+			Sender:   "filter:tojson",
+			ErrorMsg: "Filter 'tojson' requires a non-negative indentation as parameter.",
+		}
+	} else {
+		b, err = json.MarshalIndent(in.Interface(), "", strings.Repeat(" ", param.Integer()))
+	}
+	if err != nil {
+		return nil, &Error{
+			Sender:   "filter:tojson",
+			ErrorMsg: fmt.Sprintf("Cannot marshal input to JSON: %s", err.Error()),
+		}
+	}
+	return AsSafeValue(string(b)), nil
+}
+
+// unorderedListItems pairs every item of list with its sublist (if the
+// item is followed by a list, see filterUnorderedList)
+func unorderedListItems(list *Value) (items, children []*Value) {
+	for i := 0; i < list.Len(); i++ {
+		item := list.Index(i)
+		var sublist *Value
+		if i+1 < list.Len() {
+			if next := list.Index(i + 1); next.CanSlice() && !next.IsString() {
+				sublist = next
+				i++
+			}
+		}
+		items = append(items, item)
+		children = append(children, sublist)
+	}
+	return
+}
+
+func unorderedListFormat(list *Value, tabs int) string {
+	indent := strings.Repeat("\t", tabs)
+	items, children := unorderedListItems(list)
+	output := make([]string, 0, len(items))
+	for i, item := range items {
+		if !item.isSafe() {
+			item, _ = filterEscape(item, nil)
+		}
+		sublist := ""
+		if children[i] != nil && children[i].Len() > 0 {
+			sublist = fmt.Sprintf("\n%s<ul>\n%s\n%s</ul>\n%s", indent,
+				unorderedListFormat(children[i], tabs+1), indent, indent)
+		}
+		output = append(output, fmt.Sprintf("%s<li>%s%s</li>", indent, item.String(), sublist))
+	}
+	return strings.Join(output, "\n")
+}
+
+// filterUnorderedList renders a (nested) list like Django's unordered_list
+// as <li> elements (without the outer <ul>); a list following an item is
+// rendered as its sublist:
+//
+//	[]interface{}{"States", []interface{}{"Kansas", []string{"Lawrence", "Topeka"}, "Illinois"}}
+//
+// Items are escaped unless they're marked as safe.
+func filterUnorderedList(in *Value, param *Value) (*Value, *Error) {
+	if !in.CanSlice() || in.IsString() {
+		return nil, &Error{
+			Sender:   "filter:unordered_list",
+			ErrorMsg: "Filter input argument must be a slice or an array.",
+		}
+	}
+	return AsSafeValue(unorderedListFormat(in, 1)), nil
+}
+
 func filterWordcount(in *Value, param *Value) (*Value, *Error) {
 	return AsValue(len(strings.Fields(in.String()))), nil
 }
 
-func filterWordwrap(in *Value, param *Value) (*Value, *Error) {
+// filterWordwrap puts the given number of words on each line. With keyword
+// arguments instead, it wraps the input's lines at a width in characters
+// like Django's wordwrap; existing line breaks are kept: width sets the
+// width, break the string inserted to break lines (default "\n") and long
+// breaks words longer than the width (which are kept on a line of their own
+// otherwise), e. g. wordwrap(width=40, break="<br>", long=true).
+func filterWordwrap(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	if len(kwargs) == 0 {
+		count := 0
+		if len(args) > 0 {
+			count = args[0].Integer()
+		}
+		return wordwrapWords(in, count), nil
+	}
+	if len(args) > 0 {
+		return nil, &Error{
+			Sender:   "filter:wordwrap",
+			ErrorMsg: "The number of words must not be given together with keyword arguments.",
+		}
+	}
+
+	width := 0
+	if w, has := kwargs["width"]; has {
+		if !w.IsInteger() {
+			return nil, &Error{
+				Sender:   "filter:wordwrap",
+				ErrorMsg: fmt.Sprintf("Width must be a number, got '%s'.", w.String()),
+			}
+		}
+		width = w.Integer()
+	}
+	lineBreak := "\n"
+	if b, has := kwargs["break"]; has {
+		lineBreak = b.String()
+	}
+	breakLong := false
+	if l, has := kwargs["long"]; has {
+		breakLong = l.IsTrue()
+	}
+	if width <= 0 {
+		return in, nil
+	}
+
+	inputLines := strings.Split(in.String(), "\n")
+	for i, inputLine := range inputLines {
+		var lines []string
+		var line []rune
+		for _, word := range strings.Fields(inputLine) {
+			runes := []rune(word)
+			for breakLong && len(runes) > width {
+				// Fill up the current line with the word's beginning
+				free := width
+				if len(line) > 0 {
+					free = width - len(line) - 1
+				}
+				if free <= 0 {
+					lines = append(lines, string(line))
+					line = nil
+					continue
+				}
+				if len(line) > 0 {
+					line = append(line, ' ')
+				}
+				lines = append(lines, string(append(line, runes[:free]...)))
+				line = nil
+				runes = runes[free:]
+			}
+			switch {
+			case len(line) == 0:
+				line = runes
+			case len(line)+1+len(runes) <= width:
+				line = append(append(line, ' '), runes...)
+			default:
+				lines = append(lines, string(line))
+				line = runes
+			}
+		}
+		if len(line) > 0 || len(lines) == 0 {
+			lines = append(lines, string(line))
+		}
+		inputLines[i] = strings.Join(lines, lineBreak)
+	}
+	return AsValue(strings.Join(inputLines, "\n")), nil
+}
+
+// wordwrapWords puts count words on each line.
+func wordwrapWords(in *Value, count int) *Value {
 	words := strings.Fields(in.String())
 	wordsLen := len(words)
-	wrapAt := param.Integer()
-	if wrapAt <= 0 {
-		return in, nil
+	if count <= 0 {
+		return in
 	}
 
-	linecount := wordsLen/wrapAt + wordsLen%wrapAt
+	linecount := (wordsLen + count - 1) / count
 	lines := make([]string, 0, linecount)
 	for i := 0; i < linecount; i++ {
-		lines = append(lines, strings.Join(words[wrapAt*i:min(wrapAt*(i+1), wordsLen)], " "))
+		lines = append(lines, strings.Join(words[count*i:min(count*(i+1), wordsLen)], " "))
 	}
-	return AsValue(strings.Join(lines, "\n")), nil
+	return AsValue(strings.Join(lines, "\n"))
 }
 
 func filterYesno(in *Value, param *Value) (*Value, *Error) {
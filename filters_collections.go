@@ -0,0 +1,396 @@
+package pongo2
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	RegisterFilterWithArgs("map", attributeFilterSignature, filterMap)                              // pongo-specific
+	RegisterFilter("select", filterSelect)                                                          // pongo-specific
+	RegisterFilter("reject", filterReject)                                                          // pongo-specific
+	RegisterFilterWithArgs("selectattr", FilterSignature{MinArgs: 1, MaxArgs: 2}, filterSelectattr) // pongo-specific
+	RegisterFilterWithArgs("rejectattr", FilterSignature{MinArgs: 1, MaxArgs: 2}, filterRejectattr) // pongo-specific
+
+	RegisterFilterWithArgs("sum", attributeFilterSignature, filterSum) // pongo-specific
+	RegisterFilterWithArgs("min", attributeFilterSignature, filterMin) // pongo-specific
+	RegisterFilterWithArgs("max", attributeFilterSignature, filterMax) // pongo-specific
+	RegisterFilterWithArgs("avg", attributeFilterSignature, filterAvg) // pongo-specific
+
+	RegisterFilterWithArgs("batch", batchFilterSignature, filterBatch) // pongo-specific
+	RegisterFilter("chunk", filterChunk)                               // pongo-specific
+}
+
+// The map filter and the aggregations take the attribute (a dotted path like
+// "Author.Name") either as parameter or as keyword argument:
+// {{ users|map(attribute="Name") }}
+var attributeFilterSignature = FilterSignature{MaxArgs: 1, Kwargs: []string{"attribute"}}
+
+// attributeArg returns the attribute path given to the filter (see
+// attributeFilterSignature), nil if there's none.
+func attributeArg(filter string, args []*Value, kwargs map[string]*Value) ([]string, *Error) {
+	attribute := ""
+	if len(args) > 0 {
+		attribute = args[0].String()
+	}
+	if a, has := kwargs["attribute"]; has {
+		if len(args) > 0 {
+			return nil, &Error{
+				Sender:   "filter:" + filter,
+				ErrorMsg: "The attribute must not be given both as parameter and as keyword argument.",
+			}
+		}
+		attribute = a.String()
+	}
+	if attribute == "" {
+		return nil, nil
+	}
+	return strings.Split(attribute, "."), nil
+}
+
+// Tests of the select/reject filters (like Jinja's tests); without a test
+// the items are checked for truthiness.
+var collectionTests = map[string]func(v *Value) bool{
+	"odd":    func(v *Value) bool { return v.IsInteger() && v.Integer()%2 != 0 },
+	"even":   func(v *Value) bool { return v.IsInteger() && v.Integer()%2 == 0 },
+	"none":   func(v *Value) bool { return v.IsNil() },
+	"string": func(v *Value) bool { return v.IsString() },
+	"number": func(v *Value) bool { return v.IsNumber() },
+	"empty":  func(v *Value) bool { return !v.IsTrue() },
+}
+
+func collectionTestNames() string {
+	names := make([]string, 0, len(collectionTests))
+	for name := range collectionTests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// collectionItems returns the items of the filter's input, which must be a
+// slice, an array or an iterator (which is consumed).
+func collectionItems(filter string, in *Value) ([]*Value, *Error) {
+	if in.IsIterator() {
+		in = AsValue(in.iteratorItems(-1))
+	}
+	if !in.CanSlice() || in.IsString() {
+		return nil, &Error{
+			Sender:   "filter:" + filter,
+			ErrorMsg: "Filter input argument must be a slice or an array.",
+		}
+	}
+	items := make([]*Value, 0, in.Len())
+	for i := 0; i < in.Len(); i++ {
+		items = append(items, in.Index(i))
+	}
+	return items, nil
+}
+
+// collectionTest returns the test called name (or the truthiness check if
+// name is empty).
+func collectionTest(filter string, name string) (func(v *Value) bool, *Error) {
+	if name == "" {
+		return (*Value).IsTrue, nil
+	}
+	test, has := collectionTests[name]
+	if !has {
+		return nil, &Error{
+			Sender:   "filter:" + filter,
+			ErrorMsg: fmt.Sprintf("Unknown test '%s' (valid tests are: %s).", name, collectionTestNames()),
+		}
+	}
+	return test, nil
+}
+
+// filterCollection keeps the items of in for which the test (applied to
+// the item's attribute, if given) returns keep.
+func filterCollection(filter string, in *Value, attribute []string, testName string, keep bool) (*Value, *Error) {
+	items, err := collectionItems(filter, in)
+	if err != nil {
+		return nil, err
+	}
+	test, err := collectionTest(filter, testName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v := item
+		if attribute != nil {
+			var attrErr error
+			if v, attrErr = regroupAttribute(item, attribute); attrErr != nil {
+				return nil, &Error{Sender: "filter:" + filter, ErrorMsg: attrErr.Error()}
+			}
+		}
+		if test(v) == keep {
+			result = append(result, item.Interface())
+		}
+	}
+	return AsValue(result), nil
+}
+
+// filterMap projects an attribute (a dotted path like "Author.Name") of
+// every item: {{ users|map(attribute="Name")|join:", " }}
+func filterMap(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	attribute, err := attributeArg("map", args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if attribute == nil {
+		return nil, &Error{
+			Sender:   "filter:map",
+			ErrorMsg: "Filter 'map' requires an attribute.",
+		}
+	}
+	items, err := collectionItems("map", in)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v, attrErr := regroupAttribute(item, attribute)
+		if attrErr != nil {
+			return nil, &Error{Sender: "filter:map", ErrorMsg: attrErr.Error()}
+		}
+		result = append(result, v.Interface())
+	}
+	return AsValue(result), nil
+}
+
+// filterSelect keeps the items which are true or pass the test given as
+// parameter: {{ numbers|select:"odd" }}
+func filterSelect(in *Value, param *Value) (*Value, *Error) {
+	return filterCollection("select", in, nil, param.String(), true)
+}
+
+// filterReject removes the items which are true or pass the test given as
+// parameter (the opposite of select).
+func filterReject(in *Value, param *Value) (*Value, *Error) {
+	return filterCollection("reject", in, nil, param.String(), false)
+}
+
+// attrArgs returns the attribute path and the optional test given to
+// selectattr/rejectattr, e. g. selectattr("Author.Age", "odd").
+func attrArgs(filter string, args []*Value) ([]string, string, *Error) {
+	if args[0].String() == "" {
+		return nil, "", &Error{
+			Sender:   "filter:" + filter,
+			ErrorMsg: fmt.Sprintf("Filter '%s' requires an attribute and optionally a test (e. g. %s(\"Age\", \"odd\")).", filter, filter),
+		}
+	}
+	testName := ""
+	if len(args) > 1 {
+		testName = args[1].String()
+	}
+	return strings.Split(args[0].String(), "."), testName, nil
+}
+
+// filterSelectattr keeps the items whose attribute is true or passes a
+// test: {{ posts|selectattr:"Published" }}, {{ users|selectattr("Age", "odd") }}
+func filterSelectattr(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	attribute, testName, err := attrArgs("selectattr", args)
+	if err != nil {
+		return nil, err
+	}
+	return filterCollection("selectattr", in, attribute, testName, true)
+}
+
+// filterRejectattr removes the items whose attribute is true or passes a
+// test (the opposite of selectattr).
+func filterRejectattr(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	attribute, testName, err := attrArgs("rejectattr", args)
+	if err != nil {
+		return nil, err
+	}
+	return filterCollection("rejectattr", in, attribute, testName, false)
+}
+
+// aggregateValues returns the numbers to aggregate: the items of in or
+// their attribute (e. g. items|sum(attribute="Price")).
+func aggregateValues(filter string, in *Value, args []*Value, kwargs map[string]*Value) ([]*Value, *Error) {
+	attribute, err := attributeArg(filter, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	items, err := collectionItems(filter, in)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*Value, 0, len(items))
+	for _, item := range items {
+		v := item
+		if attribute != nil {
+			var attrErr error
+			if v, attrErr = regroupAttribute(item, attribute); attrErr != nil {
+				return nil, &Error{Sender: "filter:" + filter, ErrorMsg: attrErr.Error()}
+			}
+		}
+		if !v.IsNumber() {
+			return nil, &Error{
+				Sender:   "filter:" + filter,
+				ErrorMsg: fmt.Sprintf("Filter '%s' can only aggregate numbers, got '%s'.", filter, v.String()),
+			}
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// filterSum sums up the items (or their attribute). The sum is an integer
+// if all summands are integers.
+func filterSum(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	values, err := aggregateValues("sum", in, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	intSum, floatSum := 0, 0.0
+	isFloat := false
+	for _, v := range values {
+		if v.IsFloat() {
+			isFloat = true
+		}
+		intSum += v.Integer()
+		floatSum += v.Float()
+	}
+	if isFloat {
+		return AsValue(floatSum), nil
+	}
+	return AsValue(intSum), nil
+}
+
+// filterAvg returns the average of the items (or of their attribute); it's
+// empty for an empty input.
+func filterAvg(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	values, err := aggregateValues("avg", in, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return AsValue(nil), nil
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v.Float()
+	}
+	return AsValue(sum / float64(len(values))), nil
+}
+
+// aggregateExtreme returns the value v for which less(v, other) is true
+// for all others, nil for an empty input.
+func aggregateExtreme(filter string, in *Value, args []*Value, kwargs map[string]*Value, less func(a, b float64) bool) (*Value, *Error) {
+	values, err := aggregateValues(filter, in, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return AsValue(nil), nil
+	}
+	extreme := values[0]
+	for _, v := range values[1:] {
+		if less(v.Float(), extreme.Float()) {
+			extreme = v
+		}
+	}
+	return extreme, nil
+}
+
+// filterMin returns the smallest item (or attribute).
+func filterMin(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	return aggregateExtreme("min", in, args, kwargs, func(a, b float64) bool { return a < b })
+}
+
+// filterMax returns the largest item (or attribute).
+func filterMax(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	return aggregateExtreme("max", in, args, kwargs, func(a, b float64) bool { return a > b })
+}
+
+var batchFilterSignature = FilterSignature{MinArgs: 1, MaxArgs: 1, Kwargs: []string{"fill"}}
+
+// filterBatch splits the items into rows of the size given as parameter,
+// e. g. to render 3 cards per row:
+//
+//	{% for row in cards|batch:3 %}<div class="row">{% for card in row %}...{% endfor %}</div>{% endfor %}
+//
+// The last row may be shorter; use batch(3, fill=X) to fill it up with X.
+func filterBatch(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	size := args[0].Integer()
+	if size <= 0 {
+		return nil, &Error{
+			Sender:   "filter:batch",
+			ErrorMsg: "Filter 'batch' requires a positive batch size as parameter.",
+		}
+	}
+	var fill interface{}
+	if f, has := kwargs["fill"]; has {
+		fill = f.Interface()
+	}
+
+	items, err := collectionItems("batch", in)
+	if err != nil {
+		return nil, err
+	}
+	// The size is user-supplied, allocations must be bounded by the items
+	if fill != nil && size > len(items) && len(items) > 0 {
+		return nil, &Error{
+			Sender:   "filter:batch",
+			ErrorMsg: "Filter 'batch' can't fill rows larger than the number of items.",
+		}
+	}
+	rows := make([][]interface{}, 0, (len(items)+size-1)/size)
+	for i := 0; i < len(items); i += size {
+		row := make([]interface{}, 0, min(size, len(items)-i))
+		for j := i; j < i+size && j < len(items); j++ {
+			row = append(row, items[j].Interface())
+		}
+		for fill != nil && len(row) < size {
+			row = append(row, fill)
+		}
+		rows = append(rows, row)
+	}
+	return AsValue(rows), nil
+}
+
+// filterChunk splits the items into the given number of chunks (e. g.
+// columns) of (almost) the same size; the first chunks hold one item more
+// if the items can't be distributed evenly. There are no empty chunks, i. e.
+// fewer items than chunks result in one chunk per item.
+func filterChunk(in *Value, param *Value) (*Value, *Error) {
+	count := param.Integer()
+	if count <= 0 {
+		return nil, &Error{
+			Sender:   "filter:chunk",
+			ErrorMsg: "Filter 'chunk' requires a positive number of chunks as parameter.",
+		}
+	}
+	items, err := collectionItems("chunk", in)
+	if err != nil {
+		return nil, err
+	}
+
+	// There's at most one chunk per item (the count is user-supplied)
+	if count > len(items) {
+		count = len(items)
+	}
+	if count == 0 {
+		return AsValue([][]interface{}{}), nil
+	}
+	chunks := make([][]interface{}, 0, count)
+	perChunk, extra := len(items)/count, len(items)%count
+	offset := 0
+	for i := 0; i < count; i++ {
+		size := perChunk
+		if i < extra {
+			size++
+		}
+		chunk := make([]interface{}, 0, size)
+		for _, item := range items[offset : offset+size] {
+			chunk = append(chunk, item.Interface())
+		}
+		chunks = append(chunks, chunk)
+		offset += size
+	}
+	return AsValue(chunks), nil
+}
@@ -0,0 +1,369 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetNumberSeparators sets the thousand and decimal separators used by the
+// intcomma and intword filters of the set's templates (default "," and ".")
+// to match the grouping and decimal characters of a locale, e. g. for
+// German:
+//
+//	set.SetNumberSeparators(".", ",")
+func (set *TemplateSet) SetNumberSeparators(thousand, decimal string) {
+	set.thousandSeparator, set.decimalSeparator = thousand, decimal
+}
+
+// numberSeparators returns the separators of the intcomma and intword
+// filters; set may be nil (see newSetParamFilter).
+func (set *TemplateSet) numberSeparators() (thousand, decimal string) {
+	if set == nil {
+		return ",", "."
+	}
+	return set.thousandSeparator, set.decimalSeparator
+}
+
+func init() {
+	registerFilter("timesince", newSetParamFilter(filterTimesince))
+	registerFilter("timeuntil", newSetParamFilter(filterTimeuntil))
+	registerFilter("naturaltime", newSetParamFilter(filterNaturaltime))
+	registerFilter("naturalday", newSetParamFilter(filterNaturalday))
+	RegisterFilterWithArgs("filesizeformat", FilterSignature{Kwargs: []string{"units"}}, filterFilesizeformat)
+	registerFilter("intcomma", newSetParamFilter(filterIntcomma))
+	registerFilter("intword", newSetParamFilter(filterIntword))
+	RegisterFilter("apnumber", filterApnumber)
+}
+
+var timesinceChunks = []struct {
+	seconds          int64
+	singular, plural string
+}{
+	{60 * 60 * 24 * 365, "year", "years"},
+	{60 * 60 * 24 * 30, "month", "months"},
+	{60 * 60 * 24 * 7, "week", "weeks"},
+	{60 * 60 * 24, "day", "days"},
+	{60 * 60, "hour", "hours"},
+	{60, "minute", "minutes"},
+}
+
+// formatTimesince formats the duration d like Django's timesince, e. g.
+// "3 days, 4 hours": the largest unit followed by the adjacent smaller unit
+// (if it's non-zero). Durations of less than a minute (including negative
+// ones) are "0 minutes".
+func formatTimesince(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 60 {
+		return "0 minutes"
+	}
+
+	var b bytes.Buffer
+	for i, chunk := range timesinceChunks {
+		count := seconds / chunk.seconds
+		if count == 0 {
+			continue
+		}
+		b.WriteString(pluralizeUnit(count, chunk.singular, chunk.plural))
+		if i+1 < len(timesinceChunks) {
+			next := timesinceChunks[i+1]
+			count2 := (seconds - count*chunk.seconds) / next.seconds
+			if count2 > 0 {
+				b.WriteString(", ")
+				b.WriteString(pluralizeUnit(count2, next.singular, next.plural))
+			}
+		}
+		break
+	}
+	return b.String()
+}
+
+func pluralizeUnit(count int64, singular, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
+
+// timeFilterArguments returns the filter's input and the reference time
+// (the optional parameter, the current time of the set otherwise, see
+// TemplateSet.NowFunc).
+func timeFilterArguments(set *TemplateSet, name string, in *Value, param *Value) (time.Time, time.Time, *Error) {
+	t, isTime := in.Interface().(time.Time)
+	if !isTime {
+		return time.Time{}, time.Time{}, &Error{
+			Sender:   "filter:" + name,
+			ErrorMsg: "Filter input argument must be of type 'time.Time'.",
+		}
+	}
+	if param.IsNil() {
+		return t, set.now(), nil
+	}
+	reference, isTime := param.Interface().(time.Time)
+	if !isTime {
+		return time.Time{}, time.Time{}, &Error{
+			Sender:   "filter:" + name,
+			ErrorMsg: "Filter parameter must be of type 'time.Time'.",
+		}
+	}
+	return t, reference, nil
+}
+
+func filterTimesince(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	t, reference, err := timeFilterArguments(set, "timesince", in, param)
+	if err != nil {
+		return nil, err
+	}
+	return AsValue(formatTimesince(reference.Sub(t))), nil
+}
+
+func filterTimeuntil(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	t, reference, err := timeFilterArguments(set, "timeuntil", in, param)
+	if err != nil {
+		return nil, err
+	}
+	return AsValue(formatTimesince(t.Sub(reference))), nil
+}
+
+// naturalUnit returns e. g. "a minute" or "5 minutes"
+func naturalUnit(count int64, article, singular, plural string) string {
+	if count == 1 {
+		return article + " " + singular
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
+
+// filterNaturaltime is like Django's humanize naturaltime: "now", "30
+// seconds ago", "an hour from now" or "2 days, 3 hours ago" (using
+// timesince for differences of a day or more).
+func filterNaturaltime(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	t, now, err := timeFilterArguments(set, "naturaltime", in, AsValue(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	d := now.Sub(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+
+	seconds := int64(d / time.Second)
+	var out string
+	switch {
+	case seconds == 0:
+		return AsValue("now"), nil
+	case seconds < 60:
+		out = naturalUnit(seconds, "a", "second", "seconds")
+	case seconds < 60*60:
+		out = naturalUnit(seconds/60, "a", "minute", "minutes")
+	case seconds < 60*60*24:
+		out = naturalUnit(seconds/(60*60), "an", "hour", "hours")
+	default:
+		out = formatTimesince(d)
+	}
+	return AsValue(out + " " + suffix), nil
+}
+
+// filterNaturalday returns "today", "tomorrow" or "yesterday" if the input
+// is on one of these days (in the input's time zone); otherwise it formats
+// the date like the date filter using the parameter (default "N j, Y").
+func filterNaturalday(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	t, now, err := timeFilterArguments(set, "naturalday", in, AsValue(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.In(t.Location())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch day.Sub(today) / (24 * time.Hour) {
+	case 0:
+		return AsValue("today"), nil
+	case 1:
+		return AsValue("tomorrow"), nil
+	case -1:
+		return AsValue("yesterday"), nil
+	}
+
+	format := "django:N j, Y"
+	if param.Len() > 0 {
+		format = param.String()
+	}
+	return AsValue(formatTime(t, format)), nil
+}
+
+var filesizeUnits = map[string]struct {
+	base  float64
+	units []string
+}{
+	"":        {1024, []string{"KB", "MB", "GB", "TB", "PB"}},
+	"binary":  {1024, []string{"KiB", "MiB", "GiB", "TiB", "PiB"}},
+	"decimal": {1000, []string{"kB", "MB", "GB", "TB", "PB"}},
+}
+
+// filterFilesizeformat formats a number of bytes like Django's
+// filesizeformat ("117.7 MB"). Like Django it uses multiples of 1024 with
+// the units KB, MB etc. by default; filesizeformat(units="binary") selects
+// the units KiB, MiB etc. and units="decimal" multiples of 1000 (kB, MB etc.).
+func filterFilesizeformat(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	units := ""
+	if u, has := kwargs["units"]; has {
+		units = u.String()
+	}
+	system, has := filesizeUnits[units]
+	if !has {
+		return nil, &Error{
+			Sender:   "filter:filesizeformat",
+			ErrorMsg: fmt.Sprintf("Unknown unit system '%s' (must be 'binary' or 'decimal').", units),
+		}
+	}
+
+	size := in.Float()
+	sign := ""
+	if size < 0 {
+		sign = "-"
+		size = -size
+	}
+
+	if size < system.base {
+		return AsValue(sign + pluralizeUnit(int64(size), "byte", "bytes")), nil
+	}
+	unit := 0
+	size /= system.base
+	for size >= system.base && unit < len(system.units)-1 {
+		size /= system.base
+		unit++
+	}
+	return AsValue(fmt.Sprintf("%s%.1f %s", sign, size, system.units[unit])), nil
+}
+
+// humanizeNumber returns the number in as a string using "." as decimal
+// separator and whether in is a number (or a string holding one) at all.
+func humanizeNumber(in *Value) (string, bool) {
+	switch {
+	case in.IsInteger():
+		return strconv.Itoa(in.Integer()), true
+	case in.IsFloat():
+		return strconv.FormatFloat(in.Float(), 'f', -1, 64), true
+	case in.IsString():
+		s := strings.TrimSpace(in.String())
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "", false
+		}
+		return s, true
+	}
+	return "", false
+}
+
+// filterIntcomma inserts a thousand separator (the parameter, defaulting
+// to the set's, see SetNumberSeparators()) every three digits: 1234567.89
+// becomes "1,234,567.89". Inputs which aren't numbers are returned
+// unchanged.
+func filterIntcomma(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	number, ok := humanizeNumber(in)
+	if !ok {
+		return in, nil
+	}
+	separator, decimalSeparator := set.numberSeparators()
+	if param.IsString() {
+		separator = param.String()
+	}
+
+	sign := ""
+	if strings.HasPrefix(number, "-") || strings.HasPrefix(number, "+") {
+		sign, number = number[:1], number[1:]
+	}
+	fraction := ""
+	if idx := strings.IndexByte(number, '.'); idx >= 0 {
+		number, fraction = number[:idx], decimalSeparator+number[idx+1:]
+	}
+
+	return AsValue(sign + groupDigits(number, separator) + fraction), nil
+}
+
+// groupDigits inserts separator between every three digits of the
+// (unsigned) integer given in digits.
+func groupDigits(digits string, separator string) string {
+	var b bytes.Buffer
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+var intwordUnits = []struct {
+	exponent int
+	name     string
+}{
+	{6, "million"},
+	{9, "billion"},
+	{12, "trillion"},
+	{15, "quadrillion"},
+	{18, "quintillion"},
+	{21, "sextillion"},
+	{24, "septillion"},
+	{27, "octillion"},
+	{30, "nonillion"},
+	{33, "decillion"},
+	{100, "googol"},
+}
+
+// filterIntword converts large numbers to a word form like Django's
+// intword: 1200000 becomes "1.2 million", 1290000000 "1.3 billion".
+// Numbers below one million (and inputs which aren't numbers) are returned
+// unchanged.
+func filterIntword(set *TemplateSet, in *Value, param *Value) (*Value, *Error) {
+	number, ok := humanizeNumber(in)
+	if !ok {
+		return in, nil
+	}
+	f, _ := strconv.ParseFloat(number, 64)
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	if f < 1e6 {
+		return in, nil
+	}
+
+	for i, unit := range intwordUnits {
+		value := math.Round(f/math.Pow10(unit.exponent)*10) / 10
+		if i+1 < len(intwordUnits) && f >= math.Pow10(intwordUnits[i+1].exponent) {
+			continue
+		}
+		if i+1 < len(intwordUnits) && intwordUnits[i+1].exponent-unit.exponent == 3 && value >= 1000 {
+			// Rounded up to the next unit, e. g. 999999999 is "1.0 billion"
+			continue
+		}
+		_, decimalSeparator := set.numberSeparators()
+		formatted := strings.Replace(strconv.FormatFloat(value, 'f', 1, 64), ".", decimalSeparator, 1)
+		return AsValue(fmt.Sprintf("%s%s %s", sign, formatted, unit.name)), nil
+	}
+	return in, nil
+}
+
+var apNumbers = [...]string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+
+// filterApnumber spells out the numbers 1 to 9 following the AP style
+// ("three"); all other inputs are returned unchanged.
+func filterApnumber(in *Value, param *Value) (*Value, *Error) {
+	number, ok := humanizeNumber(in)
+	if !ok {
+		return in, nil
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > 9 {
+		return in, nil
+	}
+	return AsValue(apNumbers[n-1]), nil
+}
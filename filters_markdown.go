@@ -0,0 +1,57 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterFilterWithArgs("markdown", FilterSignature{}, filterMarkdown)
+}
+
+// SetMarkdownRenderer sets the function the markdown filter converts its
+// input to HTML with, so any markdown library can be plugged in, e. g.
+// goldmark:
+//
+//	set.SetMarkdownRenderer(func(source string) (string, error) {
+//	    var b bytes.Buffer
+//	    err := goldmark.Convert([]byte(source), &b)
+//	    return b.String(), err
+//	}, false)
+//
+// The filter's output is only marked as safe if safe is true, i. e. if the
+// renderer guarantees its output is sanitized (or the input trusted);
+// otherwise it's autoescaped like any other string. Using the markdown
+// filter without a renderer is an execution error.
+func (set *TemplateSet) SetMarkdownRenderer(renderer func(string) (string, error), safe bool) {
+	set.markdownRenderer = renderer
+	set.markdownSafe = safe
+}
+
+// filterMarkdown is the markdown filter of the templates of a set; without
+// a renderer it falls back to the global one (which might be replaced using
+// ReplaceFilter()).
+func (set *TemplateSet) filterMarkdown(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	if set.markdownRenderer == nil {
+		return filters["markdown"].fn(ctx, in, args, kwargs)
+	}
+	html, err := set.markdownRenderer(in.String())
+	if err != nil {
+		return nil, &Error{
+			Sender:   "filter:markdown",
+			ErrorMsg: fmt.Sprintf("Markdown renderer failed: %s", err.Error()),
+		}
+	}
+	if set.markdownSafe {
+		return AsSafeValue(html), nil
+	}
+	return AsValue(html), nil
+}
+
+// filterMarkdown is the markdown filter used without a set (ApplyFilter())
+// or a renderer.
+func filterMarkdown(in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	return nil, &Error{
+		Sender:   "filter:markdown",
+		ErrorMsg: "No markdown renderer set (see TemplateSet.SetMarkdownRenderer()).",
+	}
+}
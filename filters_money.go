@@ -0,0 +1,137 @@
+package pongo2
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SetMoneyFormatter sets a function formatting the amounts of the money
+// filter of the set's templates instead of the built-in formatting, e. g.
+// to use a library with full CLDR data. It receives the amount, the ISO
+// 4217 currency code (upper case) and the locale (like "de-DE") given to
+// the filter. nil restores the built-in formatting.
+func (set *TemplateSet) SetMoneyFormatter(formatter func(amount float64, currency string, locale string) (string, error)) {
+	set.moneyFormatter = formatter
+}
+
+type moneyCurrency struct {
+	symbol   string
+	decimals int
+}
+
+// Currencies known to the built-in formatting; other currencies are
+// formatted with their code as symbol and two decimals.
+var moneyCurrencies = map[string]moneyCurrency{
+	"AUD": {"A$", 2},
+	"BRL": {"R$", 2},
+	"CAD": {"CA$", 2},
+	"CHF": {"CHF", 2},
+	"CNY": {"CN¥", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"INR": {"₹", 2},
+	"JPY": {"¥", 0},
+	"KRW": {"₩", 0},
+	"SEK": {"kr", 2},
+	"USD": {"$", 2},
+}
+
+type moneyLocale struct {
+	group, decimal string
+	symbolAfter    bool   // e. g. "1.234,56 €" instead of "€1,234.56"
+	symbolSpace    string // between symbol and amount
+}
+
+// Number formats known to the built-in formatting, by locale or language
+var moneyLocales = map[string]moneyLocale{
+	"en":    {",", ".", false, ""},
+	"de":    {".", ",", true, " "},
+	"de-CH": {"’", ".", false, " "},
+	"es":    {".", ",", true, " "},
+	"fr":    {" ", ",", true, " "},
+	"it":    {".", ",", true, " "},
+	"ja":    {",", ".", false, ""},
+	"nl":    {".", ",", false, " "},
+	"pt":    {".", ",", false, " "},
+	"sv":    {" ", ",", true, " "},
+}
+
+func init() {
+	registerFilter("money", newSetArgsFilter(FilterSignature{MinArgs: 1, MaxArgs: 1, Kwargs: []string{"locale"}}, filterMoney)) // pongo-specific
+}
+
+// formatMoney is the built-in formatting of the money filter.
+func formatMoney(amount float64, currency string, locale string) (string, error) {
+	format, has := moneyLocales[locale]
+	if !has {
+		// Fall back to the language, e. g. "de" for "de-AT"
+		language := strings.SplitN(locale, "-", 2)[0]
+		format, has = moneyLocales[language]
+		if !has {
+			return "", fmt.Errorf("unknown locale '%s'", locale)
+		}
+	}
+	cur, has := moneyCurrencies[currency]
+	if !has {
+		cur = moneyCurrency{currency, 2}
+	}
+
+	number := strconv.FormatFloat(math.Abs(amount), 'f', cur.decimals, 64)
+	fraction := ""
+	if idx := strings.IndexByte(number, '.'); idx >= 0 {
+		number, fraction = number[:idx], format.decimal+number[idx+1:]
+	}
+	number = groupDigits(number, format.group) + fraction
+
+	sign := ""
+	if amount < 0 && strings.Trim(number, "0.,") != "" {
+		sign = "-"
+	}
+	if format.symbolAfter {
+		return sign + number + format.symbolSpace + cur.symbol, nil
+	}
+	return sign + cur.symbol + format.symbolSpace + number, nil
+}
+
+// filterMoney formats an amount of money. It takes the ISO 4217 currency
+// code and optionally the locale as keyword argument (default "en"):
+// {{ price|money("EUR", locale="de-DE") }} renders "1.234,50 €". The
+// built-in formatting covers the common currencies and locales; use
+// TemplateSet.SetMoneyFormatter() to plug in another implementation.
+func filterMoney(set *TemplateSet, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	currency := strings.ToUpper(args[0].String())
+	if currency == "" {
+		return nil, &Error{
+			Sender:   "filter:money",
+			ErrorMsg: "Filter 'money' requires a currency code (e. g. \"EUR\").",
+		}
+	}
+	locale := "en"
+	if l, has := kwargs["locale"]; has {
+		locale = strings.Replace(l.String(), "_", "-", -1)
+	}
+
+	number, ok := humanizeNumber(in)
+	if !ok {
+		return nil, &Error{
+			Sender:   "filter:money",
+			ErrorMsg: fmt.Sprintf("Filter input argument must be a number, got '%s'.", in.String()),
+		}
+	}
+	amount, _ := strconv.ParseFloat(number, 64)
+
+	format := formatMoney
+	if set != nil && set.moneyFormatter != nil {
+		format = set.moneyFormatter
+	}
+	out, err := format(amount, currency, locale)
+	if err != nil {
+		return nil, &Error{
+			Sender:   "filter:money",
+			ErrorMsg: fmt.Sprintf("Cannot format %s %s: %s", number, currency, err.Error()),
+		}
+	}
+	return AsValue(out), nil
+}
@@ -0,0 +1,91 @@
+package pongo2
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+func init() {
+	RegisterFilter("regex_match", filterRegexMatch)     // pongo-specific
+	RegisterFilter("regex_replace", filterRegexReplace) // pongo-specific
+}
+
+// Upper bound of cached patterns; the cache is cleared once it's reached
+// (patterns are usually literals, so it's only reached if they're built
+// from variables)
+const regexCacheSize = 1000
+
+var (
+	regexCache      = make(map[string]*regexp.Regexp)
+	regexCacheMutex sync.RWMutex
+)
+
+// compileRegex compiles pattern and caches the result keyed by the pattern,
+// so filters don't recompile their patterns on every execution.
+func compileRegex(filter string, pattern string) (*regexp.Regexp, *Error) {
+	regexCacheMutex.RLock()
+	re, has := regexCache[pattern]
+	regexCacheMutex.RUnlock()
+	if has {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &Error{
+			Sender:   "filter:" + filter,
+			ErrorMsg: fmt.Sprintf("Invalid regular expression '%s': %s", pattern, err.Error()),
+		}
+	}
+
+	regexCacheMutex.Lock()
+	if len(regexCache) >= regexCacheSize {
+		regexCache = make(map[string]*regexp.Regexp)
+	}
+	regexCache[pattern] = re
+	regexCacheMutex.Unlock()
+
+	return re, nil
+}
+
+// filterRegexMatch reports whether the input contains a match of the
+// pattern given as parameter (anchor it using ^ and $ to match the whole
+// input): {% if name|regex_match:"^[a-z]+$" %}
+func filterRegexMatch(in *Value, param *Value) (*Value, *Error) {
+	re, err := compileRegex("regex_match", param.String())
+	if err != nil {
+		return nil, err
+	}
+	return AsValue(re.MatchString(in.String())), nil
+}
+
+// filterRegexReplace replaces all matches of a pattern. The parameter holds
+// the pattern and the replacement separated by a delimiter, which is the
+// parameter's first character (like sed): "/[0-9]+/#/" replaces all numbers
+// by "#". Use another delimiter if the pattern contains slashes (e. g.
+// "|/+|/|"). The replacement may refer to submatches using $1 or ${name}.
+func filterRegexReplace(in *Value, param *Value) (*Value, *Error) {
+	arg := param.String()
+	if arg == "" {
+		return nil, &Error{
+			Sender:   "filter:regex_replace",
+			ErrorMsg: "Filter 'regex_replace' requires a parameter like \"/pattern/replacement/\".",
+		}
+	}
+	delimiter := arg[:1]
+	parts := strings.Split(strings.TrimSuffix(arg[1:], delimiter), delimiter)
+	if len(parts) != 2 {
+		return nil, &Error{
+			Sender:   "filter:regex_replace",
+			ErrorMsg: fmt.Sprintf("Malformed parameter '%s', expected '%spattern%sreplacement%s'.", arg, delimiter, delimiter, delimiter),
+		}
+	}
+
+	re, err := compileRegex("regex_replace", parts[0])
+	if err != nil {
+		return nil, err
+	}
+	return AsValue(re.ReplaceAllString(in.String(), parts[1])), nil
+}
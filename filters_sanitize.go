@@ -0,0 +1,43 @@
+package pongo2
+
+func init() {
+	RegisterFilter("sanitize", filterSanitize)
+}
+
+// Sanitizer cleans user-authored HTML, e. g. by removing all elements and
+// attributes not allowed by a policy. bluemonday's policies implement it.
+type Sanitizer interface {
+	Sanitize(html string) string
+}
+
+// SetSanitizer sets the sanitizer of the sanitize filter, so user-authored
+// HTML can be rendered without escaping it, e. g. using bluemonday:
+//
+//	set.SetSanitizer(bluemonday.UGCPolicy())
+//
+// Templates use {{ comment.body|sanitize }} (or {{ text|markdown|sanitize }}
+// for markdown rendered without SetMarkdownRenderer()'s safe flag). The
+// filter's output is marked as safe since it's been sanitized. Using the
+// sanitize filter without a sanitizer is an execution error.
+func (set *TemplateSet) SetSanitizer(sanitizer Sanitizer) {
+	set.sanitizer = sanitizer
+}
+
+// filterSanitize is the sanitize filter of the templates of a set; without
+// a sanitizer it falls back to the global one (which might be replaced using
+// ReplaceFilter()).
+func (set *TemplateSet) filterSanitize(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	if set.sanitizer == nil {
+		return filters["sanitize"].fn(ctx, in, args, kwargs)
+	}
+	return AsSafeValue(set.sanitizer.Sanitize(in.String())), nil
+}
+
+// filterSanitize is the sanitize filter used without a set (ApplyFilter())
+// or a sanitizer.
+func filterSanitize(in *Value, param *Value) (*Value, *Error) {
+	return nil, &Error{
+		Sender:   "filter:sanitize",
+		ErrorMsg: "No sanitizer set (see TemplateSet.SetSanitizer()).",
+	}
+}
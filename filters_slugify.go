@@ -0,0 +1,107 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SetSlugTransliterator sets a function the slugify filter of the set's
+// templates uses to transliterate characters to ASCII: it returns the
+// replacement of r and whether it handles r at all. Characters it doesn't
+// handle are passed to the built-in transliteration of common Latin
+// characters (e. g. "é" to "e", "ß" to "ss"). Letters and digits of other
+// scripts are kept.
+func (set *TemplateSet) SetSlugTransliterator(transliterator func(r rune) (string, bool)) {
+	set.slugTransliterator = transliterator
+}
+
+var slugTransliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "ae", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "oe", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ș': "s", 'ß': "ss", 'ť': "t", 'ț': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "ue", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+func init() {
+	registerFilter("slugify", newSetArgsFilter(FilterSignature{Kwargs: []string{"max", "sep"}}, filterSlugify))
+}
+
+// filterSlugify converts the input to a slug usable in URLs: it's
+// lowercased and transliterated (see SetSlugTransliterator()), runs of other
+// characters than letters and digits are replaced by a separator and
+// leading and trailing separators are removed. "Grüße aus Köln!" becomes
+// "gruesse-aus-koeln".
+// The optional keyword argument max limits the slug to that many characters
+// (cut at a separator if possible) and sep sets the separator (default
+// "-"), e. g. slugify(max=40, sep="_").
+func filterSlugify(set *TemplateSet, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	maxLength := 0
+	if m, has := kwargs["max"]; has {
+		if !m.IsInteger() || m.Integer() < 0 {
+			return nil, &Error{
+				Sender:   "filter:slugify",
+				ErrorMsg: fmt.Sprintf("Keyword argument 'max' must be a non-negative number, got '%s'.", m.String()),
+			}
+		}
+		maxLength = m.Integer()
+	}
+	separator := "-"
+	if s, has := kwargs["sep"]; has {
+		separator = s.String()
+	}
+
+	var b bytes.Buffer
+	pendingSeparator := false
+	write := func(s string) {
+		if pendingSeparator && b.Len() > 0 {
+			b.WriteString(separator)
+		}
+		pendingSeparator = false
+		b.WriteString(s)
+	}
+	var transliterator func(r rune) (string, bool)
+	if set != nil {
+		transliterator = set.slugTransliterator
+	}
+	for _, r := range strings.ToLower(in.String()) {
+		if transliterator != nil {
+			if s, ok := transliterator(r); ok {
+				write(s)
+				continue
+			}
+		}
+		if s, ok := slugTransliterations[r]; ok {
+			write(s)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			write(string(r))
+			continue
+		}
+		pendingSeparator = true
+	}
+	slug := b.String()
+
+	if maxLength > 0 {
+		runes := []rune(slug)
+		if len(runes) > maxLength {
+			slug = string(runes[:maxLength])
+			// Don't cut words if possible
+			if next := string(runes[maxLength:]); !strings.HasPrefix(next, separator) {
+				if idx := strings.LastIndex(slug, separator); idx > 0 {
+					slug = slug[:idx]
+				}
+			}
+			slug = strings.TrimSuffix(slug, separator)
+		}
+	}
+
+	return AsValue(slug), nil
+}
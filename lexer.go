@@ -2,6 +2,7 @@ package pongo2
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"unicode/utf8"
 )
@@ -33,7 +34,7 @@ var (
 		"==", ">=", "<=", "&&", "||", "{{", "}}", "{%", "%}", "!=", "<>",
 
 		// 1-Char symbol
-		"(", ")", "+", "-", "*", "<", ">", "/", "^", ",", ".", "!", "|", ":", "=", "%",
+		"(", ")", "+", "-", "*", "<", ">", "/", "^", ",", ".", "!", "|", ":", "=", "%", "[", "]",
 	}
 
 	// Available keywords in pongo2
@@ -116,6 +117,7 @@ func lex(name string, input string) ([]*Token, *Error) {
 			Column:   errtoken.Col,
 			Sender:   "lexer",
 			ErrorMsg: errtoken.Val,
+			Excerpt:  excerpt(input, errtoken.Line, errtoken.Col),
 		}
 	}
 	return l.tokens, nil
@@ -212,31 +214,45 @@ func (l *lexer) eof() bool {
 	return l.start >= len(l.input)-1
 }
 
+var lexerVerbatimStart = regexp.MustCompile(`^\{% verbatim(?: ([a-zA-Z0-9_]+))? %\}`)
+
+// matchVerbatimStart matches "{% verbatim %}" or "{% verbatim name %}" at
+// the current position.
+func (l *lexer) matchVerbatimStart() []string {
+	if !strings.HasPrefix(l.input[l.pos:], "{% verbatim") {
+		return nil
+	}
+	return lexerVerbatimStart.FindStringSubmatch(l.input[l.pos:])
+}
+
 func (l *lexer) run() {
 	for {
-		// TODO: Support verbatim tag names
+		// Verbatim blocks may be named to allow the contents to contain
+		// "{% endverbatim %}", see
 		// https://docs.djangoproject.com/en/dev/ref/templates/builtins/#verbatim
 		if l.inVerbatim {
 			name := l.verbatimName
 			if name != "" {
 				name += " "
 			}
-			if strings.HasPrefix(l.input[l.pos:], fmt.Sprintf("{%% endverbatim %s%%}", name)) { // end verbatim
+			endTag := fmt.Sprintf("{%% endverbatim %s%%}", name)
+			if strings.HasPrefix(l.input[l.pos:], endTag) { // end verbatim
 				if l.pos > l.start {
 					l.emit(TokenHTML)
 				}
-				w := len("{% endverbatim %}")
+				w := len(endTag)
 				l.pos += w
 				l.col += w
 				l.ignore()
 				l.inVerbatim = false
 			}
-		} else if strings.HasPrefix(l.input[l.pos:], "{% verbatim %}") { // tag
+		} else if m := l.matchVerbatimStart(); m != nil { // tag
 			if l.pos > l.start {
 				l.emit(TokenHTML)
 			}
 			l.inVerbatim = true
-			w := len("{% verbatim %}")
+			l.verbatimName = m[1]
+			w := len(m[0])
 			l.pos += w
 			l.col += w
 			l.ignore()
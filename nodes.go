@@ -2,13 +2,19 @@ package pongo2
 
 // The root document
 type nodeDocument struct {
-	Nodes []INode
+	Nodes  []INode
+	tokens []*Token // the token identifying each node (for errors)
 }
 
 func (doc *nodeDocument) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	for _, n := range doc.Nodes {
+	for i, n := range doc.Nodes {
 		err := n.Execute(ctx, writer)
 		if err != nil {
+			if err = ctx.handleError(err, writer); err != nil {
+				return err
+			}
+		}
+		if err := ctx.checkLimits(doc.tokens[i]); err != nil {
 			return err
 		}
 	}
@@ -3,12 +3,18 @@ package pongo2
 type NodeWrapper struct {
 	Endtag string
 	nodes  []INode
+	tokens []*Token // the token identifying each node (for errors)
 }
 
 func (wrapper *NodeWrapper) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	for _, n := range wrapper.nodes {
+	for i, n := range wrapper.nodes {
 		err := n.Execute(ctx, writer)
 		if err != nil {
+			if err = ctx.handleError(err, writer); err != nil {
+				return err
+			}
+		}
+		if err := ctx.checkLimits(wrapper.tokens[i]); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,111 @@
+package pongo2
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// OutputProfile configures templates for a kind of output: whether they're
+// autoescaped by default and what escaping means. A profile is selected for
+// a whole set using TemplateSet.SetOutputProfile() or for a single template
+// using the {% output %} pragma:
+//
+//	{% output "text" %}Hello {{ name }}, ...
+type OutputProfile struct {
+	// Name of the profile used by the {% output %} pragma
+	Name string
+
+	// Whether variables are autoescaped unless turned off using
+	// {% autoescape off %}
+	Autoescape bool
+
+	// Escaper of the escape filter and the autoescaping (nil escapes HTML)
+	Escaper func(string) string
+
+	// ContentType is a hint for the Content-Type header of the output (see
+	// Template.ContentType())
+	ContentType string
+}
+
+var (
+	// OutputHTML is the default profile of all sets
+	OutputHTML = &OutputProfile{
+		Name:        "html",
+		Autoescape:  true,
+		ContentType: "text/html; charset=utf-8",
+	}
+
+	// OutputXML escapes the XML special characters (using &apos; instead
+	// of &#39;)
+	OutputXML = &OutputProfile{
+		Name:        "xml",
+		Autoescape:  true,
+		Escaper:     strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace,
+		ContentType: "application/xml; charset=utf-8",
+	}
+
+	// OutputText doesn't escape anything by default, e. g. for plain-text
+	// emails
+	OutputText = &OutputProfile{
+		Name:        "text",
+		Autoescape:  false,
+		ContentType: "text/plain; charset=utf-8",
+	}
+
+	// OutputJSON escapes variables for JSON strings, i. e. they're expected
+	// to be output within quotes: {"name": "{{ name }}"}
+	OutputJSON = &OutputProfile{
+		Name:        "json",
+		Autoescape:  true,
+		Escaper:     escapeJSONString,
+		ContentType: "application/json",
+	}
+)
+
+// Profiles available to the {% output %} pragma
+var outputProfiles = map[string]*OutputProfile{
+	OutputHTML.Name: OutputHTML,
+	OutputXML.Name:  OutputXML,
+	OutputText.Name: OutputText,
+	OutputJSON.Name: OutputJSON,
+}
+
+// escapeJSONString escapes s for use within a JSON string.
+func escapeJSONString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// SetOutputProfile configures the set's templates for the given kind of
+// output (OutputHTML by default): it sets the escaper (see SetEscaper()) and
+// AutoescapeDefault. Templates can select
+// another profile using the {% output %} pragma.
+func (set *TemplateSet) SetOutputProfile(profile *OutputProfile) {
+	set.outputProfile = profile
+	set.escaper = profile.Escaper
+	set.AutoescapeDefault = profile.Autoescape
+}
+
+// profile returns the output profile selected by the template's pragma or
+// its set.
+func (tpl *Template) profile() *OutputProfile {
+	if tpl.outputProfile != nil {
+		return tpl.outputProfile
+	}
+	return tpl.set.outputProfile
+}
+
+// ContentType returns the content type hint of the template's output
+// profile (e. g. "text/html; charset=utf-8"), which can be used for the
+// Content-Type header of the response.
+func (tpl *Template) ContentType() string {
+	return tpl.profile().ContentType
+}
+
+// autoescape returns whether the template is autoescaped by default.
+func (tpl *Template) autoescape() bool {
+	if tpl.outputProfile != nil {
+		return tpl.outputProfile.Autoescape
+	}
+	return tpl.set.AutoescapeDefault
+}
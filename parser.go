@@ -34,6 +34,9 @@ type Parser struct {
 	// if the parser parses a template document, here will be
 	// a reference to it (needed to access the template through Tags)
 	template *Template
+
+	// Errors of the document's elements recorded so far (see recoverFrom)
+	errors ErrorList
 }
 
 // Creates a new parser to parse tokens.
@@ -190,9 +193,13 @@ func (p *Parser) Error(msg string, token *Token) *Error {
 		}
 	}
 	var line, col int
+	var excerpt string
 	if token != nil {
 		line = token.Line
 		col = token.Col
+		if p.template != nil {
+			excerpt = p.template.excerpt(token.Filename, line, col)
+		}
 	}
 	return &Error{
 		Template: p.template,
@@ -202,6 +209,7 @@ func (p *Parser) Error(msg string, token *Token) *Error {
 		Column:   col,
 		Token:    token,
 		ErrorMsg: msg,
+		Excerpt:  excerpt,
 	}
 }
 
@@ -253,13 +261,50 @@ func (p *Parser) WrapUntilTag(names ...string) (*NodeWrapper, *Parser, *Error) {
 		}
 
 		// Otherwise process next element to be wrapped
+		token := p.elementToken()
+		start := p.idx
 		node, err := p.parseDocElement()
 		if err != nil {
-			return nil, nil, err
+			p.recoverFrom(start, err)
+			continue
 		}
 		wrapper.nodes = append(wrapper.nodes, node)
+		wrapper.tokens = append(wrapper.tokens, token)
 	}
 
 	return nil, nil, p.Error(fmt.Sprintf("Unexpected EOF, expected tag %s.", strings.Join(names, " or ")),
 		p.lastToken)
 }
+
+// recoverFrom records the error of the document element starting at the
+// token index start and skips the rest of the element, so parsing continues
+// with the next one and all errors of a template are reported at once.
+// Unknown end tags following an error are ignored since they're most likely
+// the end of a block tag which failed to parse.
+func (p *Parser) recoverFrom(start int, err *Error) {
+	strayEndTag := false
+	if len(p.errors) > 0 && err.Token != nil && err.Token.Typ == TokenIdentifier && strings.HasPrefix(err.Token.Val, "end") {
+		_, exists := p.template.set.lookupTag(err.Token.Val)
+		strayEndTag = !exists
+	}
+	if !strayEndTag {
+		p.errors = append(p.errors, err)
+	}
+
+	closing := "}}"
+	if t := p.Get(start); t != nil && t.Typ == TokenSymbol && t.Val == "{%" {
+		closing = "%}"
+	}
+	for idx := start + 1; idx < len(p.tokens); idx++ {
+		t := p.tokens[idx]
+		if t.Typ == TokenSymbol && t.Val == closing {
+			// The element might have been parsed beyond its end (e. g. a
+			// block tag's content)
+			if idx >= p.idx {
+				p.idx = idx + 1
+			}
+			return
+		}
+	}
+	p.idx = len(p.tokens)
+}
@@ -0,0 +1,119 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+// TagArguments are the arguments of a custom tag as parsed by
+// Parser.ParseTagArguments(), e. g. for
+//
+//	{% your_tag_name user.name "title" size=3 wrap=true as result %}
+//
+// Args holds the evaluators of `user.name` and `"title"`, Kwargs the ones of
+// `size` and `wrap` and AsName is "result".
+type TagArguments struct {
+	// Positional arguments in the order they were given
+	Args []IEvaluator
+
+	// Keyword arguments (key=expr) by their names
+	Kwargs map[string]IEvaluator
+
+	// The variable name of a trailing "as name" clause (empty if not given)
+	AsName string
+}
+
+// Evaluate evaluates all positional and keyword arguments against the
+// given execution context.
+func (ta *TagArguments) Evaluate(ctx *ExecutionContext) ([]*Value, map[string]*Value, *Error) {
+	args := make([]*Value, 0, len(ta.Args))
+	for _, evaluator := range ta.Args {
+		value, err := evaluator.Evaluate(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, value)
+	}
+
+	kwargs := make(map[string]*Value, len(ta.Kwargs))
+	for name, evaluator := range ta.Kwargs {
+		value, err := evaluator.Evaluate(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		kwargs[name] = value
+	}
+
+	return args, kwargs, nil
+}
+
+// ParseTagArguments parses all remaining arguments of a tag: positional
+// arguments (any expression), followed by keyword arguments (key=expr)
+// and an optional trailing "as name" clause. It's meant to be called by
+// tag parsers on the 'arguments' parser (see TagParser):
+//
+//	func tagCardParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+//	    args, err := arguments.ParseTagArguments()
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    ...
+//	}
+func (p *Parser) ParseTagArguments() (*TagArguments, *Error) {
+	ta := &TagArguments{
+		Kwargs: make(map[string]IEvaluator),
+	}
+
+	for p.Remaining() > 0 {
+		// "as name" must be the last clause
+		if p.Match(TokenKeyword, "as") != nil {
+			nameToken := p.MatchType(TokenIdentifier)
+			if nameToken == nil {
+				return nil, p.Error("Expected a variable name after 'as'.", nil)
+			}
+			if p.Remaining() > 0 {
+				return nil, p.Error("The 'as' clause must be the last argument.", nil)
+			}
+			ta.AsName = nameToken.Val
+			break
+		}
+
+		// key=expr
+		if keyToken := p.PeekType(TokenIdentifier); keyToken != nil && p.PeekN(1, TokenSymbol, "=") != nil {
+			p.ConsumeN(2)
+			if _, has := ta.Kwargs[keyToken.Val]; has {
+				return nil, p.Error(fmt.Sprintf("Keyword argument '%s' given more than once.", keyToken.Val), keyToken)
+			}
+			valueExpr, err := p.ParseExpression()
+			if err != nil {
+				return nil, err
+			}
+			ta.Kwargs[keyToken.Val] = valueExpr
+			continue
+		}
+
+		if len(ta.Kwargs) > 0 {
+			return nil, p.Error("Positional arguments must not follow keyword arguments.", nil)
+		}
+		expr, err := p.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		ta.Args = append(ta.Args, expr)
+	}
+
+	return ta, nil
+}
+
+// WrapUntilEndTag wraps all nodes up to the end tag of the tag called name
+// ("{% endname %}", which must not have any arguments). It's the common case
+// of WrapUntilTag() for block tags without intermediate tags (like "else").
+func (p *Parser) WrapUntilEndTag(name string) (*NodeWrapper, *Error) {
+	wrapper, endargs, err := p.WrapUntilTag("end" + name)
+	if err != nil {
+		return nil, err
+	}
+	if endargs.Count() > 0 {
+		return nil, endargs.Error(fmt.Sprintf("Arguments not allowed for tag 'end%s'.", name), nil)
+	}
+	return wrapper, nil
+}
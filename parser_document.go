@@ -1,5 +1,9 @@
 package pongo2
 
+import (
+	"fmt"
+)
+
 // Doc = { ( Filter | Tag | HTML ) }
 func (p *Parser) parseDocElement() (INode, *Error) {
 	t := p.Current()
@@ -7,6 +11,9 @@ func (p *Parser) parseDocElement() (INode, *Error) {
 	switch t.Typ {
 	case TokenHTML:
 		p.Consume() // consume HTML element
+		if p.template.htmlScanner != nil {
+			p.template.htmlScanner.feed(t.Val)
+		}
 		return &nodeHTML{token: t}, nil
 	case TokenSymbol:
 		switch t.Val {
@@ -29,12 +36,39 @@ func (p *Parser) parseDocElement() (INode, *Error) {
 	return nil, p.Error("Unexpected token (only HTML/tags/filters in templates allowed)", t)
 }
 
+// elementToken returns the token identifying the next document element
+// (the tag's name or the variable's first token) which is used to report
+// errors during execution.
+func (p *Parser) elementToken() *Token {
+	t := p.Current()
+	if t != nil && t.Typ == TokenSymbol && (t.Val == "{%" || t.Val == "{{") {
+		if next := p.Get(p.idx + 1); next != nil {
+			return next
+		}
+	}
+	return t
+}
+
+// parse compiles the template. It reports the first error; the errors of
+// all elements are available as Error.Errors if there's more than one.
 func (tpl *Template) parse() *Error {
+	tpl.htmlScanner = &htmlContextScanner{}
 	tpl.parser = newParser(tpl.name, tpl.tokens, tpl)
 	doc, err := tpl.parser.parseDocument()
 	if err != nil {
 		return err
 	}
+	switch len(tpl.parser.errors) {
+	case 0:
+	case 1:
+		return tpl.parser.errors[0]
+	default:
+		first := *tpl.parser.errors[0]
+		first.ErrorMsg += fmt.Sprintf(" (and %d more errors)", len(tpl.parser.errors)-1)
+		first.Errors = tpl.parser.errors
+		return &first
+	}
+	tpl.checkOutsideBlocks(doc)
 	tpl.root = doc
 	return nil
 }
@@ -43,11 +77,15 @@ func (p *Parser) parseDocument() (*nodeDocument, *Error) {
 	doc := &nodeDocument{}
 
 	for p.Remaining() > 0 {
+		token := p.elementToken()
+		start := p.idx
 		node, err := p.parseDocElement()
 		if err != nil {
-			return nil, err
+			p.recoverFrom(start, err)
+			continue
 		}
 		doc.Nodes = append(doc.Nodes, node)
+		doc.tokens = append(doc.tokens, token)
 	}
 
 	return doc, nil
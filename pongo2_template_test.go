@@ -1,13 +1,24 @@
 package pongo2_test
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/flosch/pongo2"
@@ -105,6 +116,7 @@ var tplContext = pongo2.Context{
 		"name":                     "john doe",
 		"included_file":            "INCLUDES.helper",
 		"included_file_not_exists": "INCLUDES.helper.not_exists",
+		"included_file_fallbacks":  []string{"includes.helper.not_exists", "includes.helper"},
 		"nil":   nil,
 		"uint":  uint(8),
 		"float": float64(3.1415),
@@ -124,6 +136,7 @@ Yep!`,
 		"one_item_list":      []int{99},
 		"multiple_item_list": []int{1, 1, 2, 3, 5, 8, 13, 21, 34, 55},
 		"unsorted_int_list":  []int{192, 581, 22, 1, 249, 9999, 1828591, 8271},
+		"pairs":              [][]interface{}{{"a", 1}, {"b", 2}},
 		"misc_list":          []interface{}{"Hello", 99, 3.14, "good"},
 		"escape_text":        "This is \\a Test. \"Yep\". 'Yep'.",
 		"xss":                "<script>alert(\"uh oh\");</script>",
@@ -263,6 +276,12 @@ func TestTemplates(t *testing.T) {
 	}
 }
 
+// errorLine returns the first line of err's message, i. e. without the
+// source excerpt of *pongo2.Error.
+func errorLine(err error) string {
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
+
 func TestExecutionErrors(t *testing.T) {
 	//debug = true
 
@@ -308,7 +327,7 @@ func TestExecutionErrors(t *testing.T) {
 			}
 
 			re := regexp.MustCompile(fmt.Sprintf("^%s$", checks[idx]))
-			if !re.MatchString(err.Error()) {
+			if !re.MatchString(errorLine(err)) {
 				t.Fatalf("[%s Line %d] Error for '%s' (err = '%s') does not match the (regexp-)check: %s",
 					match, idx+1, test, err.Error(), checks[idx])
 			}
@@ -354,7 +373,7 @@ func TestCompilationErrors(t *testing.T) {
 				t.Fatalf("[%s | Line %d] Expected error for (got none): %s", match, idx+1, tests[idx])
 			}
 			re := regexp.MustCompile(fmt.Sprintf("^%s$", checks[idx]))
-			if !re.MatchString(err.Error()) {
+			if !re.MatchString(errorLine(err)) {
 				t.Fatalf("[%s | Line %d] Error for '%s' (err = '%s') does not match the (regexp-)check: %s",
 					match, idx+1, test, err.Error(), checks[idx])
 			}
@@ -393,29 +412,2955 @@ func TestBaseDirectory(t *testing.T) {
 	}
 }
 
-func BenchmarkCache(b *testing.B) {
-	cacheSet := pongo2.NewSet("cache set", pongo2.MustNewLocalFileSystemLoader(""))
-	for i := 0; i < b.N; i++ {
-		tpl, err := cacheSet.FromCache("template_tests/complex.tpl")
+func TestFSLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html":          &fstest.MapFile{Data: []byte("Hello {% block name %}{% endblock %}!")},
+		"pages/index.html":   &fstest.MapFile{Data: []byte(`{% extends "base.html" %}{% block name %}{% include "partials/name.html" %}{% endblock %}`)},
+		"partials/name.html": &fstest.MapFile{Data: []byte("{{ name }}")},
+	}
+	s := pongo2.NewSet("fs loader", pongo2.NewFSLoader(fsys))
+
+	tpl, err := s.FromFile("/pages/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"name": "fs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Hello fs!" {
+		t.Errorf("out ('%s') != 'Hello fs!'", out)
+	}
+
+	if _, err := s.FromFile("../outside.html"); err == nil {
+		t.Error("expected an error when loading a template outside of the file system")
+	}
+}
+
+func TestPreloadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": &fstest.MapFile{Data: []byte("[{% block body %}{% endblock %}]")},
+		"pages/home.html":   &fstest.MapFile{Data: []byte(`{% extends "layouts/base.html" %}{% block body %}home{% endblock %}`)},
+		"README.md":         &fstest.MapFile{Data: []byte("{% not a template")},
+	}
+	s := pongo2.NewSet("preload fs", pongo2.NewFSLoader(fsys))
+	if err := s.PreloadFS(fsys, "*.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the source; the cache must serve the precompiled template
+	delete(fsys, "pages/home.html")
+
+	tpl, err := s.FromCache("pages/home.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[home]" {
+		t.Errorf("out ('%s') != '[home]'", out)
+	}
+
+	if err := s.PreloadFS(fsys, "*.md"); err == nil {
+		t.Error("expected a compilation error for README.md")
+	}
+}
+
+func TestMemoryLoader(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"base.html": "<{% block content %}{% endblock %}>",
+	})
+	loader.Set("page.html", `{% extends "base.html" %}{% block content %}{% include "/greeting.html" %}{% endblock %}`)
+	loader.Set("greeting.html", "hi {{ name }}")
+	s := pongo2.NewSet("memory loader", loader)
+
+	tpl, err := s.FromString(`{% include "page.html" %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"name": "mem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<hi mem>" {
+		t.Errorf("out ('%s') != '<hi mem>'", out)
+	}
+
+	loader.Delete("greeting.html")
+	if _, err := s.FromFile("page.html"); err == nil {
+		t.Error("expected an error after deleting an included template")
+	}
+}
+
+func TestChainLoader(t *testing.T) {
+	project := pongo2.NewMemoryLoader(map[string]string{
+		"header.html": "project header",
+	})
+	vendor := pongo2.NewMemoryLoader(map[string]string{
+		"header.html": "vendor header",
+		"page.html":   `{% include "header.html" %} / {% include "footer.html" %}`,
+		"footer.html": "vendor footer",
+	})
+	s := pongo2.NewSet("chain loader", pongo2.NewChainLoader(project, vendor))
+
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "project header / vendor footer" {
+		t.Errorf("out ('%s') != 'project header / vendor footer'", out)
+	}
+
+	if _, err := s.FromFile("missing.html"); err == nil {
+		t.Error("expected an error for a template missing in all loaders")
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	s := pongo2.NewSet("namespaces", pongo2.NewMemoryLoader(map[string]string{
+		"page.html": `{% extends "admin::layout.html" %}{% block body %}{% include "mail::sig.html" %}{% endblock %}`,
+		"nav.html":  "default nav",
+	}))
+	if err := s.RegisterNamespace("admin", pongo2.NewMemoryLoader(map[string]string{
+		"layout.html": `{% include "nav.html" %}|{% ssi "admin::nav.html" %}|{% block body %}{% endblock %}`,
+		"nav.html":    "admin nav",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterNamespace("mail", pongo2.NewMemoryLoader(map[string]string{
+		"sig.html": "regards",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterNamespace("mail", pongo2.NewMemoryLoader(nil)); err == nil {
+		t.Error("expected an error when registering a namespace twice")
+	}
+
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "default nav|admin nav|regards" {
+		t.Errorf("out ('%s') != 'default nav|admin nav|regards'", out)
+	}
+}
+
+func TestCacheModTime(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"page.html": `{% extends "base.html" %}{% block v %}1{% endblock %}`,
+		"base.html": "version {% block v %}{% endblock %}",
+	})
+	s := pongo2.NewSet("cache mtime", loader)
+	s.CacheCheckModTime = true
+
+	render := func() string {
+		tpl, err := s.FromCache("page.html")
 		if err != nil {
-			b.Fatal(err)
+			t.Fatal(err)
 		}
-		err = tpl.ExecuteWriterUnbuffered(tplContext, ioutil.Discard)
+		out, err := tpl.Execute(nil)
 		if err != nil {
-			b.Fatal(err)
+			t.Fatal(err)
 		}
+		return out
+	}
+
+	if out := render(); out != "version 1" {
+		t.Errorf("out ('%s') != 'version 1'", out)
+	}
+	loader.Set("page.html", `{% extends "base.html" %}{% block v %}2{% endblock %}`)
+	if out := render(); out != "version 2" {
+		t.Errorf("out ('%s') != 'version 2' (stale cache entry)", out)
+	}
+
+	// Changing a dependency invalidates the cached template as well
+	loader.Set("base.html", "v{% block v %}{% endblock %}")
+	if out := render(); out != "v2" {
+		t.Errorf("out ('%s') != 'v2' (stale dependency)", out)
+	}
+
+	s.CacheCheckModTime = false
+	loader.Set("base.html", "ignored")
+	if out := render(); out != "v2" {
+		t.Errorf("out ('%s') != 'v2' (modification times must be ignored)", out)
 	}
 }
 
-func BenchmarkCacheDebugOn(b *testing.B) {
-	cacheDebugSet := pongo2.NewSet("cache set", pongo2.MustNewLocalFileSystemLoader(""))
-	cacheDebugSet.Debug = true
-	for i := 0; i < b.N; i++ {
-		tpl, err := cacheDebugSet.FromFile("template_tests/complex.tpl")
+func TestInvalidateOnChange(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"page.html": `{% extends "base.html" %}{% block v %}1{% endblock %}`,
+		"base.html": "version {% block v %}{% endblock %}",
+	})
+	s := pongo2.NewSet("invalidate on change", loader)
+
+	var invalidate func(path string)
+	s.InvalidateOnChange(func(fn func(path string)) {
+		invalidate = fn
+	})
+
+	render := func() string {
+		tpl, err := s.FromCache("page.html")
 		if err != nil {
-			b.Fatal(err)
+			t.Fatal(err)
 		}
-		err = tpl.ExecuteWriterUnbuffered(tplContext, ioutil.Discard)
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if out := render(); out != "version 1" {
+		t.Errorf("out ('%s') != 'version 1'", out)
+	}
+	loader.Set("base.html", "v{% block v %}{% endblock %}")
+	if out := render(); out != "version 1" {
+		t.Errorf("out ('%s') != 'version 1' (template must still be cached)", out)
+	}
+
+	// Invalidating a dependency evicts the templates depending on it
+	invalidate("base.html")
+	if out := render(); out != "v1" {
+		t.Errorf("out ('%s') != 'v1' (stale dependency)", out)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"page.html": "v1",
+	})
+	s := pongo2.NewSet("cache ttl", loader)
+	s.CacheTTL = time.Hour
+
+	render := func() string {
+		tpl, err := s.FromCache("page.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if out := render(); out != "v1" {
+		t.Errorf("out ('%s') != 'v1'", out)
+	}
+	loader.Set("page.html", "v2")
+	if out := render(); out != "v1" {
+		t.Errorf("out ('%s') != 'v1' (template must still be cached)", out)
+	}
+
+	s.CacheTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if out := render(); out != "v2" {
+		t.Errorf("out ('%s') != 'v2' (expired template must be recompiled)", out)
+	}
+}
+
+func TestCacheCapacity(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"a.html": "a",
+		"b.html": "b",
+		"c.html": "c",
+	})
+	s := pongo2.NewSet("cache capacity", loader)
+	s.SetCacheCapacity(2)
+
+	render := func(name string) string {
+		tpl, err := s.FromCache(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	render("a.html")
+	render("b.html")
+	render("a.html") // b.html is the least recently used now
+	render("c.html")
+	if n := s.CacheEvictions(); n != 1 {
+		t.Errorf("evictions (%d) != 1", n)
+	}
+
+	loader.Set("a.html", "A")
+	loader.Set("b.html", "B")
+	if out := render("a.html"); out != "a" {
+		t.Errorf("out ('%s') != 'a' (a.html must still be cached)", out)
+	}
+	if out := render("b.html"); out != "B" {
+		t.Errorf("out ('%s') != 'B' (b.html must have been evicted)", out)
+	}
+
+	s.SetCacheCapacity(1)
+	if n := s.CacheEvictions(); n != 3 {
+		t.Errorf("evictions (%d) != 3", n)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"a.html": "a",
+		"b.html": "b",
+	})
+	s := pongo2.NewSet("cache invalidate", loader)
+
+	render := func(name string) string {
+		tpl, err := s.FromCache(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	render("a.html")
+	render("b.html")
+	loader.Set("a.html", "A")
+	loader.Set("b.html", "B")
+
+	s.Invalidate("a.html")
+	if out := render("a.html"); out != "A" {
+		t.Errorf("out ('%s') != 'A' (a.html must have been invalidated)", out)
+	}
+	if out := render("b.html"); out != "b" {
+		t.Errorf("out ('%s') != 'b' (b.html must still be cached)", out)
+	}
+
+	s.ClearCache()
+	if out := render("b.html"); out != "B" {
+		t.Errorf("out ('%s') != 'B' (cache must have been cleared)", out)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	s := pongo2.NewSet("cache stats", pongo2.NewMemoryLoader(map[string]string{
+		"a.html": "a",
+		"b.html": "b",
+	}))
+
+	for _, name := range []string{"a.html", "b.html", "a.html", "a.html"} {
+		if _, err := s.FromCache(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := s.CacheStats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if _, has := stats.CompileTimes["a.html"]; !has {
+		t.Errorf("compile time of a.html missing: %+v", stats.CompileTimes)
+	}
+	if names := s.CachedTemplates(); fmt.Sprint(names) != "[a.html b.html]" {
+		t.Errorf("cached templates (%v) != [a.html b.html]", names)
+	}
+}
+
+type slowCountingLoader struct {
+	*pongo2.MemoryLoader
+	mutex sync.Mutex
+	gets  map[string]int
+}
+
+func (l *slowCountingLoader) Get(path string) (io.Reader, error) {
+	l.mutex.Lock()
+	l.gets[path]++
+	l.mutex.Unlock()
+	if path == "slow.html" {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return l.MemoryLoader.Get(path)
+}
+
+func TestCacheConcurrentCompilation(t *testing.T) {
+	loader := &slowCountingLoader{
+		MemoryLoader: pongo2.NewMemoryLoader(map[string]string{
+			"slow.html": "slow",
+			"fast.html": "fast",
+		}),
+		gets: make(map[string]int),
+	}
+	s := pongo2.NewSet("concurrent cache", loader)
+	if _, err := s.FromCache("fast.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.FromCache("slow.html"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Cache hits must not wait for the slow compilation
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	if _, err := s.FromCache("fast.html"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 25*time.Millisecond {
+		t.Errorf("cache hit took %s (blocked by compilation)", d)
+	}
+
+	wg.Wait()
+	if n := loader.gets["slow.html"]; n != 1 {
+		t.Errorf("slow.html was loaded %d times, expected once", n)
+	}
+}
+
+func TestPreloadDirAndCompileGlob(t *testing.T) {
+	s := pongo2.NewSet("preload dir", pongo2.NewMemoryLoader(map[string]string{
+		"mails/welcome.html": "Welcome {{ name }}",
+		"mails/broken.html":  "{% if %}",
+		"mails/broken2.html": "{{ }}",
+		"pages/index.html":   "Index",
+	}))
+
+	err := s.PreloadDir("mails")
+	errs, ok := err.(pongo2.ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected an ErrorList with 2 errors, got: %v", err)
+	}
+	if errs[0].Filename != "mails/broken.html" || errs[1].Filename != "mails/broken2.html" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if names := s.CachedTemplates(); fmt.Sprint(names) != "[mails/welcome.html]" {
+		t.Errorf("cached templates (%v) != [mails/welcome.html]", names)
+	}
+
+	if err := s.CompileGlob("pages/*.html"); err != nil {
+		t.Fatal(err)
+	}
+	if names := s.CachedTemplates(); fmt.Sprint(names) != "[mails/welcome.html pages/index.html]" {
+		t.Errorf("cached templates (%v) != [mails/welcome.html pages/index.html]", names)
+	}
+}
+
+func TestLoadPrelexed(t *testing.T) {
+	loader := pongo2.NewMemoryLoader(map[string]string{
+		"base.html": "<{% block body %}{% endblock %}>",
+		"page.html": `{% extends "base.html" %}{% block body %}{{ name|upper }}{% endblock %}`,
+	})
+	s := pongo2.NewSet("compile", loader)
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tpl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := pongo2.NewSet("load pre-lexed", loader)
+	loaded, err := s2.LoadPrelexed(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := loaded.Execute(pongo2.Context{"name": "john"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<JOHN>" {
+		t.Errorf("out ('%s') != '<JOHN>'", out)
+	}
+
+	// The loaded template is served from the cache
+	loader.Set("page.html", "changed")
+	cached, err := s2.FromCache("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != loaded {
+		t.Error("FromCache() didn't return the loaded template")
+	}
+
+	if _, err := s2.LoadPrelexed([]byte("garbage")); err == nil {
+		t.Error("expected an error for invalid data")
+	}
+}
+
+type localeLoader struct {
+	locale *string
+}
+
+func (l localeLoader) Abs(base, name string) string { return name }
+
+func (l localeLoader) Get(path string) (io.Reader, error) {
+	return strings.NewReader(*l.locale + ":" + path), nil
+}
+
+func TestCacheKeyFunc(t *testing.T) {
+	locale := "en"
+	s := pongo2.NewSet("cache key", localeLoader{&locale})
+	s.CacheKeyFunc = func(filename string) string {
+		return locale + "/" + filename
+	}
+
+	render := func() string {
+		tpl, err := s.FromCache("page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if out := render(); out != "en:page" {
+		t.Errorf("out ('%s') != 'en:page'", out)
+	}
+	locale = "de"
+	if out := render(); out != "de:page" {
+		t.Errorf("out ('%s') != 'de:page'", out)
+	}
+	if names := s.CachedTemplates(); fmt.Sprint(names) != "[de/page en/page]" {
+		t.Errorf("cached templates (%v) != [de/page en/page]", names)
+	}
+
+	// Invalidating a filename evicts all its variants
+	s.Invalidate("page")
+	if n := len(s.CachedTemplates()); n != 0 {
+		t.Errorf("%d templates still cached", n)
+	}
+}
+
+func TestIncludeIgnoreMissing(t *testing.T) {
+	s := pongo2.NewSet("ignore missing", pongo2.NewMemoryLoader(map[string]string{
+		"broken.html": `{% include "nested_missing.html" %}`,
+	}))
+
+	out := s.RenderTemplateString(`[{% include "missing.html" ignore missing %}]`, nil)
+	if out != "[]" {
+		t.Errorf("out ('%s') != '[]'", out)
+	}
+
+	// Existing templates failing to load must not be ignored
+	if _, err := s.FromString(`{% include "broken.html" ignore missing %}`); err == nil {
+		t.Error("expected an error for an existing template with a missing include")
+	}
+}
+
+func TestArchiveLoaders(t *testing.T) {
+	files := map[string]string{
+		"theme/base.html": "<{% block body %}{% endblock %}>",
+		"theme/page.html": `{% extends "theme/base.html" %}{% block body %}archived{% endblock %}`,
+	}
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipLoader, err := pongo2.NewZipLoaderFromReader(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tarBuf bytes.Buffer
+	gw := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: "../" + name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	tarLoader, err := pongo2.NewTarLoaderFromReader(&tarBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, loader := range []pongo2.TemplateLoader{zipLoader, tarLoader} {
+		s := pongo2.NewSet("archive", loader)
+		tpl, err := s.FromFile("theme/page.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "<archived>" {
+			t.Errorf("%T: out ('%s') != '<archived>'", loader, out)
+		}
+		if _, err := s.FromFile("../../etc/passwd"); err == nil {
+			t.Errorf("%T: expected an error for a path outside of the archive", loader)
+		}
+	}
+}
+
+func TestBlobLoader(t *testing.T) {
+	blobs := map[string]string{"mail/welcome.html": "Welcome {{ name }}!"}
+	fetches := 0
+	loader := pongo2.NewBlobLoader(func(path string) (io.ReadCloser, error) {
+		fetches++
+		if path == "broken.html" {
+			return nil, errors.New("storage unavailable")
+		}
+		content, has := blobs[path]
+		if !has {
+			return nil, fmt.Errorf("blob %s: %w", path, fs.ErrNotExist)
+		}
+		return ioutil.NopCloser(strings.NewReader(content)), nil
+	}, 2)
+	now := time.Date(2016, 3, 15, 12, 0, 0, 0, time.UTC)
+	loader.Now = func() time.Time { return now }
+	s := pongo2.NewSet("blob loader", loader)
+
+	for i := 0; i < 2; i++ {
+		out := s.RenderTemplateFile("/mail/welcome.html", pongo2.Context{"name": "blob"})
+		if out != "Welcome blob!" {
+			t.Errorf("out ('%s') != 'Welcome blob!'", out)
+		}
+		if _, err := s.FromFile("mail/missing.html"); err == nil {
+			t.Error("expected an error for a missing blob")
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("expected 2 fetches (positive and negative caching), got %d", fetches)
+	}
+
+	now = now.Add(time.Hour)
+	s.RenderTemplateFile("mail/welcome.html", nil)
+	if fetches != 3 {
+		t.Errorf("expected a refetch after the cache entry expired, got %d fetches", fetches)
+	}
+
+	// Optional includes only skip missing templates, not failing storages
+	tpl, err := s.FromString(`{% include "mail/missing.html" if_exists %}ok`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(nil); err != nil || out != "ok" {
+		t.Errorf("expected the missing template to be skipped, got '%s' (%v)", out, err)
+	}
+	if _, err := s.FromString(`{% include "broken.html" if_exists %}`); err == nil || !strings.Contains(err.Error(), "storage unavailable") {
+		t.Errorf("expected the storage error, got %v", err)
+	}
+
+	// Expired entries are dropped and the least recently used evicted
+	now = now.Add(time.Hour)
+	loader.MaxEntries = 2
+	if !loader.Exists("mail/welcome.html") || loader.Len() != 1 {
+		t.Errorf("expected the expired entries to be dropped, got %d entries", loader.Len())
+	}
+	for i := 0; i < 5; i++ {
+		loader.Exists(fmt.Sprintf("missing-%d.html", i))
+	}
+	if n := loader.Len(); n != 2 {
+		t.Errorf("expected 2 cache entries, got %d", n)
+	}
+	fetches = 0
+	loader.Exists("missing-4.html")
+	loader.Exists("mail/welcome.html")
+	if fetches != 1 {
+		t.Errorf("expected only the evicted template to be fetched again, got %d fetches", fetches)
+	}
+}
+
+func TestHTTPLoader(t *testing.T) {
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if strings.HasSuffix(r.URL.Path, "secret.html") {
+			w.Write([]byte("secret"))
+			return
+		}
+		if r.URL.Path != "/templates/hello.html" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("Hello {{ name }}!"))
+	}))
+	defer srv.Close()
+
+	loader, err := pongo2.NewHTTPLoader(srv.URL + "/templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := pongo2.NewSet("http loader", loader)
+
+	for i := 0; i < 2; i++ {
+		tpl, err := s.FromFile("hello.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(pongo2.Context{"name": "http"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "Hello http!" {
+			t.Errorf("out ('%s') != 'Hello http!'", out)
+		}
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("expected 2 requests with 1 revalidation, got %d/%d", requests, notModified)
+	}
+
+	if _, err := s.FromFile("missing.html"); err == nil {
+		t.Error("expected an error for a missing remote template")
+	}
+	for _, name := range []string{"../secret.html", srv.URL + "/templates/../secret.html",
+		srv.URL + "/templates/%2e%2e/secret.html", srv.URL + "/templatesecret.html"} {
+		if _, err := s.FromFile(name); err == nil {
+			t.Errorf("expected an error for %s outside of the base URL", name)
+		}
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	tpl, err := pongo2.FromString("{% for i in items %}{{ slow() }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{
+		"items": make([]int, 100),
+		"slow": func() string {
+			time.Sleep(time.Millisecond)
+			return "."
+		},
+	}
+
+	_, err = tpl.ExecuteWithOptions(ctx, pongo2.ExecuteOptions{Timeout: 10 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if !strings.HasSuffix(errorLine(err), "near 'slow'] Execution timeout of 10ms exceeded.") {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	out, err := tpl.ExecuteWithOptions(ctx, pongo2.ExecuteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 100 {
+		t.Errorf("len(out) (%d) != 100", len(out))
+	}
+}
+
+func TestMaxOutputSize(t *testing.T) {
+	s := pongo2.NewSet("max output size", pongo2.NewMemoryLoader(map[string]string{
+		"item.html": "{{ i }}",
+	}))
+	s.MaxOutputSize = 10
+
+	tpl, err := s.FromString(`{% for i in items %}{% include "item.html" %}{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := tpl.Execute(pongo2.Context{"items": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "123" {
+		t.Errorf("out ('%s') != '123'", out)
+	}
+
+	_, err = tpl.Execute(pongo2.Context{"items": make([]int, 11)})
+	if err == nil || !strings.HasSuffix(errorLine(err), "Output size limit of 10 bytes exceeded.") {
+		t.Errorf("expected an output size error, got: %v", err)
+	}
+
+	// Bodies rendered into memory first count towards the limit while
+	// they grow (but only once, when nested)
+	ticks := 0
+	tick := func() string {
+		ticks++
+		return "x"
+	}
+	tpl, err = s.FromString(`{% filter upper %}{% for i in items %}{{ tick() }}{% endfor %}{% endfilter %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(pongo2.Context{"items": make([]int, 1000), "tick": tick})
+	if err == nil || !strings.HasSuffix(errorLine(err), "Output size limit of 10 bytes exceeded.") {
+		t.Errorf("expected an output size error, got: %v", err)
+	}
+	if ticks > 11 {
+		t.Errorf("the filter's body was rendered %d times after exceeding the limit", ticks-11)
+	}
+
+	tpl, err = s.FromString(`{% filter upper %}{% spaceless %}<b>abc</b>{% endspaceless %}{% endfilter %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<B>ABC</B>" {
+		t.Errorf("out ('%s') != '<B>ABC</B>'", out)
+	}
+}
+
+func TestMaxLoopIterations(t *testing.T) {
+	s := pongo2.NewSet("max loop iterations", pongo2.NewMemoryLoader(nil))
+	s.MaxLoopIterations = 10
+
+	tpl, err := s.FromString("{% for i in outer %}{% for j in inner %}.{% endfor %}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{"outer": make([]int, 3), "inner": make([]int, 3)}
+
+	// 3 outer + 9 inner iterations
+	_, err = tpl.Execute(ctx)
+	if err == nil || !strings.HasSuffix(errorLine(err), "near 'for'] Loop iteration limit of 10 exceeded.") {
+		t.Errorf("expected a loop limit error, got: %v", err)
+	}
+
+	out, err := tpl.ExecuteWithOptions(ctx, pongo2.ExecuteOptions{MaxLoopIterations: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "........." {
+		t.Errorf("out ('%s') != '.........'", out)
+	}
+
+	s.LoopLimitError = func(limit int) error {
+		return fmt.Errorf("Too many items (limit: %d).", limit)
+	}
+	_, err = tpl.Execute(ctx)
+	if err == nil || !strings.HasSuffix(errorLine(err), "Too many items (limit: 10).") {
+		t.Errorf("expected a custom loop limit error, got: %v", err)
+	}
+}
+
+func TestMaxIncludeDepth(t *testing.T) {
+	s := pongo2.NewSet("max include depth", pongo2.NewMemoryLoader(map[string]string{
+		"a.html":    `{% include "b.html" %}`,
+		"b.html":    `{% include "a.html" %}`,
+		"lazy.html": `{% include name %}`,
+	}))
+	s.MaxIncludeDepth = 3
+
+	_, err := s.FromFile("a.html")
+	if err == nil || !strings.HasSuffix(errorLine(err), "Maximum include depth of 3 exceeded: a.html -> b.html -> a.html -> b.html -> a.html") {
+		t.Errorf("expected an include depth error, got: %v", err)
+	}
+
+	tpl, err := s.FromFile("lazy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(pongo2.Context{"name": "lazy.html"})
+	if err == nil || !strings.HasSuffix(errorLine(err), "Maximum include depth of 3 exceeded: lazy.html -> lazy.html -> lazy.html -> lazy.html") {
+		t.Errorf("expected an include depth error, got: %v", err)
+	}
+}
+
+func TestExecuteBlock(t *testing.T) {
+	s := pongo2.NewSet("execute block", pongo2.NewMemoryLoader(map[string]string{
+		"base.html": "<title>{% block title %}Base{% endblock %}</title>{% block content %}{% endblock %}",
+		"page.html": `{% extends "base.html" %}{% block content %}<ul>{% for row in rows %}{% block row %}<li>{{ row }}</li>{% endblock %}{% endfor %}</ul>{% endblock %}`,
+	}))
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{"rows": []int{1, 2}}
+
+	tests := map[string]string{
+		"content": "<ul><li>1</li><li>2</li></ul>",
+		"title":   "Base",
+	}
+	for block, expected := range tests {
+		out, err := tpl.ExecuteBlock(block, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Errorf("block %s: out ('%s') != '%s'", block, out, expected)
+		}
+	}
+
+	if _, err := tpl.ExecuteBlock("missing", ctx); err == nil {
+		t.Error("expected an error for a missing block")
+	}
+}
+
+func TestGlobalsShadowing(t *testing.T) {
+	s := pongo2.NewSet("globals", pongo2.NewMemoryLoader(map[string]string{
+		"inc.html": "{{ site }}/{{ user }}",
+	}))
+	s.Globals["site"] = "example.com"
+	s.Globals["user"] = "anonymous"
+
+	tpl, err := s.FromString(`{{ site }} {{ user }} {% for i in items %}{{ site }}{% endfor %} {% include "inc.html" %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"user": "john", "items": []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "example.com john example.com example.com/john"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+}
+
+func TestNowFunc(t *testing.T) {
+	s := pongo2.NewSet("now", pongo2.NewMemoryLoader(nil))
+	s.NowFunc = func() time.Time {
+		return time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	tpl, err := s.FromString(`{% now "django:Y-m-d H:i" %} {% now "django:jS N, P" %} {% now "2006/01/02" %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2020-03-01 00:00 1st March, midnight 2020/03/01"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+}
+
+func TestStaticTag(t *testing.T) {
+	s := pongo2.NewSet("static", pongo2.NewMemoryLoader(nil))
+	s.StaticURL = "https://cdn.example.com/assets/"
+	s.StaticManifest = map[string]string{
+		"css/app.css": "css/app.3f2a9c.css",
+	}
+
+	tpl, err := s.FromString(`{% static "css/app.css" %} {% static "/js/app.js" %} {% static file as url %}<{{ url }}>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"file": "img/a&b.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "https://cdn.example.com/assets/css/app.3f2a9c.css https://cdn.example.com/assets/js/app.js <https://cdn.example.com/assets/img/a&amp;b.png>"
+	if out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if _, err := s.FromString(`{% static "a.css" as %}`); err == nil {
+		t.Error("expected an error for a missing variable name")
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	s := pongo2.NewSet("csrf", pongo2.NewMemoryLoader(nil))
+	tpl, err := s.FromString(`<form>{% csrf_token %}</form>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tpl.Execute(nil); err == nil {
+		t.Error("expected an error without a CSRFTokenFunc")
+	}
+
+	s.CSRFTokenFunc = func(ctx pongo2.Context) string {
+		session, _ := ctx["session"].(string)
+		return "token-of-" + session
+	}
+	out, err := tpl.Execute(pongo2.Context{"session": "<abc>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<form><input type="hidden" name="csrfmiddlewaretoken" value="token-of-&lt;abc&gt;"></form>`
+	if out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	s.CSRFFieldName = "_csrf"
+	s.CSRFTokenFunc = func(ctx pongo2.Context) string { return "" }
+	out, err = tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<form></form>" {
+		t.Errorf("expected no field for an empty token, got '%s'", out)
+	}
+
+	if _, err := s.FromString(`{% csrf_token "x" %}`); err == nil {
+		t.Error("expected an error for csrf_token arguments")
+	}
+}
+
+func TestNonceTags(t *testing.T) {
+	s := pongo2.NewSet("nonce", pongo2.NewMemoryLoader(nil))
+	s.ContextualAutoescape = true
+	tpl, err := s.FromString(`<script nonce="{% nonce %}" src="/app.js"></script>` +
+		`{% nonce_script %}var s = "{{ s }}";{% endnonce_script %}` +
+		`{% nonce_style %}p { color: {{ color }} }{% endnonce_style %}<p>{{ s }}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := pongo2.Context{"request": "<r1>", "s": `"x"`, "color": "red;"}
+	if _, err := tpl.Execute(ctx); err == nil {
+		t.Error("expected an error without a NonceFunc")
+	}
+
+	s.NonceFunc = func(ctx pongo2.Context) string {
+		request, _ := ctx["request"].(string)
+		return "nonce-of-" + request
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<script nonce="nonce-of-&lt;r1&gt;" src="/app.js"></script>` +
+		`<script nonce="nonce-of-&lt;r1&gt;">var s = "\u0022x\u0022";</script>` +
+		`<style nonce="nonce-of-&lt;r1&gt;">p { color: red\3B  }</style><p>&quot;x&quot;</p>`
+	if out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	s.NonceFunc = func(ctx pongo2.Context) string { return "" }
+	tpl, err = s.FromString(`{% nonce_script %}go();{% endnonce_script %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<script>go();</script>" {
+		t.Errorf("expected no nonce attribute for an empty nonce, got '%s'", out)
+	}
+
+	for _, src := range []string{
+		`{% nonce "x" %}`,
+		`{% nonce_style media %}{% endnonce_style %}`,
+		`{% nonce_style %}{% endnonce_style media %}`,
+		`{% nonce_script %}`,
+	} {
+		if _, err := s.FromString(src); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+}
+
+func TestCacheTag(t *testing.T) {
+	s := pongo2.NewSet("fragment cache", pongo2.NewMemoryLoader(nil))
+	backend := pongo2.NewMemoryCacheBackend()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	backend.Now = func() time.Time { return now }
+	s.FragmentCache = backend
+
+	tpl, err := s.FromString(`{% cache 300 sidebar user %}{{ user }}:{{ counter }}{% endcache %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(user string, counter int) string {
+		out, err := tpl.Execute(pongo2.Context{"user": user, "counter": counter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if out := render("john", 1); out != "john:1" {
+		t.Errorf("first render: got '%s'", out)
+	}
+	if out := render("john", 2); out != "john:1" {
+		t.Errorf("expected the cached fragment, got '%s'", out)
+	}
+	if out := render("jane", 3); out != "jane:3" {
+		t.Errorf("expected a fragment per vary-on value, got '%s'", out)
+	}
+	now = now.Add(301 * time.Second)
+	if out := render("john", 4); out != "john:4" {
+		t.Errorf("expected the fragment to expire, got '%s'", out)
+	}
+
+	s.FragmentCache = nil
+	if out := render("john", 5); out != "john:5" {
+		t.Errorf("expected no caching without a backend, got '%s'", out)
+	}
+
+	if _, err := s.FromString(`{% cache 300 %}x{% endcache %}`); err == nil {
+		t.Error("expected an error for a missing fragment name")
+	}
+
+	// The least recently used fragments are evicted
+	backend.MaxEntries = 2
+	s.FragmentCache = backend
+	render("john", 6)
+	render("jane", 7)
+	render("joe", 8)
+	if backend.Len() != 2 {
+		t.Errorf("expected 2 cached fragments, got %d", backend.Len())
+	}
+	if out := render("john", 9); out != "john:9" {
+		t.Errorf("expected the fragment to be evicted, got '%s'", out)
+	}
+	if out := render("joe", 10); out != "joe:8" {
+		t.Errorf("expected the cached fragment, got '%s'", out)
+	}
+}
+
+func TestDynamicExtends(t *testing.T) {
+	s := pongo2.NewSet("dynamic extends", pongo2.NewMemoryLoader(map[string]string{
+		"base.html":  "<html>{% block body %}{% endblock %}</html>",
+		"full.html":  `{% extends "base.html" %}{% block body %}<nav/>{% block content %}full{% endblock %}{% endblock %}`,
+		"modal.html": `<div class="modal">{% block content %}modal{% endblock %}</div>`,
+		"page.html":  `{% extends layout %}{% block content %}{{ text }}{% endblock %}`,
+		"sub.html":   `{% extends "page.html" %}{% block content %}sub {{ block_content }}{% endblock %}`,
+	}))
+
+	tests := []struct {
+		name     string
+		layout   string
+		expected string
+	}{
+		{"page.html", "full.html", "<html><nav/>page</html>"},
+		{"page.html", "modal.html", `<div class="modal">page</div>`},
+		{"sub.html", "modal.html", `<div class="modal">sub </div>`},
+	}
+	for _, test := range tests {
+		tpl, err := s.FromCache(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(pongo2.Context{"layout": test.layout, "text": "page"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.expected {
+			t.Errorf("%s with layout %s: got '%s', expected '%s'", test.name, test.layout, out, test.expected)
+		}
+	}
+
+	tpl, err := s.FromCache("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(pongo2.Context{"layout": ""}); err == nil {
+		t.Error("expected an error for an empty layout name")
+	}
+	if _, err := tpl.Execute(pongo2.Context{"layout": "missing.html"}); err == nil {
+		t.Error("expected an error for a missing layout")
+	}
+}
+
+func TestCyclePerExecution(t *testing.T) {
+	tpl, err := pongo2.FromString(`{% for i in items %}{% cycle "odd" "even" %} {% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		out, err := tpl.Execute(pongo2.Context{"items": []int{1, 2, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "odd even odd "; out != expected {
+			t.Errorf("execution %d: got '%s', expected '%s'", i+1, out, expected)
+		}
+	}
+}
+
+func TestCycleSingleArgumentEvaluatedOnce(t *testing.T) {
+	calls := 0
+	ctx := pongo2.Context{"next": func() string {
+		calls++
+		return "x"
+	}}
+	tpl, err := pongo2.FromString(`{% cycle next() %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "x" || calls != 1 {
+		t.Errorf("got '%s' after %d calls, expected 'x' after 1 call", out, calls)
+	}
+}
+
+func TestDebugTag(t *testing.T) {
+	s := pongo2.NewSet("debug tag", pongo2.NewMemoryLoader(nil))
+	s.Globals["site"] = "example.com"
+	tpl, err := s.FromString(`{% block main %}{% for i in items %}{% if forloop.Last %}{% debug %}{% endif %}{% endfor %}{% endblock %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := tpl.Execute(pongo2.Context{"items": []int{1, 2}, "name": "<john>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("expected no output without Debug, got '%s'", out)
+	}
+
+	s.Debug = true
+	out, err = tpl.Execute(pongo2.Context{"items": []int{1, 2}, "name": "<john>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<pre class="pongo2-debug">`,
+		"Block: main\n",
+		"Loop 0: Counter=2 Revcounter=1 First=false Last=true\n",
+		"  i (int) = 2\n",
+		"  name (string) = &lt;john&gt;\n",
+		"Globals:\n  site (string) = example.com\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected '%s' in the dump:\n%s", expected, out)
+		}
+	}
+}
+
+type setTagNode struct {
+	output string
+}
+
+func (node *setTagNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	writer.WriteString(node.output)
+	return nil
+}
+
+func setTagParser(output string) pongo2.TagParser {
+	return func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		return &setTagNode{output: output}, nil
+	}
+}
+
+func TestSetRegisterTag(t *testing.T) {
+	web := pongo2.NewSet("web tags", pongo2.NewMemoryLoader(nil))
+	mail := pongo2.NewSet("mail tags", pongo2.NewMemoryLoader(nil))
+	other := pongo2.NewSet("other tags", pongo2.NewMemoryLoader(nil))
+
+	if err := web.RegisterTag("card", setTagParser("<div>web</div>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mail.RegisterTag("card", setTagParser("[mail]")); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.RegisterTag("card", setTagParser("again")); err == nil {
+		t.Error("expected an error registering a tag twice for a set")
+	}
+	if err := web.RegisterTag("if", setTagParser("if")); err == nil {
+		t.Error("expected an error registering a tag shadowing a global one")
+	}
+
+	if out := web.RenderTemplateString(`{% card %}`, nil); out != "<div>web</div>" {
+		t.Errorf("out ('%s') != '<div>web</div>'", out)
+	}
+	if out := mail.RenderTemplateString(`{% card %}`, nil); out != "[mail]" {
+		t.Errorf("out ('%s') != '[mail]'", out)
+	}
+	if _, err := other.FromString(`{% card %}`); err == nil {
+		t.Error("expected an error using a tag registered for another set")
+	}
+	if err := mail.RegisterTag("late", setTagParser("")); err == nil {
+		t.Error("expected an error registering a tag after the first template")
+	}
+
+	sandbox := pongo2.NewSet("sandboxed set tags", pongo2.NewMemoryLoader(nil))
+	if err := sandbox.RegisterTag("card", setTagParser("")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sandbox.BanTag("card"); err != nil {
+		t.Fatalf("set tags should be bannable: %v", err)
+	}
+	if _, err := sandbox.FromString(`{% card %}`); err == nil {
+		t.Error("expected the banned set tag to be rejected")
+	}
+}
+
+func TestSetReplaceTag(t *testing.T) {
+	s := pongo2.NewSet("replaced tags", pongo2.NewMemoryLoader(nil))
+	if err := s.ReplaceTag("unknown_tag", setTagParser("")); err == nil {
+		t.Error("expected an error replacing an unknown tag")
+	}
+	if err := s.ReplaceTag("now", setTagParser("frozen")); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := s.RenderTemplateString(`{% now "Y" %}`, nil); out != "frozen" {
+		t.Errorf("out ('%s') != 'frozen'", out)
+	}
+	if out := pongo2.RenderTemplateString(`{% now "Y" %}`, nil); out == "frozen" {
+		t.Error("replacing a tag of a set must not affect other sets")
+	}
+	if err := s.ReplaceTag("now", setTagParser("")); err == nil {
+		t.Error("expected an error replacing a tag after the first template")
+	}
+}
+
+type panelTagNode struct {
+	args *pongo2.TagArguments
+	body *pongo2.NodeWrapper
+}
+
+func (node *panelTagNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	args, kwargs, err := node.args.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := node.body.Execute(ctx, &b); err != nil {
+		return err
+	}
+	out := fmt.Sprintf("<div class=\"%s\">%s: %s</div>", kwargs["class"], args[0], b.String())
+	if node.args.AsName != "" {
+		ctx.Private[node.args.AsName] = out
+		return nil
+	}
+	writer.WriteString(out)
+	return nil
+}
+
+func panelTagParser(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+	args, err := arguments.ParseTagArguments()
+	if err != nil {
+		return nil, err
+	}
+	if len(args.Args) != 1 {
+		return nil, arguments.Error("Tag 'panel' requires a title.", start)
+	}
+	body, err := doc.WrapUntilEndTag("panel")
+	if err != nil {
+		return nil, err
+	}
+	return &panelTagNode{args: args, body: body}, nil
+}
+
+func TestParseTagArguments(t *testing.T) {
+	s := pongo2.NewSet("tag arguments", pongo2.NewMemoryLoader(nil))
+	if err := s.RegisterTag("panel", panelTagParser); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tpl, expected string
+	}{
+		{`{% panel "Hi" class="box" %}{{ name }}{% endpanel %}`, `<div class="box">Hi: john</div>`},
+		{`{% panel name|upper class="a"|upper as p %}x{% endpanel %}[{{ p|safe }}]`, `[<div class="A">JOHN: x</div>]`},
+	}
+	for _, test := range tests {
+		tpl, err := s.FromString(test.tpl)
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		out, err := tpl.Execute(pongo2.Context{"name": "john"})
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		if out != test.expected {
+			t.Errorf("%s: out ('%s') != '%s'", test.tpl, out, test.expected)
+		}
+	}
+
+	invalid := []string{
+		`{% panel class="a" "title" %}{% endpanel %}`,
+		`{% panel "a" class=1 class=2 %}{% endpanel %}`,
+		`{% panel "a" as %}{% endpanel %}`,
+		`{% panel "a" as p class=1 %}{% endpanel %}`,
+		`{% panel "a" %}{% endpanel "a" %}`,
+		`{% panel "a" %}`,
+	}
+	for _, tpl := range invalid {
+		if _, err := s.FromString(tpl); err == nil {
+			t.Errorf("%s: expected a compilation error", tpl)
+		}
+	}
+}
+
+func TestRegisterSimpleTag(t *testing.T) {
+	s := pongo2.NewSet("simple tags", pongo2.NewMemoryLoader(nil))
+	err := s.RegisterSimpleTag("greet", func(ctx *pongo2.ExecutionContext, args ...*pongo2.Value) (string, error) {
+		if len(args) == 0 {
+			return "", errors.New("missing name")
+		}
+		parts := make([]string, 0, len(args))
+		for _, arg := range args {
+			parts = append(parts, arg.String())
+		}
+		return "Hello " + strings.Join(parts, " & "), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tpl, expected string
+	}{
+		{`{% greet name %}`, `Hello &lt;john&gt;`},
+		{`{% greet name "jane"|upper 3 %}`, `Hello &lt;john&gt; &amp; JANE &amp; 3`},
+		{`{% autoescape off %}{% greet name %}{% endautoescape %}`, `Hello <john>`},
+		{`{% greet "x" as g %}[{{ g|length }}]`, `[7]`},
+	}
+	for _, test := range tests {
+		tpl, err := s.FromString(test.tpl)
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		out, err := tpl.Execute(pongo2.Context{"name": "<john>"})
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		if out != test.expected {
+			t.Errorf("%s: out ('%s') != '%s'", test.tpl, out, test.expected)
+		}
+	}
+
+	tpl, err := s.FromString(`{% greet %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(nil); err == nil || !strings.Contains(err.Error(), "missing name") {
+		t.Errorf("expected the tag's error, got %v", err)
+	}
+	if _, err := s.FromString(`{% greet name=1 %}`); err == nil {
+		t.Error("expected an error for keyword arguments")
+	}
+}
+
+func TestTimesinceFilters(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := pongo2.NewSet("fixed clock", pongo2.NewMemoryLoader(nil))
+	s.NowFunc = func() time.Time { return now }
+
+	tests := []struct {
+		filter   string
+		in       time.Time
+		expected string
+	}{
+		{"timesince", now.Add(-3*24*time.Hour - 4*time.Hour - 5*time.Minute), "3 days, 4 hours"},
+		{"timesince", now.Add(-25 * time.Hour), "1 day, 1 hour"},
+		{"timesince", now.Add(-14 * 24 * time.Hour), "2 weeks"},
+		{"timesince", now.Add(-400 * 24 * time.Hour), "1 year, 1 month"},
+		{"timesince", now.Add(-30 * time.Second), "0 minutes"},
+		{"timesince", now.Add(time.Hour), "0 minutes"},
+		{"timeuntil", now.Add(90 * time.Minute), "1 hour, 30 minutes"},
+		{"timeuntil", now.Add(-time.Hour), "0 minutes"},
+	}
+	for _, test := range tests {
+		out := s.RenderTemplateString(fmt.Sprintf("{{ value|%s }}", test.filter), pongo2.Context{"value": test.in})
+		if out != test.expected {
+			t.Errorf("%s(%v): out ('%s') != '%s'", test.filter, test.in, out, test.expected)
+		}
+	}
+}
+
+func TestNaturalFilters(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := pongo2.NewSet("fixed clock", pongo2.NewMemoryLoader(nil))
+	s.NowFunc = func() time.Time { return now }
+
+	tests := []struct {
+		filter   string
+		in       time.Time
+		param    interface{}
+		expected string
+	}{
+		{"naturaltime", now, nil, "now"},
+		{"naturaltime", now.Add(-time.Second), nil, "a second ago"},
+		{"naturaltime", now.Add(-30 * time.Second), nil, "30 seconds ago"},
+		{"naturaltime", now.Add(-2 * time.Minute), nil, "2 minutes ago"},
+		{"naturaltime", now.Add(-time.Hour), nil, "an hour ago"},
+		{"naturaltime", now.Add(-51 * time.Hour), nil, "2 days, 3 hours ago"},
+		{"naturaltime", now.Add(time.Minute), nil, "a minute from now"},
+		{"naturaltime", now.Add(5 * time.Hour), nil, "5 hours from now"},
+		{"naturaltime", now.Add(8 * 24 * time.Hour), nil, "1 week, 1 day from now"},
+		{"naturalday", now.Add(-11 * time.Hour), nil, "today"},
+		{"naturalday", now.Add(13 * time.Hour), nil, "tomorrow"},
+		{"naturalday", now.Add(-13 * time.Hour), nil, "yesterday"},
+		{"naturalday", now.Add(-48 * time.Hour), nil, "April 29, 2020"},
+		{"naturalday", now.Add(48 * time.Hour), "2006-01-02", "2020-05-03"},
+		{"naturalday", now.In(time.FixedZone("UTC+13", 13*60*60)), nil, "today"},
+	}
+	for _, test := range tests {
+		src := fmt.Sprintf("{{ value|%s }}", test.filter)
+		if test.param != nil {
+			src = fmt.Sprintf("{{ value|%s:param }}", test.filter)
+		}
+		out := s.RenderTemplateString(src, pongo2.Context{"value": test.in, "param": test.param})
+		if out != test.expected {
+			t.Errorf("%s(%v): out ('%s') != '%s'", test.filter, test.in, out, test.expected)
+		}
+	}
+}
+
+func TestHumanizeSeparators(t *testing.T) {
+	s := pongo2.NewSet("german separators", pongo2.NewMemoryLoader(nil))
+	s.SetNumberSeparators(".", ",")
+
+	const src = `{{ 1234567.5|intcomma }} {{ 1234567|intcomma:" " }} {{ 1200000|intword }}`
+	if out, expected := s.RenderTemplateString(src, nil), "1.234.567,5 1 234 567 1,2 million"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	// Other sets keep the default separators
+	if out, expected := pongo2.RenderTemplateString(src, nil), "1,234,567.5 1 234 567 1.2 million"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+}
+
+func TestTojsonFilter(t *testing.T) {
+	tpl, err := pongo2.FromString(`<script>var data = {{ data|tojson:2 }};</script>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"data": map[string]interface{}{
+		"name": "</script><script>alert(1)</script>",
+		"tags": []string{"a", "b"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<script>var data = {\n  \"name\": \"\\u003c/script\\u003e\\u003cscript\\u003ealert(1)\\u003c/script\\u003e\",\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n};</script>"
+	if out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if _, err := tpl.Execute(pongo2.Context{"data": make(chan int)}); err == nil {
+		t.Error("expected an error for values which can't be marshalled")
+	}
+}
+
+func TestMarkdownFilter(t *testing.T) {
+	s := pongo2.NewSet("markdown", pongo2.NewMemoryLoader(nil))
+	tpl, err := s.FromString(`{{ text|markdown }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{"text": "*hi* <b>"}
+
+	if _, err := tpl.Execute(ctx); err == nil {
+		t.Error("expected an error without a markdown renderer")
+	}
+
+	renderer := func(source string) (string, error) {
+		if source == "" {
+			return "", errors.New("empty input")
+		}
+		return "<p>" + strings.Replace(source, "*hi*", "<em>hi</em>", 1) + "</p>", nil
+	}
+	s.SetMarkdownRenderer(renderer, false)
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "&lt;p&gt;&lt;em&gt;hi&lt;/em&gt; &lt;b&gt;&lt;/p&gt;"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	s.SetMarkdownRenderer(renderer, true)
+	out, err = tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<p><em>hi</em> <b></p>"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if _, err := tpl.Execute(pongo2.Context{"text": ""}); err == nil || !strings.Contains(err.Error(), "empty input") {
+		t.Errorf("expected the renderer's error, got %v", err)
+	}
+
+	if _, err := s.FromString(`{{ text|markdown:"gfm" }}`); err == nil {
+		t.Error("expected an error for a markdown parameter")
+	}
+
+	// Sets without a renderer use the global filter
+	pongo2.ReplaceFilter("markdown", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("<p>" + in.String() + "</p>"), nil
+	})
+	defer pongo2.ReplaceFilterWithArgs("markdown", pongo2.FilterSignature{},
+		func(in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			return nil, &pongo2.Error{Sender: "filter:markdown", ErrorMsg: "No markdown renderer set."}
+		})
+	s = pongo2.NewSet("global markdown", pongo2.NewMemoryLoader(nil))
+	if out := s.RenderTemplateString(`{{ "hi"|markdown }}`, nil); out != "<p>hi</p>" {
+		t.Errorf("out ('%s') != '<p>hi</p>'", out)
+	}
+}
+
+type tagStripper struct{}
+
+func (tagStripper) Sanitize(html string) string {
+	return strings.Replace(strings.Replace(html, "<script>", "", -1), "</script>", "", -1)
+}
+
+func TestSanitizeFilter(t *testing.T) {
+	s := pongo2.NewSet("sanitize", pongo2.NewMemoryLoader(nil))
+	tpl, err := s.FromString(`{{ text|sanitize }}|{{ text }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{"text": "<b>hi</b><script>x</script>"}
+
+	if _, err := tpl.Execute(ctx); err == nil {
+		t.Error("expected an error without a sanitizer")
+	}
+
+	s.SetSanitizer(tagStripper{})
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<b>hi</b>x|&lt;b&gt;hi&lt;/b&gt;&lt;script&gt;x&lt;/script&gt;"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	// Sets without a sanitizer use the global filter
+	pongo2.ReplaceFilter("sanitize", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(tagStripper{}.Sanitize(in.String())), nil
+	})
+	defer pongo2.ReplaceFilter("sanitize", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return nil, &pongo2.Error{Sender: "filter:sanitize", ErrorMsg: "No sanitizer set."}
+	})
+	s = pongo2.NewSet("global sanitizer", pongo2.NewMemoryLoader(nil))
+	if out := s.RenderTemplateString(`{{ "<script>x</script>"|sanitize }}`, nil); out != "x" {
+		t.Errorf("out ('%s') != 'x'", out)
+	}
+}
+
+func TestSlugTransliterator(t *testing.T) {
+	cyrillic := map[rune]string{'п': "p", 'р': "r", 'и': "i", 'в': "v", 'е': "e", 'т': "t"}
+	s := pongo2.NewSet("slug transliterator", pongo2.NewMemoryLoader(nil))
+	s.SetSlugTransliterator(func(r rune) (string, bool) {
+		s, ok := cyrillic[r]
+		return s, ok
+	})
+
+	out := s.RenderTemplateString(`{{ "Привет, Zürich"|slugify }}`, nil)
+	if expected := "privet-zuerich"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+	out = pongo2.RenderTemplateString(`{{ "Привет, Zürich"|slugify }}`, nil)
+	if expected := "привет-zuerich"; out != expected {
+		t.Errorf("out ('%s') != '%s' (transliterator of another set)", out, expected)
+	}
+}
+
+func TestUnorderedListFilter(t *testing.T) {
+	states := []interface{}{"States", []interface{}{"Kansas", []string{"Lawrence", "Topeka"}, "<Illinois>"}}
+	out := pongo2.RenderTemplateString(`<ul>{{ states|unordered_list }}</ul>`, pongo2.Context{"states": states})
+	expected := "<ul>\t<li>States\n\t<ul>\n\t\t<li>Kansas\n\t\t<ul>\n\t\t\t<li>Lawrence</li>\n\t\t\t<li>Topeka</li>\n\t\t</ul>\n\t\t</li>\n\t\t<li>&lt;Illinois&gt;</li>\n\t</ul>\n\t</li></ul>"
+	if out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if _, err := pongo2.ApplyFilter("unordered_list", pongo2.AsValue("abc"), nil); err == nil {
+		t.Error("expected an error for a non-list input")
+	}
+}
+
+func TestUrlizeRel(t *testing.T) {
+	s := pongo2.NewSet("urlize rel", pongo2.NewMemoryLoader(nil))
+	s.SetUrlizeRel("nofollow noopener")
+	out := s.RenderTemplateString(`{{ "see www.example.com"|urlize|safe }}`, nil)
+	if expected := `see <a href="http://www.example.com" rel="nofollow noopener">www.example.com</a>`; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	s.SetUrlizeRel("")
+	out = s.RenderTemplateString(`{{ "see www.example.com"|urlizetrunc:10|safe }}`, nil)
+	if expected := `see <a href="http://www.example.com">www.exa...</a>`; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	out = pongo2.RenderTemplateString(`{{ "see www.example.com"|urlize|safe }}`, nil)
+	if expected := `see <a href="http://www.example.com" rel="nofollow">www.example.com</a>`; out != expected {
+		t.Errorf("out ('%s') != '%s' (rel of another set)", out, expected)
+	}
+}
+
+func TestMoneyFormatter(t *testing.T) {
+	s := pongo2.NewSet("money formatter", pongo2.NewMemoryLoader(nil))
+	s.SetMoneyFormatter(func(amount float64, currency string, locale string) (string, error) {
+		return fmt.Sprintf("%s|%.3f|%s", locale, amount, currency), nil
+	})
+
+	out := s.RenderTemplateString(`{{ price|money("eur", locale="de_DE") }}`, pongo2.Context{"price": 12.5})
+	if expected := "de-DE|12.500|EUR"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+	out = pongo2.RenderTemplateString(`{{ price|money("eur", locale="de_DE") }}`, pongo2.Context{"price": 12.5})
+	if expected := "12,50 €"; out != expected {
+		t.Errorf("out ('%s') != '%s' (formatter of another set)", out, expected)
+	}
+}
+
+func TestAggregationFilters(t *testing.T) {
+	type item struct {
+		Name  string
+		Price float64
+		Stock int
+	}
+	items := []item{{"a", 2.5, 3}, {"b", 10, 0}, {"c", 0.25, 7}}
+
+	out := pongo2.RenderTemplateString(`{{ items|sum:"Price" }} {{ items|sum(attribute="Stock") }} {{ items|min:"Price" }} {{ items|max(attribute="Stock") }} {{ items|avg:"Stock" }}`,
+		pongo2.Context{"items": items})
+	if expected := "12.750000 10 0.250000 7 3.333333"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+}
+
+func TestNullAwareDefaultFilters(t *testing.T) {
+	var nilPtr *int
+	var nilIface interface{}
+	var nilSlice []string
+	ctx := pongo2.Context{
+		"nil_ptr":   nilPtr,
+		"nil_iface": nilIface,
+		"nil_slice": nilSlice,
+		"empty":     "",
+		"zero":      0,
+		"no":        false,
+		"list":      []string{},
+	}
+	tests := []struct {
+		tpl, expected string
+	}{
+		{`{{ missing|default_if_none:"x" }}|{{ nil_ptr|default_if_none:"x" }}|{{ nil_iface|default_if_none:"x" }}|{{ nil_slice|default_if_none:"x" }}`, "x|x|x|x"},
+		{`{{ empty|default_if_none:"x" }}|{{ zero|default_if_none:"x" }}|{{ no|default_if_none:"x" }}`, "|0|False"},
+		{`{{ missing|coalesce:"x" }}|{{ nil_ptr|coalesce:"x" }}|{{ empty|coalesce:"x" }}`, "x|x|x"},
+		{`{{ zero|coalesce:"x" }}|{{ no|coalesce:"x" }}|{{ list|coalesce:"x"|length }}`, "0|False|0"},
+		{`{{ empty|default:"x" }}|{{ zero|default:"x" }}|{{ no|default:"x" }}|{{ list|default:"x" }}`, "x|x|x|x"},
+	}
+	for _, test := range tests {
+		tpl, err := pongo2.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.expected {
+			t.Errorf("%s: out ('%s') != '%s'", test.tpl, out, test.expected)
+		}
+	}
+}
+
+func TestFilterKeywordArguments(t *testing.T) {
+	pongo2.RegisterFilterWithArgs("test_pad", pongo2.FilterSignature{MinArgs: 1, MaxArgs: 1, Kwargs: []string{"char", "left"}},
+		func(in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			char := "."
+			if c, has := kwargs["char"]; has {
+				char = c.String()
+			}
+			padding := ""
+			if n := args[0].Integer() - in.Len(); n > 0 {
+				padding = strings.Repeat(char, n)
+			}
+			if left, has := kwargs["left"]; has && left.IsTrue() {
+				return pongo2.AsValue(padding + in.String()), nil
+			}
+			return pongo2.AsValue(in.String() + padding), nil
+		})
+
+	tpl, err := pongo2.FromString(`{{ name|test_pad(6) }}|{{ name|test_pad(width, char="-", left=true)|upper }}|{{ name|test_pad(2 + 3, left=false) }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"name": "abc", "width": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "abc...|--ABC|abc.."; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if _, err := pongo2.FromString(`{{ name|test_pad }}`); err == nil || !strings.Contains(err.Error(), "requires at least 1 argument(s)") {
+		t.Errorf("expected an arity error, got %v", err)
+	}
+
+	v, filterErr := pongo2.ApplyFilterWithArgs("test_pad", pongo2.AsValue("x"), []*pongo2.Value{pongo2.AsValue(3)},
+		map[string]*pongo2.Value{"char": pongo2.AsValue("*")})
+	if filterErr != nil {
+		t.Fatal(filterErr)
+	}
+	if v.String() != "x**" {
+		t.Errorf("ApplyFilterWithArgs returned '%s', expected 'x**'", v.String())
+	}
+	if _, filterErr := pongo2.ApplyFilterWithArgs("test_pad", pongo2.AsValue("x"), nil, nil); filterErr == nil {
+		t.Error("expected ApplyFilterWithArgs to check the signature")
+	}
+}
+
+func TestSetRegisterFilter(t *testing.T) {
+	web := pongo2.NewSet("web filters", pongo2.NewMemoryLoader(nil))
+	mail := pongo2.NewSet("mail filters", pongo2.NewMemoryLoader(nil))
+	other := pongo2.NewSet("other filters", pongo2.NewMemoryLoader(nil))
+
+	constFilter := func(out string) pongo2.FilterFunction {
+		return func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			return pongo2.AsValue(out + in.String() + param.String()), nil
+		}
+	}
+	if err := web.RegisterFilter("brand", constFilter("web:")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mail.RegisterFilter("brand", constFilter("mail:")); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.RegisterFilter("brand", constFilter("again")); err == nil {
+		t.Error("expected an error registering a filter twice for a set")
+	}
+	if err := web.RegisterFilter("upper", constFilter("upper")); err == nil {
+		t.Error("expected an error registering a filter shadowing a global one")
+	}
+	if err := web.RegisterFilterWithArgs("wrap", pongo2.FilterSignature{MinArgs: 2, MaxArgs: 2},
+		func(in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			return pongo2.AsValue(args[0].String() + in.String() + args[1].String()), nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := web.RenderTemplateString(`{{ "x"|brand:"!" }} {{ "x"|wrap:"[","]" }}`, nil); out != "web:x! [x]" {
+		t.Errorf("out ('%s') != 'web:x! [x]'", out)
+	}
+	if out := mail.RenderTemplateString(`{{ "x"|brand }}`, nil); out != "mail:x" {
+		t.Errorf("out ('%s') != 'mail:x'", out)
+	}
+	if _, err := other.FromString(`{{ "x"|brand }}`); err == nil {
+		t.Error("expected an error using a filter registered for another set")
+	}
+	if _, err := pongo2.ApplyFilter("brand", pongo2.AsValue("x"), nil); err == nil {
+		t.Error("expected set filters not to be registered globally")
+	}
+	if err := mail.RegisterFilter("late", constFilter("")); err == nil {
+		t.Error("expected an error registering a filter after the first template")
+	}
+
+	sandbox := pongo2.NewSet("sandboxed set filters", pongo2.NewMemoryLoader(nil))
+	if err := sandbox.RegisterFilter("brand", constFilter("")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sandbox.BanFilter("brand"); err != nil {
+		t.Fatalf("set filters should be bannable: %v", err)
+	}
+	if _, err := sandbox.FromString(`{{ "x"|brand }}`); err == nil {
+		t.Error("expected the banned set filter to be rejected")
+	}
+}
+
+func TestReplaceAndAliasFilter(t *testing.T) {
+	pongo2.AliasFilter("test_strftime", "date")
+	if out := pongo2.RenderTemplateString(`{{ t|test_strftime(format="django:Y-m-d") }}`, pongo2.Context{"t": time2}); out != "2011-03-21" {
+		t.Errorf("out ('%s') != '2011-03-21'", out)
+	}
+
+	pongo2.RegisterFilter("test_greet", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue("hello " + in.String()), nil
+	})
+	pongo2.ReplaceFilterWithArgs("test_greet", pongo2.FilterSignature{MaxArgs: 1},
+		func(in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			greeting := "hi"
+			if len(args) > 0 {
+				greeting = args[0].String()
+			}
+			return pongo2.AsValue(greeting + " " + in.String()), nil
+		})
+	if out := pongo2.RenderTemplateString(`{{ "you"|test_greet }} {{ "you"|test_greet:"hey" }}`, nil); out != "hi you hey you" {
+		t.Errorf("out ('%s') != 'hi you hey you'", out)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected AliasFilter to panic for an existing alias")
+			}
+		}()
+		pongo2.AliasFilter("upper", "lower")
+	}()
+
+	web := pongo2.NewSet("web replaced filters", pongo2.NewMemoryLoader(nil))
+	other := pongo2.NewSet("other replaced filters", pongo2.NewMemoryLoader(nil))
+	if err := web.ReplaceFilter("upper", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue("UP:" + in.String()), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.AliasFilter("shout", "upper"); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.AliasFilter("lower", "upper"); err == nil {
+		t.Error("expected an error aliasing to an existing filter name")
+	}
+	if err := web.AliasFilter("whisper", "non_existent_filter"); err == nil {
+		t.Error("expected an error aliasing a non-existent filter")
+	}
+	if err := web.ReplaceFilter("non_existent_filter", nil); err == nil {
+		t.Error("expected an error replacing a non-existent filter")
+	}
+	if err := web.ReplaceFilterWithArgs("date", pongo2.FilterSignature{MaxArgs: 1, Kwargs: []string{"tz"}},
+		func(in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			return pongo2.AsValue("custom date"), nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := web.RenderTemplateString(`{{ "a"|upper }} {{ "b"|shout }} {{ t|date(tz="UTC") }}`, pongo2.Context{"t": time2}); out != "UP:a UP:b custom date" {
+		t.Errorf("out ('%s') != 'UP:a UP:b custom date'", out)
+	}
+	if out := other.RenderTemplateString(`{{ "a"|upper }}`, nil); out != "A" {
+		t.Errorf("out ('%s') != 'A'", out)
+	}
+	if err := web.ReplaceFilter("lower", nil); err == nil {
+		t.Error("expected an error replacing a filter after the first template")
+	}
+}
+
+func TestContextFilter(t *testing.T) {
+	pongo2.RegisterContextFilter("test_trans", pongo2.FilterSignature{Kwargs: []string{"default"}},
+		func(ctx *pongo2.ExecutionContext, in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			if ctx == nil {
+				return pongo2.AsValue(in.String()), nil
+			}
+			if locale, _ := ctx.Lookup("locale"); locale == "de" && in.String() == "hello" {
+				return pongo2.AsValue("hallo"), nil
+			}
+			if def, has := kwargs["default"]; has {
+				return def, nil
+			}
+			return in, nil
+		})
+
+	tpl, err := pongo2.FromString(`{{ "hello"|test_trans|upper }} {{ "bye"|test_trans(default="-") }}{% with locale="en" %} {{ "hello"|test_trans }}{% endwith %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"locale": "de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "HALLO - hello"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	v, filterErr := pongo2.ApplyFilter("test_trans", pongo2.AsValue("hello"), nil)
+	if filterErr != nil {
+		t.Fatal(filterErr)
+	}
+	if v.String() != "hello" {
+		t.Errorf("ApplyFilter returned '%s', expected 'hello'", v.String())
+	}
+
+	s := pongo2.NewSet("context filters", pongo2.NewMemoryLoader(nil))
+	if err := s.RegisterContextFilter("escaped", pongo2.FilterSignature{},
+		func(ctx *pongo2.ExecutionContext, in *pongo2.Value, args []*pongo2.Value, kwargs map[string]*pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			if ctx.Autoescape {
+				return pongo2.AsValue("on"), nil
+			}
+			return pongo2.AsValue("off"), nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if out := s.RenderTemplateString(`{{ 1|escaped }} {% autoescape off %}{{ 1|escaped }}{% endautoescape %}`, nil); out != "on off" {
+		t.Errorf("out ('%s') != 'on off'", out)
+	}
+}
+
+func TestFilterErrorDetails(t *testing.T) {
+	s := pongo2.NewSet("filter errors", pongo2.NewMemoryLoader(map[string]string{
+		"page.html":    "<h1>{{ title }}</h1>\n{% include \"partial.html\" %}",
+		"partial.html": "<ul>\n  <li>{{ prices|sum:\"Amount\" }}</li>\n</ul>",
+	}))
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	err = tpl.ExecuteWriter(pongo2.Context{"prices": []map[string]interface{}{{"Amount": "free"}}}, &b)
+	e, ok := err.(*pongo2.Error)
+	if !ok {
+		t.Fatalf("expected a *pongo2.Error, got %T (%v)", err, err)
+	}
+	if e.Filename != "partial.html" || e.Line != 2 || e.Column != 17 {
+		t.Errorf("wrong position: %s line %d column %d", e.Filename, e.Line, e.Column)
+	}
+	if e.Filter != "sum" || e.Sender != "filter:sum" || e.InputType != "[]map[string]interface {}" {
+		t.Errorf("wrong filter details: filter '%s', sender '%s', input type '%s'", e.Filter, e.Sender, e.InputType)
+	}
+	if expected := "(where: filter:sum, input type: []map[string]interface {}) in partial.html | Line 2 Col 17 near 'sum']"; !strings.Contains(e.Error(), expected) {
+		t.Errorf("error '%s' doesn't contain '%s'", e.Error(), expected)
+	}
+
+	// Filters not setting the sender get it set
+	pongo2.RegisterFilter("test_fail", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return nil, &pongo2.Error{ErrorMsg: "Always fails."}
+	})
+	_, filterErr := pongo2.ApplyFilter("test_fail", pongo2.AsValue(nil), nil)
+	if filterErr == nil || filterErr.Sender != "filter:test_fail" || filterErr.InputType != "nil" {
+		t.Errorf("wrong details of ApplyFilter's error: %#v", filterErr)
+	}
+}
+
+type testCursor struct {
+	items    []interface{}
+	consumed int
+}
+
+func (c *testCursor) Next() (interface{}, bool) {
+	if c.consumed >= len(c.items) {
+		return nil, false
+	}
+	c.consumed++
+	return c.items[c.consumed-1], true
+}
+
+func TestIteratorValues(t *testing.T) {
+	newCursor := func() *testCursor {
+		return &testCursor{items: []interface{}{"a", "b", "c", "d", "e"}}
+	}
+
+	tests := []struct {
+		tpl      string
+		expected string
+		consumed int
+	}{
+		{`{% for x in cursor %}{{ forloop.Counter }}{{ x }}{% if forloop.Last %}!{% endif %}{% endfor %}`, "1a2b3c4d5e!", 5},
+		{`{{ cursor|first }}`, "a", 1},
+		{`{{ cursor|slice:":2"|join:"," }}`, "a,b", 2},
+		{`{{ cursor|slice:"1:3"|join:"," }}`, "b,c", 3},
+		{`{{ cursor|join:"-" }}`, "a-b-c-d-e", 5},
+		{`{{ cursor|last }}`, "e", 5},
+		{`{% for x in cursor reversed %}{{ x }}{% endfor %}`, "edcba", 5},
+		{`{{ cursor|select:"string"|length }}`, "5", 5},
+	}
+	for _, test := range tests {
+		tpl, err := pongo2.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor := newCursor()
+		out, err := tpl.Execute(pongo2.Context{"cursor": cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.expected {
+			t.Errorf("%s: out ('%s') != '%s'", test.tpl, out, test.expected)
+		}
+		if cursor.consumed != test.consumed {
+			t.Errorf("%s: consumed %d items, expected %d", test.tpl, cursor.consumed, test.consumed)
+		}
+	}
+
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+	tpl, err := pongo2.FromString(`{% for n in ch %}{{ n }}{% empty %}empty{% endfor %}|{% for n in ch %}{{ n }}{% empty %}empty{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"ch": ch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "123|empty" {
+		t.Errorf("out ('%s') != '123|empty'", out)
+	}
+}
+
+func TestContextualAutoescape(t *testing.T) {
+	s := pongo2.NewSet("contextual autoescape", pongo2.NewMemoryLoader(nil))
+	s.ContextualAutoescape = true
+
+	ctx := pongo2.Context{
+		"text": `<b>"Tom" & 'Jerry'</b>`,
+		"js":   `"); alert('x'); //</script>`,
+		"css":  `red; background: url(x)`,
+		"url":  `javascript:alert(1)`,
+		"link": `https://example.com/a?b=c&d`,
+		"path": `docs/a b.html`,
+		"q":    `a&b=c d`,
+	}
+	tests := []struct {
+		tpl      string
+		expected string
+	}{
+		{`<p title="{{ text }}">{{ text }}</p>`, `<p title="&lt;b&gt;&quot;Tom&quot; &amp; &#39;Jerry&#39;&lt;/b&gt;">&lt;b&gt;&quot;Tom&quot; &amp; &#39;Jerry&#39;&lt;/b&gt;</p>`},
+		{`<script>var s = "{{ js }}";</script>{{ js }}`, `<script>var s = "\u0022\u0029\u003B alert\u0028\u0027x\u0027\u0029\u003B //\u003C/script\u003E";</script>&quot;); alert(&#39;x&#39;); //&lt;/script&gt;`},
+		{`<button onclick="go('{{ text }}')">`, `<button onclick="go('\u003Cb\u003E\u0022Tom\u0022 \u0026 \u0027Jerry\u0027\u003C/b\u003E')">`},
+		{`<style>p { color: {{ css }} }</style><p style="color: {{ css }}">`, `<style>p { color: red\3B  background\3A  url\28 x\29  }</style><p style="color: red\3B  background\3A  url\28 x\29 ">`},
+		{`<a href="{{ url }}">{{ url }}</a>`, `<a href="#unsafe-url">javascript:alert(1)</a>`},
+		{`<a href="{{ link }}"><a href={{ link }} class="x">`, `<a href="https://example.com/a?b=c&amp;d"><a href=https&#x3A;&#x2F;&#x2F;example&#x2E;com&#x2F;a&#x3F;b&#x3D;c&#x26;d class="x">`},
+		{`<a href="/static/{{ path }}?q={{ q }}#{{ q }}">`, `<a href="/static/docs/a%20b.html?q=a%26b%3Dc%20d#a%26b%3Dc%20d">`},
+		{`<!-- <script> -->{{ text|safe }}<img src="/x.png" alt="{{ path }}">`, `<!-- <script> --><b>"Tom" & 'Jerry'</b><img src="/x.png" alt="docs/a b.html">`},
+		{`{% autoescape url %}<script>{{ q }}</script>{% endautoescape %}`, `<script>a%26b%3Dc+d</script>`},
+		{`<SCRIPT type="text/javascript">{{ q }}</SCRIPT>{{ q }}`, `<SCRIPT type="text/javascript">a\u0026b\u003Dc d</SCRIPT>a&amp;b=c d`},
+	}
+	for _, test := range tests {
+		tpl, err := s.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.expected {
+			t.Errorf("%s:\nout      '%s'\nexpected '%s'", test.tpl, out, test.expected)
+		}
+	}
+
+	// Sets without contextual autoescaping always escape HTML
+	if out := pongo2.RenderTemplateString(`<script>{{ q }}</script>`, ctx); out != "<script>a&amp;b=c d</script>" {
+		t.Errorf("out ('%s') != '<script>a&amp;b=c d</script>'", out)
+	}
+}
+
+
+func TestUnquotedAttributeEscaping(t *testing.T) {
+	s := pongo2.NewSet("unquoted attributes", pongo2.NewMemoryLoader(nil))
+	s.ContextualAutoescape = true
+
+	ctx := pongo2.Context{
+		"v":   "x onmouseover=alert(1)",
+		"bt":  "`x`",
+		"url": "javascript:alert(1)",
+	}
+	tests := []struct {
+		tpl      string
+		expected string
+	}{
+		{`<p title={{ v }}>`, `<p title=x&#x20;onmouseover&#x3D;alert&#x28;1&#x29;>`},
+		{`<p title=a{{ bt }} class="{{ v }}">`, `<p title=a&#x60;x&#x60; class="x onmouseover=alert(1)">`},
+		{`<a href={{ url }}>`, `<a href=&#x23;unsafe&#x2D;url>`},
+		{`<button onclick=go({{ v }})>`, `<button onclick=go(x&#x20;onmouseover&#x5C;u003Dalert&#x5C;u0028&#x5C;u0031&#x5C;u0029)>`},
+		{`<p title={{ v|safe }}>`, `<p title=x onmouseover=alert(1)>`},
+	}
+	for _, test := range tests {
+		tpl, err := s.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.expected {
+			t.Errorf("%s:\nout      '%s'\nexpected '%s'", test.tpl, out, test.expected)
+		}
+	}
+
+	// Other sets only warn about those (the output stays HTML-escaped)
+	out := pongo2.RenderTemplateString(`<p title={{ v }} onclick="go('{{ v }}')">`, ctx)
+	if expected := `<p title=x onmouseover=alert(1) onclick="go('x onmouseover=alert(1)')">`; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+}
+
+func TestStrictUndefined(t *testing.T) {
+	s := pongo2.NewSet("strict undefined", pongo2.NewMemoryLoader(nil))
+	s.Undefined = pongo2.StrictUndefined
+
+	type user struct {
+		Name string
+	}
+	ctx := pongo2.Context{
+		"user":  &user{Name: "Tom"},
+		"prefs": map[string]interface{}{"theme": "dark"},
+		"none":  nil,
+	}
+
+	valid := map[string]string{
+		`{{ user.Name }} {{ prefs.theme }}`:                              "Tom dark",
+		`{{ none }}{{ forloop|default:"-" }}`:                            "-",
+		`{{ missing|default:"guest" }} {{ user.Age|default:"?" }}`:       "guest ?",
+		`{{ missing|default_if_none:"a" }}{{ prefs.lang|coalesce:"b" }}`: "ab",
+		`{% for i in prefs %}{{ forloop.Counter }}{% endfor %}`:          "1",
+	}
+	for src, expected := range valid {
+		tpl, err := s.FromString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if out != expected {
+			t.Errorf("%s: out ('%s') != '%s'", src, out, expected)
+		}
+	}
+
+	invalid := map[string]string{
+		"Hello {{ missing }}!":            `\[Error \(where: execution\) in <string> \| Line 1 Col 10 near 'missing'\] 'missing' is undefined \(variable missing\)`,
+		"\n{{ user.Nmae|upper }}":         `Line 2 Col 4 near 'user'\] 'Nmae' is undefined \(variable user.Nmae\)`,
+		"{% if prefs.lang %}{% endif %}":  `'lang' is undefined \(variable prefs.lang\)`,
+		`{{ missing|upper|default:"x" }}`: `'missing' is undefined`,
+	}
+	for src, pattern := range invalid {
+		tpl, err := s.FromString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Execute(ctx)
+		if err == nil {
+			t.Errorf("%s: expected an error", src)
+			continue
+		}
+		if !regexp.MustCompile(pattern).MatchString(err.Error()) {
+			t.Errorf("%s: error '%s' doesn't match '%s'", src, err.Error(), pattern)
+		}
+	}
+
+	// Without the StrictUndefined policy undefined variables are empty
+	if out := pongo2.RenderTemplateString("[{{ missing }}{{ user.Nmae }}]", ctx); out != "[]" {
+		t.Errorf("out ('%s') != '[]'", out)
+	}
+}
+
+func TestUndefinedPolicies(t *testing.T) {
+	s := pongo2.NewSet("undefined policies", pongo2.NewMemoryLoader(map[string]string{
+		"page.html": "{{ title }}|{{ user.email }}|{{ user.name }}|{{ nick|default:\"-\" }}",
+	}))
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{"user": map[string]string{"name": "Tom"}}
+
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "||Tom|-" {
+		t.Errorf("out ('%s') != '||Tom|-'", out)
+	}
+
+	s.Undefined = pongo2.DebugUndefined
+	out, err = tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{{ title }}|{{ user.email }}|Tom|-"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	// Per execution
+	logging := &pongo2.LoggingUndefined{}
+	out, err = tpl.ExecuteWithOptions(ctx, pongo2.ExecuteOptions{Undefined: logging})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "||Tom|-" {
+		t.Errorf("out ('%s') != '||Tom|-'", out)
+	}
+	expected := []pongo2.UndefinedVariable{
+		{Variable: "title", Name: "title", Filename: "page.html", Line: 1, Column: 4},
+		{Variable: "user.email", Name: "email", Attribute: true, Filename: "page.html", Line: 1, Column: 16},
+	}
+	if misses := logging.Misses(); !reflect.DeepEqual(misses, expected) {
+		t.Errorf("misses %+v != %+v", misses, expected)
+	}
+	logging.Reset()
+	if misses := logging.Misses(); len(misses) != 0 {
+		t.Errorf("expected no misses after Reset(), got %+v", misses)
+	}
+
+	_, err = tpl.ExecuteWithOptions(ctx, pongo2.ExecuteOptions{Undefined: pongo2.StrictUndefined})
+	if err == nil || !strings.HasSuffix(errorLine(err), "'title' is undefined (variable title)") {
+		t.Errorf("expected an error for 'title', got %v", err)
+	}
+}
+
+func TestErrorExcerpt(t *testing.T) {
+	s := pongo2.NewSet("error excerpts", pongo2.NewMemoryLoader(map[string]string{
+		"base.html": "<title>{% block title %}{% endblock %}</title>",
+		"page.html": "{% extends \"base.html\" %}\n{% block title %}\t{{ x|escapeurl:\"bogus\" }}{% endblock %}",
+	}))
+
+	tests := []struct {
+		src     string
+		column  int
+		excerpt string
+	}{
+		{"{{ name|upper }}\n<p>{{ name|unknown }}</p>", 12, "<p>{{ name|unknown }}</p>\n           ^"},
+		{"{# unclosed", 1, "{# unclosed\n^"},
+		{"\t<p>{% if %}</p>", 8, "\t<p>{% if %}</p>\n\t      ^"},
+		{strings.Repeat("x", 50) + "{{ a| }}" + strings.Repeat("y", 50), 57,
+			"..." + strings.Repeat("x", 34) + "{{ a| }}" + strings.Repeat("y", 38) + "...\n" + strings.Repeat(" ", 43) + "^"},
+	}
+	for _, test := range tests {
+		_, err := s.FromString(test.src)
+		if err == nil {
+			t.Fatalf("expected an error for '%s'", test.src)
+		}
+		perr := err.(*pongo2.Error)
+		if perr.Column != test.column || perr.Excerpt != test.excerpt {
+			t.Errorf("%q: column %d, excerpt\n%s\nexpected column %d, excerpt\n%s", test.src, perr.Column, perr.Excerpt, test.column, test.excerpt)
+		}
+		if !strings.HasSuffix(err.Error(), "\n    "+strings.Replace(test.excerpt, "\n", "\n    ", -1)) {
+			t.Errorf("%q: error doesn't end with the excerpt: %s", test.src, err.Error())
+		}
+	}
+
+	// Execution error in a block of an extending template
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(pongo2.Context{"x": 1})
+	if err == nil {
+		t.Fatal("expected an execution error")
+	}
+	expected := "{% block title %}\t{{ x|escapeurl:\"bogus\" }}{% endblock %}\n" + strings.Repeat(" ", 17) + "\t     ^"
+	if excerpt := err.(*pongo2.Error).Excerpt; excerpt != expected {
+		t.Errorf("excerpt\n%s\n!=\n%s", excerpt, expected)
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	s := pongo2.NewSet("error stack", pongo2.NewMemoryLoader(map[string]string{
+		"page.html":         "{% extends \"base.html\" %}{% block content %}{% include nav %}{% endblock %}",
+		"dynamic.html":      "{% extends layout %}",
+		"base.html":         "<body>\n  {% include \"partials/nav.html\" %}\n  {% block content %}{% endblock %}\n</body>",
+		"partials/nav.html": "<nav>{{ items|escapeurl:\"bogus\" }}</nav>",
+		"ok.html":           "<nav></nav>",
+		"menu.html":         "<ul>\n{% include nav %}</ul>",
+	}))
+
+	tests := []struct {
+		name     string
+		ctx      pongo2.Context
+		expected []pongo2.StackFrame
+	}{
+		{"page.html", pongo2.Context{"nav": "ok.html"}, []pongo2.StackFrame{
+			{Filename: "page.html", Line: 1, Column: 4},
+			{Filename: "base.html", Line: 2, Column: 6},
+		}},
+		{"base.html", nil, []pongo2.StackFrame{
+			{Filename: "base.html", Line: 2, Column: 6},
+		}},
+		{"dynamic.html", pongo2.Context{"layout": "page.html", "nav": "ok.html"}, []pongo2.StackFrame{
+			{Filename: "dynamic.html", Line: 1, Column: 4},
+			{Filename: "page.html", Line: 1, Column: 4},
+			{Filename: "base.html", Line: 2, Column: 6},
+		}},
+		{"partials/nav.html", nil, nil},
+	}
+	for _, test := range tests {
+		tpl, err := s.FromFile(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Execute(test.ctx)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+		perr := err.(*pongo2.Error)
+		if perr.Filename != "partials/nav.html" || !reflect.DeepEqual(perr.Stack, test.expected) {
+			t.Errorf("%s: error in %s with stack %+v, expected stack %+v", test.name, perr.Filename, perr.Stack, test.expected)
+		}
+	}
+
+	// Errors in a lazily included template
+	tpl, err := s.FromFile("menu.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(pongo2.Context{"nav": "partials/nav.html"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	expected := "Template stack: menu.html (Line 2 Col 4) -> partials/nav.html (Line 1 Col 15)"
+	if !strings.Contains(err.Error(), "\n    "+expected+"\n") {
+		t.Errorf("error doesn't contain the stack '%s': %s", expected, err.Error())
+	}
+}
+
+func TestMultipleParseErrors(t *testing.T) {
+	s := pongo2.NewSet("parse errors", pongo2.NewMemoryLoader(map[string]string{
+		"broken.html": "{{ }}{% foo %}",
+	}))
+
+	_, err := s.FromString("{{ }}\n{% if %}{{ x|nofilter }}{% endif %}\n" +
+		"{% for x in items %}{{ x| }}{% endfor %}\n{% for x in %}{% endfor %}{{ ok }}{% unknowntag %}")
+	first, ok := err.(*pongo2.Error)
+	if !ok {
+		t.Fatalf("expected a *pongo2.Error, got %T: %v", err, err)
+	}
+	if !strings.HasSuffix(first.ErrorMsg, " (and 5 more errors)") {
+		t.Errorf("error message doesn't mention the other errors: %s", first.ErrorMsg)
+	}
+	errs := first.Errors
+	expected := []struct {
+		line int
+		msg  string
+	}{
+		{1, "Expected either a number, string, keyword or identifier."},
+		{2, "Unexpected EOF, expected a number, string, keyword or identifier."},
+		{2, "Filter 'nofilter' does not exist."},
+		{3, "Filter name must be an identifier."},
+		{4, "Unexpected EOF, expected a number, string, keyword or identifier."},
+		{4, "Tag 'unknowntag' not found (or beginning tag not provided)"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d:\n%v", len(expected), len(errs), err)
+	}
+	for idx, e := range errs {
+		if e.Line != expected[idx].line || e.ErrorMsg != expected[idx].msg {
+			t.Errorf("error %d: line %d '%s' != line %d '%s'", idx, e.Line, e.ErrorMsg, expected[idx].line, expected[idx].msg)
+		}
+	}
+
+	// A single error has no list
+	if _, err := s.FromString("{% if true %}{{ x|nofilter }}{% endif %}"); err == nil {
+		t.Error("expected an error")
+	} else if e, ok := err.(*pongo2.Error); !ok || e.Errors != nil {
+		t.Errorf("expected a *pongo2.Error without a list, got %T: %v", err, err)
+	}
+
+	// Templates with errors depended on report the first one
+	_, err = s.FromString(`{% include "broken.html" %}`)
+	if err == nil || !strings.HasSuffix(errorLine(err), "Expected either a number, string, keyword or identifier. (and 1 more errors)") {
+		t.Errorf("expected the included template's errors, got %v", err)
+	}
+}
+
+func TestOnExecutionError(t *testing.T) {
+	s := pongo2.NewSet("execution errors", pongo2.NewMemoryLoader(map[string]string{
+		"widget.html": "<div>{{ ok|escapeurl:mode }}</div>",
+	}))
+	s.MaxLoopIterations = 3
+
+	ctx := pongo2.Context{
+		"mode": "bogus",
+		"ok":   "fine",
+	}
+	tpl, err := s.FromString(`<p>{{ ok }}</p>{% if true %}[{{ ok|escapeurl:mode }}]{% endif %}{% include "widget.html" %}<p>{{ ok }}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(ctx); err == nil {
+		t.Error("expected an error without a handler")
+	}
+
+	var handled []string
+	s.OnExecutionError(func(err *pongo2.Error, ctx *pongo2.ExecutionContext) (string, bool) {
+		handled = append(handled, fmt.Sprintf("%s:%d", err.Filename, err.Column))
+		return "<!-- unavailable -->", true
+	})
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<p>fine</p>[<!-- unavailable -->]<div><!-- unavailable --></div><p>fine</p>"
+	if out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+	if expected := []string{"<string>:36", "widget.html:12"}; !reflect.DeepEqual(handled, expected) {
+		t.Errorf("handled %v != %v", handled, expected)
+	}
+
+	// Declined errors fail the execution, the handler isn't asked again
+	handled = nil
+	s.OnExecutionError(func(err *pongo2.Error, ctx *pongo2.ExecutionContext) (string, bool) {
+		handled = append(handled, err.Filename)
+		return "", false
+	})
+	if _, err := tpl.Execute(ctx); err == nil || !strings.Contains(err.Error(), "Unknown mode 'bogus'") {
+		t.Errorf("expected the filter's error, got %v", err)
+	}
+	if len(handled) != 1 {
+		t.Errorf("expected the handler to be called once, got %v", handled)
+	}
+
+	// Exceeded limits can't be handled
+	s.OnExecutionError(func(err *pongo2.Error, ctx *pongo2.ExecutionContext) (string, bool) {
+		return "", true
+	})
+	tpl, err = s.FromString(`{% for i in items %}.{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(pongo2.Context{"items": []int{1, 2, 3, 4}})
+	if err == nil || !strings.HasSuffix(errorLine(err), "Loop iteration limit of 3 exceeded.") {
+		t.Errorf("expected a loop limit error, got %v", err)
+	}
+}
+
+func TestMissingAttribute(t *testing.T) {
+	s := pongo2.NewSet("missing attributes", pongo2.NewMemoryLoader(nil))
+	s.MissingAttribute = pongo2.StrictUndefined
+
+	type user struct {
+		Name string
+	}
+	tpl, err := s.FromString(`{{ title }}|{{ user.Name }}|{{ prefs.theme }}|{{ user.Nmae }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := pongo2.Context{"user": user{Name: "Tom"}, "prefs": map[string]string{}}
+	_, err = tpl.Execute(ctx)
+	if err == nil || !strings.HasSuffix(errorLine(err), "'theme' is undefined (variable prefs.theme)") {
+		t.Errorf("expected an error for the missing key, got %v", err)
+	}
+
+	// Missing variables are still handled by the set's Undefined policy
+	s.MissingAttribute = pongo2.DebugUndefined
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "|Tom|{{ prefs.theme }}|{{ user.Nmae }}"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	s.Undefined = pongo2.StrictUndefined
+	s.MissingAttribute = pongo2.SilentUndefined
+	_, err = tpl.Execute(ctx)
+	if err == nil || !strings.HasSuffix(errorLine(err), "'title' is undefined (variable title)") {
+		t.Errorf("expected an error for the missing variable, got %v", err)
+	}
+	ctx["title"] = "Hello"
+	out, err = tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Hello|Tom||" {
+		t.Errorf("out ('%s') != 'Hello|Tom||'", out)
+	}
+}
+
+type bomb struct{}
+
+func (b *bomb) Explode(n int) string {
+	var items []string
+	return items[n]
+}
+
+func (b *bomb) Boom() int {
+	panic("boom")
+}
+
+func TestMethodCallPanics(t *testing.T) {
+	ctx := pongo2.Context{
+		"b":     &bomb{},
+		"bombs": []*bomb{{}},
+		"fuse":  func() string { panic("boom") },
+	}
+	tests := map[string]string{
+		"<p>\n  {{ b.Explode(3) }}":        `[Error (where: execution) in <string> | Line 2 Col 6 near 'b'] Method 'Explode' of type *pongo2_test.bomb panicked: runtime error: index out of range [3] with length 0 (variable b.Explode)`,
+		"{% if fuse() %}{% endif %}":       `[Error (where: execution) in <string> | Line 1 Col 7 near 'fuse'] Function 'fuse' panicked: boom (variable fuse)`,
+		`{{ bombs|map:"Boom" }}`:           `[Error (where: filter:map, input type: []*pongo2_test.bomb) in <string> | Line 1 Col 10 near 'map'] Method 'Boom' of type *pongo2_test.bomb panicked: boom`,
+		`{{ bombs|sum:"Boom" }}`:           `[Error (where: filter:sum, input type: []*pongo2_test.bomb) in <string> | Line 1 Col 10 near 'sum'] Method 'Boom' of type *pongo2_test.bomb panicked: boom`,
+		`{{ bombs|selectattr:"Boom" }}`:    `[Error (where: filter:selectattr, input type: []*pongo2_test.bomb) in <string> | Line 1 Col 10 near 'selectattr'] Method 'Boom' of type *pongo2_test.bomb panicked: boom`,
+		"{% regroup bombs by Boom as g %}": `[Error (where: execution) in <string> | Line 1 Col 4 near 'regroup'] Method 'Boom' of type *pongo2_test.bomb panicked: boom`,
+	}
+	for src, expected := range tests {
+		tpl, err := pongo2.FromString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Execute(ctx)
+		if err == nil {
+			t.Errorf("%s: expected an error", src)
+			continue
+		}
+		if _, ok := err.(*pongo2.Error); !ok || errorLine(err) != expected {
+			t.Errorf("%s: error (%T) '%s' != '%s'", src, err, errorLine(err), expected)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	s := pongo2.NewSet("warnings", pongo2.NewMemoryLoader(map[string]string{
+		"base.html": `<title>{% block title %}{% endblock %}</title>{% block content %}{% endblock %}`,
+		"page.html": `{% extends "base.html" %}Lost{% block title %}T{% endblock %}{% block sidebar %}S{% endblock %}`,
+	}))
+	var reported []string
+	s.OnWarning(func(w *pongo2.Warning) { reported = append(reported, w.String()) })
+
+	tpl, err := s.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, w := range tpl.Warnings() {
+		warnings = append(warnings, w.String())
+	}
+	expected := []string{
+		"[Warning in page.html | Line 1 Col 71] Block 'sidebar' is never rendered, none of the parent templates defines it.",
+		"[Warning in page.html | Line 1 Col 26] Content outside of blocks is never rendered since the template extends another one.",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("warnings %q != %q", warnings, expected)
+	}
+
+	tpl, err = s.FromString(`{% with a=1 b=2 %}{{ a }}{{ c.b }}{% endwith %}{% with a=1 %}{% include "base.html" %}{% endwith %}` +
+		`{{ items|length_is:2 }}{% ifequal a b %}{% endifequal %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings = nil
+	for _, w := range tpl.Warnings() {
+		warnings = append(warnings, w.Message)
+	}
+	expected = []string{
+		"Variable 'b' of the with-tag is never used.",
+		"Filter 'length_is' is deprecated; use {% if value|length == n %} instead.",
+		"Tag 'ifequal' is deprecated; use {% if a == b %} instead.",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("warnings %q != %q", warnings, expected)
+	}
+
+	// Warnings during executions are only reported to the handler
+	reported = nil
+	s.Undefined = pongo2.WarnUndefined
+	tpl, err = s.FromString(`{{ missing }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"'missing' is undefined (variable missing)"}; len(reported) != 1 || !strings.HasSuffix(reported[0], expected[0]) {
+		t.Errorf("reported %q != %q", reported, expected)
+	}
+}
+func TestRegroupNilItems(t *testing.T) {
+	type post struct {
+		Title  string
+		Author interface{}
+		Editor *pongo2.Value
+	}
+	tpl, err := pongo2.FromString(`{% regroup x by Name as a %}{% regroup posts by Author.Name as b %}{% regroup posts by Editor.Name as c %}{{ a|length }}{{ b|length }}{{ c|length }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{
+		"x":     []interface{}{nil},
+		"posts": []*post{{Title: "a"}, nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "111" {
+		t.Errorf("out ('%s') != '111'", out)
+	}
+}
+func TestCollectionFiltersNilItems(t *testing.T) {
+	type author struct {
+		Name string
+	}
+	type book struct {
+		Title  string
+		Author interface{}
+	}
+	ctx := pongo2.Context{
+		"x":     []interface{}{nil},
+		"books": []interface{}{book{Title: "a"}, book{Title: "b", Author: author{Name: "Ann"}}, nil},
+	}
+	tpl, err := pongo2.FromString(`{{ x|map:"Name"|length }}|{{ books|map:"Author.Name"|join:"," }}|` +
+		`{{ books|selectattr:"Author.Name"|length }}|{{ books|rejectattr:"Author.Name"|length }}|{{ x|rejectattr:"Name"|length }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "1|,Ann,|1|2|1"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	// Missing numbers can't be summed up, but don't panic either
+	tpl, err = pongo2.FromString(`{{ books|sum:"Author.Age" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(ctx); err == nil {
+		t.Error("expected an error summing up missing attributes")
+	}
+}
+func TestEscapejsFilter(t *testing.T) {
+	tests := map[string]string{
+		"It's \"quoted\"":         `It\u0027s \u0022quoted\u0022`,
+		"line\u2028para\u2029end": `line\u2028para\u2029end`,
+		"</script><!-- -->":       `\u003C/script\u003E\u003C\u0021\u002D\u002D \u002D\u002D\u003E`,
+		"tab\there 1&2":           `tab\u0009here \u0031\u0026\u0032`,
+		"emoji \U0001F600":        `emoji \uD83D\uDE00`,
+	}
+	for in, expected := range tests {
+		out := pongo2.MustApplyFilter("escapejs", pongo2.AsValue(in), nil)
+		if out.String() != expected {
+			t.Errorf("escapejs(%q) = '%s', expected '%s'", in, out.String(), expected)
+		}
+	}
+}
+type testSafeHTML string
+
+func (h testSafeHTML) SafeHTML() string {
+	return string(h)
+}
+
+type testWidget struct {
+	Label string
+}
+
+func (w *testWidget) SafeHTML() string {
+	return "<button>" + w.Label + "</button>"
+}
+
+func TestSafeHTMLer(t *testing.T) {
+	ctx := pongo2.Context{
+		"html":   testSafeHTML("<b>bold</b>"),
+		"widget": &testWidget{Label: "OK"},
+		"plain":  "<b>bold</b>",
+	}
+	tests := []struct {
+		tpl      string
+		expected string
+	}{
+		{`{{ html }} {{ plain }}`, `<b>bold</b> &lt;b&gt;bold&lt;/b&gt;`},
+		{`{{ widget }} {{ widget.Label }}`, `<button>OK</button> OK`},
+		{`{{ html|upper }}`, `&lt;B&gt;BOLD&lt;/B&gt;`},
+		{`{% firstof missing html %} {% firstof plain %}`, `<b>bold</b> &lt;b&gt;bold&lt;/b&gt;`},
+	}
+	for _, test := range tests {
+		if out := pongo2.RenderTemplateString(test.tpl, ctx); out != test.expected {
+			t.Errorf("%s: out ('%s') != '%s'", test.tpl, out, test.expected)
+		}
+	}
+}
+
+func TestSetEscaper(t *testing.T) {
+	latex := pongo2.NewSet("latex", pongo2.NewMemoryLoader(nil))
+	latex.SetEscaper(strings.NewReplacer("&", `\&`, "%", `\%`, "_", `\_`).Replace)
+
+	ctx := pongo2.Context{"s": "50% of R&D <b>"}
+	tpl, err := latex.FromString(`{{ s }}|{% autoescape off %}{{ s|escape }}|{{ s }}{% endautoescape %}|{{ s|safe }}|{% autoescape js %}{{ "a&" }}{% endautoescape %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `50\% of R\&D <b>|50\% of R\&D <b>|50% of R&D <b>|50% of R&D <b>|a\u0026`; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if out := pongo2.RenderTemplateString(`{{ s }}`, ctx); out != "50% of R&amp;D &lt;b&gt;" {
+		t.Errorf("other sets must keep escaping HTML, got '%s'", out)
+	}
+
+	latex.SetEscaper(nil)
+	out, err = tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "50% of R&amp;D &lt;b&gt;|") {
+		t.Errorf("expected HTML escaping after resetting the escaper, got '%s'", out)
+	}
+}
+
+func TestOutputProfiles(t *testing.T) {
+	ctx := pongo2.Context{"name": `O'Brien & "Sons" <x>`}
+
+	mail := pongo2.NewSet("mail", pongo2.NewMemoryLoader(nil))
+	mail.SetOutputProfile(pongo2.OutputText)
+	tpl, err := mail.FromString(`Dear {{ name }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `Dear O'Brien & "Sons" <x>`; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+	if tpl.ContentType() != "text/plain; charset=utf-8" {
+		t.Errorf("wrong content type '%s'", tpl.ContentType())
+	}
+
+	tests := []struct {
+		tpl         string
+		expected    string
+		contentType string
+	}{
+		{`<p>{{ name }}</p>`, `<p>O&#39;Brien &amp; &quot;Sons&quot; &lt;x&gt;</p>`, "text/html; charset=utf-8"},
+		{`{% output "xml" %}<name>{{ name }}</name>`, `<name>O&apos;Brien &amp; &quot;Sons&quot; &lt;x&gt;</name>`, "application/xml; charset=utf-8"},
+		{`{% output "json" %}{"name": "{{ name }}"}`, `{"name": "O'Brien \u0026 \"Sons\" \u003cx\u003e"}`, "application/json"},
+		{`{% output "text" %}{{ name }}{% autoescape on %} {{ name }}{% endautoescape %}`, `O'Brien & "Sons" <x> O&#39;Brien &amp; &quot;Sons&quot; &lt;x&gt;`, "text/plain; charset=utf-8"},
+	}
+	for _, test := range tests {
+		tpl, err := pongo2.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.expected {
+			t.Errorf("%s: out ('%s') != '%s'", test.tpl, out, test.expected)
+		}
+		if tpl.ContentType() != test.contentType {
+			t.Errorf("%s: content type '%s' != '%s'", test.tpl, tpl.ContentType(), test.contentType)
+		}
+	}
+
+	for _, invalid := range []string{`{% output "yaml" %}`, `{% output %}`, `{% output "text" %}{% output "xml" %}`, `{% if true %}{% output "text" %}{% endif %}`} {
+		if _, err := pongo2.FromString(invalid); err == nil {
+			t.Errorf("%s: expected a compilation error", invalid)
+		}
+	}
+}
+
+func TestAutoescapeDefault(t *testing.T) {
+	mail := pongo2.NewSet("plain mails", pongo2.NewMemoryLoader(map[string]string{
+		"footer.txt": "-- {{ sender }}",
+	}))
+	if !mail.AutoescapeDefault {
+		t.Fatal("NewSet must enable autoescaping by default")
+	}
+	mail.AutoescapeDefault = false
+
+	tpl, err := mail.FromString(`Hi {{ name }},{% autoescape on %} {{ name }}{% endautoescape %}
+{% include "footer.txt" %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"name": "Tom & Jerry", "sender": "<R&D>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Hi Tom & Jerry, Tom &amp; Jerry\n-- <R&D>"; out != expected {
+		t.Errorf("out ('%s') != '%s'", out, expected)
+	}
+
+	if out := pongo2.RenderTemplateString(`{{ name }}`, pongo2.Context{"name": "Tom & Jerry"}); out != "Tom &amp; Jerry" {
+		t.Errorf("other sets must stay autoescaped, got '%s'", out)
+	}
+}
+
+func BenchmarkCache(b *testing.B) {
+	cacheSet := pongo2.NewSet("cache set", pongo2.MustNewLocalFileSystemLoader(""))
+	for i := 0; i < b.N; i++ {
+		tpl, err := cacheSet.FromCache("template_tests/complex.tpl")
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = tpl.ExecuteWriterUnbuffered(tplContext, ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCacheDebugOn(b *testing.B) {
+	cacheDebugSet := pongo2.NewSet("cache set", pongo2.MustNewLocalFileSystemLoader(""))
+	cacheDebugSet.Debug = true
+	for i := 0; i < b.N; i++ {
+		tpl, err := cacheDebugSet.FromFile("template_tests/complex.tpl")
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = tpl.ExecuteWriterUnbuffered(tplContext, ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkExecuteBufferPool(b *testing.B, disablePool bool) {
+	s := pongo2.NewSet("buffer pool", pongo2.MustNewLocalFileSystemLoader(""))
+	s.DisableBufferPool = disablePool
+	tpl, err := s.FromFile("template_tests/complex.tpl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = tpl.ExecuteWriter(tplContext, ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecuteWithBufferPool(b *testing.B) {
+	benchmarkExecuteBufferPool(b, false)
+}
+
+func BenchmarkExecuteWithoutBufferPool(b *testing.B) {
+	benchmarkExecuteBufferPool(b, true)
+}
+
+func BenchmarkExecuteString(b *testing.B) {
+	tpl, err := pongo2.FromFile("template_tests/complex.tpl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = tpl.Execute(tplContext)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecuteBytes(b *testing.B) {
+	tpl, err := pongo2.FromFile("template_tests/complex.tpl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = tpl.ExecuteBytes(tplContext)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -1,20 +1,8 @@
 package pongo2
 
-/* Incomplete:
-   -----------
-
-   verbatim (only the "name" argument is missing for verbatim)
-
-   Reconsideration:
-   ----------------
-
-   debug (reason: not sure what to output yet)
-   regroup / Grouping on other properties (reason: maybe too python-specific; not sure how useful this would be in Go)
-
-   Following built-in tags wont be added:
+/* Following built-in tags wont be added:
    --------------------------------------
 
-   csrf_token (reason: web-framework specific)
    load (reason: python-specific)
    url (reason: web-framework specific)
 */
@@ -37,7 +25,9 @@ type INodeTag interface {
 //
 // start_token will be the *Token with the tag's name in it (here: your_tag_name).
 //
-// Please see the Parser documentation on how to use the parser.
+// Please see the Parser documentation on how to use the parser;
+// Parser.ParseTagArguments() and Parser.WrapUntilEndTag() cover the
+// arguments and bodies of most tags.
 // See RegisterTag()'s documentation for more information about
 // writing a tag as well.
 type TagParser func(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error)
@@ -53,8 +43,9 @@ func init() {
 	tags = make(map[string]*tag)
 }
 
-// Registers a new tag. If there's already a tag with the same
-// name, RegisterTag will panic. You usually want to call this
+// Registers a new tag for all template sets. If there's already a tag
+// with the same name, RegisterTag will panic. Use TemplateSet.RegisterTag()
+// to make a tag available to a single set only. You usually want to call this
 // function in the tag's init() function:
 // http://golang.org/doc/effective_go.html#init
 //
@@ -71,8 +62,10 @@ func RegisterTag(name string, parserFn TagParser) {
 	}
 }
 
-// Replaces an already registered tag with a new implementation. Use this
-// function with caution since it allows you to change existing tag behaviour.
+// Replaces an already registered tag with a new implementation for all
+// template sets. Use this function with caution since it allows you to
+// change existing tag behaviour; TemplateSet.ReplaceTag() limits the
+// replacement to a single set.
 func ReplaceTag(name string, parserFn TagParser) {
 	_, existing := tags[name]
 	if !existing {
@@ -95,7 +88,7 @@ func (p *Parser) parseTagElement() (INodeTag, *Error) {
 	}
 
 	// Check for the existing tag
-	tag, exists := tags[tokenName.Val]
+	tag, exists := p.template.set.lookupTag(tokenName.Val)
 	if !exists {
 		// Does not exists
 		return nil, p.Error(fmt.Sprintf("Tag '%s' not found (or beginning tag not provided)", tokenName.Val), tokenName)
@@ -105,6 +98,9 @@ func (p *Parser) parseTagElement() (INodeTag, *Error) {
 	if _, isBanned := p.template.set.bannedTags[tokenName.Val]; isBanned {
 		return nil, p.Error(fmt.Sprintf("Usage of tag '%s' is not allowed (sandbox restriction active).", tokenName.Val), tokenName)
 	}
+	if hint, deprecated := deprecatedTags[tokenName.Val]; deprecated {
+		p.template.warnf(tokenName, "Tag '%s' is deprecated; %s.", tokenName.Val, hint)
+	}
 
 	var argsToken []*Token
 	for p.Peek(TokenSymbol, "%}") == nil && p.Remaining() > 0 {
@@ -1,13 +1,26 @@
 package pongo2
 
 type tagAutoescapeNode struct {
-	wrapper    *NodeWrapper
-	autoescape bool
+	wrapper      *NodeWrapper
+	autoescape   bool
+	escapeFilter string // filter used for escaping (only if autoescape is on)
+}
+
+// Filters used by the autoescape modes besides "on"/"off"
+var tagAutoescapeModes = map[string]string{
+	"html": "escape",
+	"js":   "escapejs",
+	"css":  "escapecss",
+	"url":  "urlencode",
 }
 
 func (node *tagAutoescapeNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	old := ctx.Autoescape
+	oldFilter := ctx.escapeFilter
 	ctx.Autoescape = node.autoescape
+	if node.escapeFilter != "" {
+		ctx.escapeFilter = node.escapeFilter
+	}
 
 	err := node.wrapper.Execute(ctx, writer)
 	if err != nil {
@@ -15,6 +28,7 @@ func (node *tagAutoescapeNode) Execute(ctx *ExecutionContext, writer TemplateWri
 	}
 
 	ctx.Autoescape = old
+	ctx.escapeFilter = oldFilter
 
 	return nil
 }
@@ -34,10 +48,14 @@ func tagAutoescapeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag
 	}
 	if modeToken.Val == "on" {
 		autoescapeNode.autoescape = true
+		autoescapeNode.escapeFilter = "escape"
 	} else if modeToken.Val == "off" {
 		autoescapeNode.autoescape = false
+	} else if escapeFilter, has := tagAutoescapeModes[modeToken.Val]; has {
+		autoescapeNode.autoescape = true
+		autoescapeNode.escapeFilter = escapeFilter
 	} else {
-		return nil, arguments.Error("Only 'on' or 'off' is valid as an autoescape-mode.", nil)
+		return nil, arguments.Error("Only 'on', 'off', 'html', 'js', 'css' or 'url' is valid as an autoescape-mode.", nil)
 	}
 
 	if arguments.Remaining() > 0 {
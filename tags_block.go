@@ -26,13 +26,24 @@ func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	if tpl == nil {
 		panic("internal error: tpl == nil")
 	}
-	// Determine the block to execute
-	blockWrapper := node.getBlockWrapperByName(tpl)
+	// Determine the block to execute; templates extending this one
+	// dynamically come first
+	var blockWrapper *NodeWrapper
+	for _, derived := range ctx.extendedBy {
+		if blockWrapper = node.getBlockWrapperByName(derived); blockWrapper != nil {
+			break
+		}
+	}
+	if blockWrapper == nil {
+		blockWrapper = node.getBlockWrapperByName(tpl)
+	}
 	if blockWrapper == nil {
 		// fmt.Printf("could not find: %s\n", node.name)
 		return ctx.Error("internal error: block_wrapper == nil in tagBlockNode.Execute()", nil)
 	}
+	ctx.blockStack = append(ctx.blockStack, node.name)
 	err := blockWrapper.Execute(ctx, writer)
+	ctx.blockStack = ctx.blockStack[:len(ctx.blockStack)-1]
 	if err != nil {
 		return err
 	}
@@ -85,6 +96,18 @@ func tagBlockParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 		return nil, arguments.Error(fmt.Sprintf("Block named '%s' already defined", nameToken.Val), nil)
 	}
 
+	// Top-level blocks of a template extending another one are only rendered
+	// if a parent defines them, too
+	if tpl.level == 1 && tpl.parent != nil {
+		defined := false
+		for parent := tpl.parent; parent != nil && !defined; parent = parent.parent {
+			_, defined = parent.blocks[nameToken.Val]
+		}
+		if !defined {
+			tpl.warnf(nameToken, "Block '%s' is never rendered, none of the parent templates defines it.", nameToken.Val)
+		}
+	}
+
 	return &tagBlockNode{name: nameToken.Val}, nil
 }
 
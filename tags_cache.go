@@ -0,0 +1,210 @@
+package pongo2
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheBackend stores the fragments rendered by the {% cache %} tag (see
+// TemplateSet.FragmentCache). Implementations must be safe for concurrent
+// use; wrap Redis, memcached etc. to share fragments between processes.
+type CacheBackend interface {
+	// Get returns the fragment stored under key and whether it was found
+	// (and hasn't expired yet).
+	Get(key string) (string, bool)
+
+	// Set stores a fragment under key for the duration ttl.
+	Set(key string, value string, ttl time.Duration)
+}
+
+// DefaultMemoryCacheEntries is the MaxEntries of new MemoryCacheBackends.
+const DefaultMemoryCacheEntries = 1000
+
+// MemoryCacheBackend is an in-memory CacheBackend and the default backend
+// of every set. Expired fragments are dropped when they're requested again;
+// the least recently used fragments are evicted once there are more than
+// MaxEntries (fragment keys vary with the cache tag's values, e. g. per
+// user).
+type MemoryCacheBackend struct {
+	// Now returns the current time; it's used to expire fragments
+	// (defaults to time.Now, replace it in tests).
+	Now func() time.Time
+
+	// MaxEntries bounds the number of fragments (defaults to
+	// DefaultMemoryCacheEntries, zero means unbounded).
+	MaxEntries int
+
+	entries map[string]*list.Element
+	lru     *list.List // of *memoryCacheEntry, most recently used first
+	mutex   sync.Mutex
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// NewMemoryCacheBackend creates a new, empty MemoryCacheBackend.
+func NewMemoryCacheBackend() *MemoryCacheBackend {
+	return &MemoryCacheBackend{
+		Now:        time.Now,
+		MaxEntries: DefaultMemoryCacheEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the fragment stored under key unless it has expired.
+func (mc *MemoryCacheBackend) Get(key string) (string, bool) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	element, has := mc.entries[key]
+	if !has {
+		return "", false
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if !mc.Now().Before(entry.expires) {
+		mc.remove(element)
+		return "", false
+	}
+	mc.lru.MoveToFront(element)
+	return entry.value, true
+}
+
+// Set stores a fragment under key for the duration ttl.
+func (mc *MemoryCacheBackend) Set(key string, value string, ttl time.Duration) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	entry := &memoryCacheEntry{
+		key:     key,
+		value:   value,
+		expires: mc.Now().Add(ttl),
+	}
+	if element, has := mc.entries[key]; has {
+		element.Value = entry
+		mc.lru.MoveToFront(element)
+	} else {
+		mc.entries[key] = mc.lru.PushFront(entry)
+	}
+	if mc.MaxEntries <= 0 {
+		return
+	}
+	for mc.lru.Len() > mc.MaxEntries {
+		mc.remove(mc.lru.Back())
+	}
+}
+
+// Len returns the number of stored fragments (including expired ones which
+// weren't requested again yet).
+func (mc *MemoryCacheBackend) Len() int {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return mc.lru.Len()
+}
+
+// remove drops the fragment; the caller must hold the mutex.
+func (mc *MemoryCacheBackend) remove(element *list.Element) {
+	mc.lru.Remove(element)
+	delete(mc.entries, element.Value.(*memoryCacheEntry).key)
+}
+
+type tagCacheNode struct {
+	position         *Token
+	timeoutEvaluator IEvaluator
+	name             string
+	varyOn           []IEvaluator
+	wrapper          *NodeWrapper
+}
+
+func (node *tagCacheNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	backend := ctx.template.set.FragmentCache
+	if backend == nil {
+		// Fragment caching disabled
+		return node.wrapper.Execute(ctx, writer)
+	}
+
+	timeout, err := node.timeoutEvaluator.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	if !timeout.IsNumber() {
+		return ctx.Error(fmt.Sprintf("Cache timeout must be a number of seconds, got '%s'.", timeout.String()), node.position)
+	}
+	ttl := time.Duration(timeout.Float() * float64(time.Second))
+
+	// The fragment's key is built from its name and the vary-on values
+	hash := sha256.New()
+	for _, evaluator := range node.varyOn {
+		value, err := evaluator.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00", value.String())
+	}
+	key := fmt.Sprintf("pongo2.fragment.%s.%x", node.name, hash.Sum(nil))
+
+	if fragment, has := backend.Get(key); has {
+		writer.WriteString(fragment)
+		return nil
+	}
+
+	b := ctx.limits.wrapBuffer(bytes.NewBuffer(make([]byte, 0, 1024))) // 1 KiB
+	err = node.wrapper.Execute(ctx, b)
+	b.release()
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		backend.Set(key, b.String(), ttl)
+	}
+	writer.Write(b.Bytes())
+
+	return nil
+}
+
+func tagCacheParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	cacheNode := &tagCacheNode{
+		position: start,
+	}
+
+	timeoutEvaluator, err := arguments.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	cacheNode.timeoutEvaluator = timeoutEvaluator
+
+	// The fragment's name is given literally (like in Django)
+	nameToken := arguments.MatchType(TokenIdentifier)
+	if nameToken == nil {
+		nameToken = arguments.MatchType(TokenString)
+	}
+	if nameToken == nil {
+		return nil, arguments.Error("Expected a fragment name (identifier or string).", nil)
+	}
+	cacheNode.name = nameToken.Val
+
+	for arguments.Remaining() > 0 {
+		varyOn, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		cacheNode.varyOn = append(cacheNode.varyOn, varyOn)
+	}
+
+	wrapper, _, err := doc.WrapUntilTag("endcache")
+	if err != nil {
+		return nil, err
+	}
+	cacheNode.wrapper = wrapper
+
+	return cacheNode, nil
+}
+
+func init() {
+	RegisterTag("cache", tagCacheParser)
+}
@@ -0,0 +1,39 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+type tagCSRFTokenNode struct {
+	position *Token
+}
+
+func (node *tagCSRFTokenNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	set := ctx.template.set
+	if set.CSRFTokenFunc == nil {
+		return ctx.Error("No CSRFTokenFunc configured for the template set.", node.position)
+	}
+
+	token := set.CSRFTokenFunc(ctx.Public)
+	if token == "" {
+		return nil
+	}
+
+	name, _ := filterEscape(AsValue(set.csrfFieldName()), nil)
+	value, _ := filterEscape(AsValue(token), nil)
+	writer.WriteString(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, name.String(), value.String()))
+
+	return nil
+}
+
+func tagCSRFTokenParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("The csrf_token-tag takes no arguments.", nil)
+	}
+
+	return &tagCSRFTokenNode{position: start}, nil
+}
+
+func init() {
+	RegisterTag("csrf_token", tagCSRFTokenParser)
+}
@@ -8,7 +8,6 @@ type tagCycleValue struct {
 type tagCycleNode struct {
 	position *Token
 	args     []IEvaluator
-	idx      int
 	asName   string
 	silent   bool
 }
@@ -17,47 +16,59 @@ func (cv *tagCycleValue) String() string {
 	return cv.value.String()
 }
 
-func (node *tagCycleNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	item := node.args[node.idx%len(node.args)]
-	node.idx++
-
-	val, err := item.Evaluate(ctx)
-	if err != nil {
-		return err
-	}
-
-	if t, ok := val.Interface().(*tagCycleValue); ok {
-		// {% cycle "test1" "test2"
-		// {% cycle cycleitem %}
-
-		// Update the cycle value with next value
-		item := t.node.args[t.node.idx%len(t.node.args)]
-		t.node.idx++
-
-		val, err := item.Evaluate(ctx)
-		if err != nil {
-			return err
-		}
-
-		t.value = val
+// next evaluates the cycle's next value; the position is kept per
+// execution (see ExecutionContext.cycles).
+func (node *tagCycleNode) next(ctx *ExecutionContext) (*Value, *Error) {
+	idx := ctx.cycles[node]
+	ctx.cycles[node] = idx + 1
+	return node.args[idx%len(node.args)].Evaluate(ctx)
+}
 
-		if !t.node.silent {
-			writer.WriteString(val.String())
+func (node *tagCycleNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	var val *Value
+	var err *Error
+	if len(node.args) == 1 {
+		// Evaluated only once, it may be a cycle value or the only value of
+		// a regular call
+		val, err = node.args[0].Evaluate(ctx)
+		if err == nil {
+			if t, ok := val.Interface().(*tagCycleValue); ok {
+				// {% cycle "test1" "test2" as cycleitem %}
+				// {% cycle cycleitem %}
+
+				// Update the cycle value with next value
+				val, err := t.node.next(ctx)
+				if err != nil {
+					return err
+				}
+
+				t.value = val
+
+				if !t.node.silent {
+					writer.WriteString(val.String())
+				}
+				return nil
+			}
 		}
+		ctx.cycles[node]++
 	} else {
 		// Regular call
+		val, err = node.next(ctx)
+	}
+	if err != nil {
+		return err
+	}
 
-		cycleValue := &tagCycleValue{
-			node:  node,
-			value: val,
-		}
+	cycleValue := &tagCycleValue{
+		node:  node,
+		value: val,
+	}
 
-		if node.asName != "" {
-			ctx.Private[node.asName] = cycleValue
-		}
-		if !node.silent {
-			writer.WriteString(val.String())
-		}
+	if node.asName != "" {
+		ctx.Private[node.asName] = cycleValue
+	}
+	if !node.silent {
+		writer.WriteString(val.String())
 	}
 
 	return nil
@@ -98,9 +109,59 @@ func tagCycleParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 		return nil, arguments.Error("Malformed cycle-tag.", nil)
 	}
 
+	if len(cycleNode.args) == 0 {
+		return nil, arguments.Error("Cycle-tag requires at least one value.", nil)
+	}
+
+	doc.template.lastCycle = cycleNode
+
 	return cycleNode, nil
 }
 
+type tagResetCycleNode struct {
+	position *Token
+	cycle    *tagCycleNode // the last cycle-tag (if no name is given)
+	name     string
+}
+
+func (node *tagResetCycleNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	cycle := node.cycle
+	if node.name != "" {
+		val, has := ctx.Private[node.name]
+		cycleValue, isCycle := val.(*tagCycleValue)
+		if !has || !isCycle {
+			return ctx.Error("No named cycles in template. '"+node.name+"' is not defined.", node.position)
+		}
+		cycle = cycleValue.node
+	}
+	delete(ctx.cycles, cycle)
+	return nil
+}
+
+// {% resetcycle [name] %} restarts the last (or the named) cycle with its
+// first value.
+func tagResetCycleParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	resetNode := &tagResetCycleNode{
+		position: start,
+	}
+
+	if nameToken := arguments.MatchType(TokenIdentifier); nameToken != nil {
+		resetNode.name = nameToken.Val
+	} else {
+		if doc.template.lastCycle == nil {
+			return nil, arguments.Error("No cycles in template.", nil)
+		}
+		resetNode.cycle = doc.template.lastCycle
+	}
+
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Malformed resetcycle-tag.", nil)
+	}
+
+	return resetNode, nil
+}
+
 func init() {
 	RegisterTag("cycle", tagCycleParser)
+	RegisterTag("resetcycle", tagResetCycleParser)
 }
@@ -0,0 +1,90 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type tagDebugNode struct {
+	position *Token
+}
+
+// Values longer than this are cut in the dump
+const tagDebugMaxValueLength = 200
+
+func (node *tagDebugNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	if !ctx.template.set.Debug {
+		return nil
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Template: %s (line %d)\n", ctx.template.name, node.position.Line)
+	if len(ctx.blockStack) > 0 {
+		fmt.Fprintf(&b, "Block: %s\n", strings.Join(ctx.blockStack, " > "))
+	}
+
+	if loop, ok := ctx.Private["forloop"].(*tagForLoopInformation); ok {
+		for depth := 0; loop != nil; depth++ {
+			fmt.Fprintf(&b, "Loop %d: Counter=%d Revcounter=%d First=%t Last=%t\n",
+				depth, loop.Counter, loop.Revcounter, loop.First, loop.Last)
+			loop = loop.Parentloop
+		}
+	}
+
+	scopes := []struct {
+		name string
+		ctx  Context
+	}{
+		{"Private", ctx.Private},
+		{"Public", ctx.Public},
+		{"Globals", ctx.globals},
+	}
+	for _, scope := range scopes {
+		if len(scope.ctx) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", scope.name)
+
+		names := make([]string, 0, len(scope.ctx))
+		for name := range scope.ctx {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := scope.ctx[name]
+			if v, isValue := value.(*Value); isValue {
+				value = v.Interface()
+			}
+			dump := []rune(fmt.Sprintf("%+v", value))
+			if len(dump) > tagDebugMaxValueLength {
+				dump = append(dump[:tagDebugMaxValueLength], []rune("...")...)
+			}
+			fmt.Fprintf(&b, "  %s (%T) = %s\n", name, value, string(dump))
+		}
+	}
+
+	escaped, _ := filterEscape(AsValue(b.String()), nil)
+	writer.WriteString("<pre class=\"pongo2-debug\">")
+	writer.WriteString(escaped.String())
+	writer.WriteString("</pre>")
+
+	return nil
+}
+
+// {% debug %} renders a dump of the execution context (variables and their
+// types, loops and blocks) if the template set's Debug is enabled; it
+// renders nothing otherwise.
+func tagDebugParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("The debug-tag takes no arguments.", nil)
+	}
+
+	return &tagDebugNode{position: start}, nil
+}
+
+func init() {
+	RegisterTag("debug", tagDebugParser)
+}
@@ -0,0 +1,82 @@
+package pongo2
+
+type tagEmbedNode struct {
+	position  *Token
+	tpl       *Template
+	withPairs map[string]IEvaluator
+	only      bool
+}
+
+func (node *tagEmbedNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	embedCtx, err := tagIncludeBuildContext(ctx, node.withPairs, node.only)
+	if err != nil {
+		return err
+	}
+
+	err2 := node.tpl.executeBuffered(embedCtx, writer, ctx.limits)
+	if err2 != nil {
+		return err2.(*Error).withFrames(node.position)
+	}
+	return nil
+}
+
+func tagEmbedParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	embedNode := &tagEmbedNode{
+		position:  start,
+		withPairs: make(map[string]IEvaluator),
+	}
+
+	filenameToken := arguments.MatchType(TokenString)
+	if filenameToken == nil {
+		return nil, arguments.Error("Tag 'embed' requires a template filename as string.", nil)
+	}
+
+	only, err := tagIncludeParseWithPairs(doc, arguments, embedNode.withPairs)
+	if err != nil {
+		return nil, err
+	}
+	embedNode.only = only
+
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Malformed 'embed'-tag arguments.", nil)
+	}
+
+	// The embedded template is compiled for this embed-tag only, so it can be
+	// extended by an anonymous child holding the blocks of the tag's body.
+	embeddedFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
+	embeddedTpl, err2 := doc.template.loadDependency(embeddedFilename)
+	if err2 != nil {
+		return nil, err2.(*Error).updateFromTokenIfNeeded(doc.template, filenameToken)
+	}
+
+	outer := doc.template
+	child := &Template{
+		set:            outer.set,
+		isTplString:    outer.isTplString,
+		name:           outer.name,
+		tpl:            outer.tpl,
+		tokens:         outer.tokens,
+		parent:         embeddedTpl,
+		blocks:         make(map[string]*NodeWrapper),
+		exportedMacros: make(map[string]*tagMacroNode),
+		dependencies:   outer.dependencies,
+		includeChain:   outer.includeChain,
+	}
+	embeddedTpl.child = child
+
+	// Parse the body on behalf of the child, so its blocks override the
+	// embedded template's ones (content outside of blocks is ignored)
+	doc.template = child
+	_, _, err = doc.WrapUntilTag("endembed")
+	doc.template = outer
+	if err != nil {
+		return nil, err
+	}
+
+	embedNode.tpl = embeddedTpl
+	return embedNode, nil
+}
+
+func init() {
+	RegisterTag("embed", tagEmbedParser)
+}
@@ -1,13 +1,33 @@
 package pongo2
 
 type tagExtendsNode struct {
-	filename string
+	filename          string
+	filenameEvaluator IEvaluator // set if the parent is given as a variable
 }
 
 func (node *tagExtendsNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	return nil
 }
 
+// loadParent evaluates the filename of a parent given as a variable and
+// returns the (cached) parent template.
+func (node *tagExtendsNode) loadParent(ctx *ExecutionContext) (*Template, *Error) {
+	filename, err := node.filenameEvaluator.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filename.String() == "" {
+		return nil, ctx.Error("Filename for 'extends'-tag evaluated to an empty string.", nil)
+	}
+
+	parentFilename := ctx.template.set.resolveFilename(ctx.template, filename.String())
+	parentTemplate, err2 := ctx.template.set.FromCache(parentFilename)
+	if err2 != nil {
+		return nil, err2.(*Error)
+	}
+	return parentTemplate, nil
+}
+
 func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	extendsNode := &tagExtendsNode{}
 
@@ -15,11 +35,13 @@ func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 		return nil, arguments.Error("The 'extends' tag can only defined on root level.", start)
 	}
 
-	if doc.template.parent != nil {
+	if doc.template.parent != nil || doc.template.lazyExtends != nil {
 		// Already one parent
 		return nil, arguments.Error("This template has already one parent.", start)
 	}
 
+	doc.template.extendsToken = start
+
 	if filenameToken := arguments.MatchType(TokenString); filenameToken != nil {
 		// prepared, static template
 
@@ -27,7 +49,7 @@ func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 		parentFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
 
 		// Parse the parent
-		parentTemplate, err := doc.template.set.FromFile(parentFilename)
+		parentTemplate, err := doc.template.loadDependency(parentFilename)
 		if err != nil {
 			return nil, err.(*Error)
 		}
@@ -37,7 +59,14 @@ func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 		doc.template.parent = parentTemplate
 		extendsNode.filename = parentFilename
 	} else {
-		return nil, arguments.Error("Tag 'extends' requires a template filename as string.", nil)
+		// No string, the parent is determined during execution, e. g.
+		// {% extends layout_name %} (slower, since resolved on every execution)
+		filenameEvaluator, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		extendsNode.filenameEvaluator = filenameEvaluator
+		doc.template.lazyExtends = extendsNode
 	}
 
 	if arguments.Remaining() > 0 {
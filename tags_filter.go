@@ -2,23 +2,20 @@ package pongo2
 
 import (
 	"bytes"
+	"fmt"
 )
 
-type nodeFilterCall struct {
-	name      string
-	paramExpr IEvaluator
-}
-
 type tagFilterNode struct {
 	position    *Token
 	bodyWrapper *NodeWrapper
-	filterChain []*nodeFilterCall
+	filterChain []*filterCall
 }
 
 func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	temp := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB size
+	temp := ctx.limits.wrapBuffer(bytes.NewBuffer(make([]byte, 0, 1024))) // 1 KiB size
 
 	err := node.bodyWrapper.Execute(ctx, temp)
+	temp.release()
 	if err != nil {
 		return err
 	}
@@ -26,18 +23,9 @@ func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	value := AsValue(temp.String())
 
 	for _, call := range node.filterChain {
-		var param *Value
-		if call.paramExpr != nil {
-			param, err = call.paramExpr.Evaluate(ctx)
-			if err != nil {
-				return err
-			}
-		} else {
-			param = AsValue(nil)
-		}
-		value, err = ApplyFilter(call.name, value, param)
+		value, err = call.Execute(value, ctx)
 		if err != nil {
-			return ctx.Error(err.Error(), node.position)
+			return err
 		}
 	}
 
@@ -46,6 +34,9 @@ func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	return nil
 }
 
+// Filter chains are parsed like the ones of variables, e. g.
+// {% filter lower|truncatewords:10|title %}, so unknown and banned filters
+// are reported when the template is compiled.
 func tagFilterParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	filterNode := &tagFilterNode{
 		position: start,
@@ -58,31 +49,27 @@ func tagFilterParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 	filterNode.bodyWrapper = wrapper
 
 	for arguments.Remaining() > 0 {
-		filterCall := &nodeFilterCall{}
-
-		nameToken := arguments.MatchType(TokenIdentifier)
-		if nameToken == nil {
-			return nil, arguments.Error("Expected a filter name (identifier).", nil)
+		filter, err := arguments.parseFilter()
+		if err != nil {
+			return nil, err
 		}
-		filterCall.name = nameToken.Val
-
-		if arguments.MatchOne(TokenSymbol, ":") != nil {
-			// Filter parameter
-			// NOTICE: we can't use ParseExpression() here, because it would parse the next filter "|..." as well in the argument list
-			expr, err := arguments.parseVariableOrLiteral()
-			if err != nil {
-				return nil, err
-			}
-			filterCall.paramExpr = expr
+
+		// Check sandbox filter restriction
+		if _, isBanned := doc.template.set.bannedFilters[filter.name]; isBanned {
+			return nil, arguments.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), filter.token)
 		}
 
-		filterNode.filterChain = append(filterNode.filterChain, filterCall)
+		filterNode.filterChain = append(filterNode.filterChain, filter)
 
 		if arguments.MatchOne(TokenSymbol, "|") == nil {
 			break
 		}
 	}
 
+	if len(filterNode.filterChain) == 0 {
+		return nil, arguments.Error("Expected a filter name (identifier).", nil)
+	}
+
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error("Malformed filter-tag arguments.", nil)
 	}
@@ -3,6 +3,7 @@ package pongo2
 type tagFirstofNode struct {
 	position *Token
 	args     []IEvaluator
+	asName   string
 }
 
 func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
@@ -13,8 +14,17 @@ func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		}
 
 		if val.IsTrue() {
-			if ctx.Autoescape && !arg.FilterApplied("safe") {
-				val, err = ApplyFilter("escape", val, nil)
+			if node.asName != "" {
+				// {% firstof ... as name %} stores the value instead of rendering it
+				if arg.FilterApplied("safe") {
+					val = AsSafeValue(val.Interface())
+				}
+				ctx.Private[node.asName] = val
+				return nil
+			}
+
+			if ctx.Autoescape && !arg.FilterApplied("safe") && !val.isSafe() {
+				val, err = ctx.escape(val)
 				if err != nil {
 					return err
 				}
@@ -25,6 +35,10 @@ func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		}
 	}
 
+	if node.asName != "" {
+		ctx.Private[node.asName] = AsValue("")
+	}
+
 	return nil
 }
 
@@ -34,6 +48,19 @@ func tagFirstofParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 	}
 
 	for arguments.Remaining() > 0 {
+		if arguments.Match(TokenKeyword, "as") != nil {
+			nameToken := arguments.MatchType(TokenIdentifier)
+			if nameToken == nil {
+				return nil, arguments.Error("Name (identifier) expected after 'as'.", nil)
+			}
+			firstofNode.asName = nameToken.Val
+
+			if arguments.Remaining() > 0 {
+				return nil, arguments.Error("Malformed firstof-tag arguments.", nil)
+			}
+			break
+		}
+
 		node, err := arguments.ParseExpression()
 		if err != nil {
 			return nil, err
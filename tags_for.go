@@ -1,8 +1,13 @@
 package pongo2
 
+import (
+	"fmt"
+	"reflect"
+)
+
 type tagForNode struct {
-	key             string
-	value           string // only for maps: for key, value in map
+	token           *Token
+	names           []string // loop variables: for key, value in map / for a, b in pairs
 	objectEvaluator IEvaluator
 	reversed        bool
 	sorted          bool
@@ -46,11 +51,15 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 
 	obj.IterateOrder(func(idx, count int, key, value *Value) bool {
 		// There's something to iterate over (correct type and at least 1 item)
+		if err := forCtx.countLoopIteration(node.token); err != nil {
+			forError = err
+			return false
+		}
 
 		// Update loop infos and public context
-		forCtx.Private[node.key] = key
-		if value != nil {
-			forCtx.Private[node.value] = value
+		if err := node.assign(forCtx, key, value); err != nil {
+			forError = err
+			return false
 		}
 		loopInfo.Counter = idx + 1
 		loopInfo.Counter0 = idx
@@ -60,8 +69,11 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 		if idx+1 == count {
 			loopInfo.Last = true
 		}
-		loopInfo.Revcounter = count - idx        // TODO: Not sure about this, have to look it up
-		loopInfo.Revcounter0 = count - (idx + 1) // TODO: Not sure about this, have to look it up
+		if count >= 0 {
+			// Unknown (-1) for iterators until their last item
+			loopInfo.Revcounter = count - idx        // TODO: Not sure about this, have to look it up
+			loopInfo.Revcounter0 = count - (idx + 1) // TODO: Not sure about this, have to look it up
+		}
 
 		// Render elements with updated context
 		err := node.bodyWrapper.Execute(forCtx, writer)
@@ -83,22 +95,73 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 	return forError
 }
 
+// assign sets the loop variables for the current item. Maps are iterated
+// as key and value; otherwise the item is unpacked into the loop variables
+// if there are several (it must be a slice/array or struct of the same
+// length then).
+func (node *tagForNode) assign(ctx *ExecutionContext, key, value *Value) *Error {
+	if len(node.names) == 1 {
+		ctx.Private[node.names[0]] = key
+		return nil
+	}
+
+	if value != nil {
+		if len(node.names) != 2 {
+			return ctx.Error(fmt.Sprintf("Cannot unpack map items (key and value) into %d loop variables.",
+				len(node.names)), node.token)
+		}
+		ctx.Private[node.names[0]] = key
+		ctx.Private[node.names[1]] = value
+		return nil
+	}
+
+	var items []*Value
+	switch rv := key.getResolvedValue(); rv.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, AsValue(rv.Index(i).Interface()))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).PkgPath != "" {
+				// unexported
+				continue
+			}
+			items = append(items, AsValue(rv.Field(i).Interface()))
+		}
+	default:
+		return ctx.Error(fmt.Sprintf("Cannot unpack item of type %s into %d loop variables.",
+			rv.Kind().String(), len(node.names)), node.token)
+	}
+	if len(items) != len(node.names) {
+		return ctx.Error(fmt.Sprintf("Cannot unpack item with %d elements into %d loop variables.",
+			len(items), len(node.names)), node.token)
+	}
+	for idx, name := range node.names {
+		ctx.Private[name] = items[idx]
+	}
+	return nil
+}
+
 func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	forNode := &tagForNode{}
+	forNode := &tagForNode{
+		token: start,
+	}
 
 	// Arguments parsing
-	var valueToken *Token
 	keyToken := arguments.MatchType(TokenIdentifier)
 	if keyToken == nil {
 		return nil, arguments.Error("Expected an key identifier as first argument for 'for'-tag", nil)
 	}
+	forNode.names = append(forNode.names, keyToken.Val)
 
-	if arguments.Match(TokenSymbol, ",") != nil {
-		// Value name is provided
-		valueToken = arguments.MatchType(TokenIdentifier)
+	for arguments.Match(TokenSymbol, ",") != nil {
+		// Value name (or further names to unpack the items into) is provided
+		valueToken := arguments.MatchType(TokenIdentifier)
 		if valueToken == nil {
 			return nil, arguments.Error("Value name must be an identifier.", nil)
 		}
+		forNode.names = append(forNode.names, valueToken.Val)
 	}
 
 	if arguments.Match(TokenKeyword, "in") == nil {
@@ -110,10 +173,6 @@ func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 		return nil, err
 	}
 	forNode.objectEvaluator = objectEvaluator
-	forNode.key = keyToken.Val
-	if valueToken != nil {
-		forNode.value = valueToken.Val
-	}
 
 	if arguments.MatchOne(TokenIdentifier, "reversed") != nil {
 		forNode.reversed = true
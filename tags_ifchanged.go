@@ -16,8 +16,9 @@ func (node *tagIfchangedNode) Execute(ctx *ExecutionContext, writer TemplateWrit
 	if len(node.watchedExpr) == 0 {
 		// Check against own rendered body
 
-		buf := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB
+		buf := ctx.limits.wrapBuffer(bytes.NewBuffer(make([]byte, 0, 1024))) // 1 KiB
 		err := node.thenWrapper.Execute(ctx, buf)
+		buf.release()
 		if err != nil {
 			return err
 		}
@@ -5,15 +5,21 @@ import (
 )
 
 type tagImportNode struct {
-	position *Token
-	filename string
-	macros   map[string]*tagMacroNode // alias/name -> macro instance
+	position  *Token
+	filename  string
+	macros    map[string]*tagMacroNode // alias/name -> macro instance
+	namespace string                   // set for {% import "file" as namespace %}
 }
 
 func (node *tagImportNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	target := ctx.Private
+	if node.namespace != "" {
+		target = make(Context)
+		ctx.Private[node.namespace] = map[string]interface{}(target)
+	}
 	for name, macro := range node.macros {
 		func(name string, macro *tagMacroNode) {
-			ctx.Private[name] = func(args ...*Value) *Value {
+			target[name] = func(args ...*Value) *Value {
 				return macro.call(ctx, args...)
 			}
 		}(name, macro)
@@ -21,7 +27,9 @@ func (node *tagImportNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	return nil
 }
 
-func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+// tagImportLoad parses the filename argument of import/from and compiles
+// the referenced template.
+func tagImportLoad(doc *Parser, start *Token, arguments *Parser, tagName string) (*tagImportNode, *Template, *Error) {
 	importNode := &tagImportNode{
 		position: start,
 		macros:   make(map[string]*tagMacroNode),
@@ -29,39 +37,45 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 
 	filenameToken := arguments.MatchType(TokenString)
 	if filenameToken == nil {
-		return nil, arguments.Error("Import-tag needs a filename as string.", nil)
+		return nil, nil, arguments.Error(fmt.Sprintf("%s-tag needs a filename as string.", tagName), nil)
 	}
 
 	importNode.filename = doc.template.set.resolveFilename(doc.template, filenameToken.Val)
 
-	if arguments.Remaining() == 0 {
-		return nil, arguments.Error("You must at least specify one macro to import.", nil)
-	}
-
 	// Compile the given template
-	tpl, err := doc.template.set.FromFile(importNode.filename)
+	tpl, err := doc.template.loadDependency(importNode.filename)
 	if err != nil {
-		return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, start)
+		return nil, nil, err.(*Error).updateFromTokenIfNeeded(doc.template, start)
+	}
+
+	return importNode, tpl, nil
+}
+
+// tagImportParseMacros parses a list of "macro [as alias]" separated by
+// commas.
+func tagImportParseMacros(arguments *Parser, importNode *tagImportNode, tpl *Template) *Error {
+	if arguments.Remaining() == 0 {
+		return arguments.Error("You must at least specify one macro to import.", nil)
 	}
 
 	for arguments.Remaining() > 0 {
 		macroNameToken := arguments.MatchType(TokenIdentifier)
 		if macroNameToken == nil {
-			return nil, arguments.Error("Expected macro name (identifier).", nil)
+			return arguments.Error("Expected macro name (identifier).", nil)
 		}
 
 		asName := macroNameToken.Val
 		if arguments.Match(TokenKeyword, "as") != nil {
 			aliasToken := arguments.MatchType(TokenIdentifier)
 			if aliasToken == nil {
-				return nil, arguments.Error("Expected macro alias name (identifier).", nil)
+				return arguments.Error("Expected macro alias name (identifier).", nil)
 			}
 			asName = aliasToken.Val
 		}
 
 		macroInstance, has := tpl.exportedMacros[macroNameToken.Val]
 		if !has {
-			return nil, arguments.Error(fmt.Sprintf("Macro '%s' not found (or not exported) in '%s'.", macroNameToken.Val,
+			return arguments.Error(fmt.Sprintf("Macro '%s' not found (or not exported) in '%s'.", macroNameToken.Val,
 				importNode.filename), macroNameToken)
 		}
 
@@ -72,8 +86,57 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 		}
 
 		if arguments.Match(TokenSymbol, ",") == nil {
-			return nil, arguments.Error("Expected ','.", nil)
+			return arguments.Error("Expected ','.", nil)
+		}
+	}
+
+	return nil
+}
+
+// Supports {% import "file" macro1, macro2 as alias %} as well as
+// Jinja2's {% import "file" as namespace %} which makes all exported
+// macros available as namespace.macro.
+func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	importNode, tpl, err := tagImportLoad(doc, start, arguments, "Import")
+	if err != nil {
+		return nil, err
+	}
+
+	if arguments.Match(TokenKeyword, "as") != nil {
+		namespaceToken := arguments.MatchType(TokenIdentifier)
+		if namespaceToken == nil {
+			return nil, arguments.Error("Expected namespace name (identifier).", nil)
+		}
+		if arguments.Remaining() > 0 {
+			return nil, arguments.Error("Malformed import-tag arguments.", nil)
+		}
+		importNode.namespace = namespaceToken.Val
+		for name, macro := range tpl.exportedMacros {
+			importNode.macros[name] = macro
 		}
+		return importNode, nil
+	}
+
+	if err := tagImportParseMacros(arguments, importNode, tpl); err != nil {
+		return nil, err
+	}
+
+	return importNode, nil
+}
+
+// Jinja2's {% from "file" import macro1, macro2 as alias %}
+func tagFromParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	importNode, tpl, err := tagImportLoad(doc, start, arguments, "From")
+	if err != nil {
+		return nil, err
+	}
+
+	if arguments.Match(TokenIdentifier, "import") == nil {
+		return nil, arguments.Error("Expected 'import'.", nil)
+	}
+
+	if err := tagImportParseMacros(arguments, importNode, tpl); err != nil {
+		return nil, err
 	}
 
 	return importNode, nil
@@ -81,4 +144,5 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 
 func init() {
 	RegisterTag("import", tagImportParser)
+	RegisterTag("from", tagFromParser)
 }
@@ -1,6 +1,7 @@
 package pongo2
 
 type tagIncludeNode struct {
+	position          *Token
 	tpl               *Template
 	filenameEvaluator IEvaluator
 	lazy              bool
@@ -11,128 +12,236 @@ type tagIncludeNode struct {
 }
 
 func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	// Building the context for the template
-	includeCtx := make(Context)
-
-	// Fill the context with all data from the parent
-	if !node.only {
-		includeCtx.Update(ctx.Public)
-		includeCtx.Update(ctx.Private)
-	}
-
-	// Put all custom with-pairs into the context
-	for key, value := range node.withPairs {
-		val, err := value.Evaluate(ctx)
-		if err != nil {
-			return err
-		}
-		includeCtx[key] = val
+	includeCtx, err := tagIncludeBuildContext(ctx, node.withPairs, node.only)
+	if err != nil {
+		return err
 	}
 
 	// Execute the template
 	if node.lazy {
-		// Evaluate the filename
+		// Evaluate the filename (or a list of fallback filenames)
 		filename, err := node.filenameEvaluator.Evaluate(ctx)
 		if err != nil {
 			return err
 		}
 
-		if filename.String() == "" {
+		var filenames []string
+		if filename.IsString() || !filename.CanSlice() {
+			filenames = []string{filename.String()}
+		} else {
+			filename.Iterate(func(idx, count int, key, value *Value) bool {
+				filenames = append(filenames, key.String())
+				return true
+			}, func() {})
+		}
+
+		return node.executeLazy(ctx, includeCtx, writer, filenames)
+	}
+	// Template is already parsed with static filename
+	err2 := node.tpl.executeBuffered(includeCtx, writer, ctx.limits)
+	if err2 != nil {
+		return err2.(*Error).withFrames(node.position)
+	}
+	return nil
+}
+
+// executeLazy includes the first of the given templates which exists. A
+// missing template is only an error if it's the last one and the include
+// isn't marked as "ignore missing".
+func (node *tagIncludeNode) executeLazy(ctx *ExecutionContext, includeCtx Context, writer TemplateWriter, filenames []string) *Error {
+	for idx, filename := range filenames {
+		if filename == "" {
 			return ctx.Error("Filename for 'include'-tag evaluated to an empty string.", nil)
 		}
+		ignoreMissing := node.ifExists || idx < len(filenames)-1
 
 		// Get include-filename
-		includedFilename := ctx.template.set.resolveFilename(ctx.template, filename.String())
+		includedFilename := ctx.template.set.resolveFilename(ctx.template, filename)
+
+		exists, existsKnown := ctx.template.set.templateExists(includedFilename)
+		if ignoreMissing && existsKnown && !exists {
+			continue
+		}
+
+		limits, err := ctx.enterInclude(includedFilename)
+		if err != nil {
+			return err
+		}
 
 		includedTpl, err2 := ctx.template.set.FromFile(includedFilename)
 		if err2 != nil {
+			limits.leaveInclude()
 			// if this is ReadFile error, and "if_exists" flag is enabled
-			if node.ifExists && err2.(*Error).Sender == "fromfile" {
-				return nil
+			if ignoreMissing && !existsKnown && err2.(*Error).Sender == "fromfile" {
+				continue
 			}
 			return err2.(*Error)
 		}
-		err2 = includedTpl.ExecuteWriter(includeCtx, writer)
+		err2 = includedTpl.executeBuffered(includeCtx, writer, limits)
+		limits.leaveInclude()
 		if err2 != nil {
-			return err2.(*Error)
+			return err2.(*Error).withFrames(node.position)
 		}
 		return nil
 	}
-	// Template is already parsed with static filename
-	err := node.tpl.ExecuteWriter(includeCtx, writer)
-	if err != nil {
-		return err.(*Error)
-	}
 	return nil
 }
 
+// tagIncludeBuildContext builds the context for an included (or embedded)
+// template: the including template's data unless only is set, plus the
+// evaluated with-pairs.
+func tagIncludeBuildContext(ctx *ExecutionContext, withPairs map[string]IEvaluator, only bool) (Context, *Error) {
+	includeCtx := make(Context)
+
+	// Fill the context with all data from the parent
+	if !only {
+		includeCtx.Update(ctx.Public)
+		includeCtx.Update(ctx.Private)
+	}
+
+	// Put all custom with-pairs into the context
+	for key, value := range withPairs {
+		val, err := value.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		includeCtx[key] = val
+	}
+
+	return includeCtx, nil
+}
+
 type tagIncludeEmptyNode struct{}
 
 func (node *tagIncludeEmptyNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	return nil
 }
 
+// Matches either "if_exists" or Jinja2's "ignore missing"
+func tagIncludeMatchIfExists(arguments *Parser) bool {
+	if arguments.Match(TokenIdentifier, "if_exists") != nil {
+		return true
+	}
+	if arguments.Peek(TokenIdentifier, "ignore") != nil && arguments.PeekN(1, TokenIdentifier, "missing") != nil {
+		arguments.ConsumeN(2)
+		return true
+	}
+	return false
+}
+
+// tagIncludeParseWithPairs parses the optional "with key=expr ... [only]"
+// (or just "only") arguments into withPairs (shared by include and embed).
+func tagIncludeParseWithPairs(doc *Parser, arguments *Parser, withPairs map[string]IEvaluator) (bool, *Error) {
+	if arguments.Match(TokenIdentifier, "only") != nil {
+		// Django allows "only" without any with-pairs
+		return true, nil
+	}
+	if arguments.Match(TokenIdentifier, "with") == nil {
+		return false, nil
+	}
+	for arguments.Remaining() > 0 {
+		// We have at least one key=expr pair (because of starting "with")
+		keyToken := arguments.MatchType(TokenIdentifier)
+		if keyToken == nil {
+			return false, arguments.Error("Expected an identifier", nil)
+		}
+		if arguments.Match(TokenSymbol, "=") == nil {
+			return false, arguments.Error("Expected '='.", nil)
+		}
+		valueExpr, err := arguments.ParseExpression()
+		if err != nil {
+			return false, err.updateFromTokenIfNeeded(doc.template, keyToken)
+		}
+
+		withPairs[keyToken.Val] = valueExpr
+
+		// Only?
+		if arguments.Match(TokenIdentifier, "only") != nil {
+			return true, nil // stop parsing arguments because it's the last option
+		}
+	}
+	return false, nil
+}
+
 func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	includeNode := &tagIncludeNode{
+		position:  start,
 		withPairs: make(map[string]IEvaluator),
 	}
 
-	if filenameToken := arguments.MatchType(TokenString); filenameToken != nil {
+	// Either a single filename or a list of fallback filenames, e. g.
+	// ["theme/header.html", "header.html"]: the first existing one is used
+	var filenameTokens []*Token
+	if arguments.Match(TokenSymbol, "[") != nil {
+		for {
+			filenameToken := arguments.MatchType(TokenString)
+			if filenameToken == nil {
+				return nil, arguments.Error("Expected a template filename as string.", nil)
+			}
+			filenameTokens = append(filenameTokens, filenameToken)
+			if arguments.Match(TokenSymbol, "]") != nil {
+				break
+			}
+			if arguments.Match(TokenSymbol, ",") == nil {
+				return nil, arguments.Error("Expected ',' or ']'.", nil)
+			}
+		}
+	} else if filenameToken := arguments.MatchType(TokenString); filenameToken != nil {
+		filenameTokens = append(filenameTokens, filenameToken)
+	}
+
+	if len(filenameTokens) > 0 {
 		// prepared, static template
 
-		// "if_exists" flag
-		ifExists := arguments.Match(TokenIdentifier, "if_exists") != nil
+		// "if_exists"/"ignore missing" flag
+		ifExists := tagIncludeMatchIfExists(arguments)
 
-		// Get include-filename
-		includedFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
+		for idx, filenameToken := range filenameTokens {
+			ignoreMissing := ifExists || idx < len(filenameTokens)-1
 
-		// Parse the parent
-		includeNode.filename = includedFilename
-		includedTpl, err := doc.template.set.FromFile(includedFilename)
-		if err != nil {
-			// if this is ReadFile error, and "if_exists" token presents we should create and empty node
-			if err.(*Error).Sender == "fromfile" && ifExists {
-				return &tagIncludeEmptyNode{}, nil
+			// Get include-filename
+			includedFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
+
+			exists, existsKnown := doc.template.set.templateExists(includedFilename)
+			if ignoreMissing && existsKnown && !exists {
+				continue
 			}
-			return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, filenameToken)
+
+			// Parse the parent
+			includedTpl, err := doc.template.loadDependency(includedFilename)
+			if err != nil {
+				// if this is ReadFile error, and "if_exists" token presents we should try the next
+				// template or create and empty node
+				if err.(*Error).Sender == "fromfile" && ignoreMissing && !existsKnown {
+					continue
+				}
+				return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, filenameToken)
+			}
+			includeNode.filename = includedFilename
+			includeNode.tpl = includedTpl
+			break
+		}
+
+		if includeNode.tpl == nil {
+			return &tagIncludeEmptyNode{}, nil
 		}
-		includeNode.tpl = includedTpl
 	} else {
 		// No String, then the user wants to use lazy-evaluation (slower, but possible)
 		filenameEvaluator, err := arguments.ParseExpression()
 		if err != nil {
-			return nil, err.updateFromTokenIfNeeded(doc.template, filenameToken)
+			return nil, err.updateFromTokenIfNeeded(doc.template, start)
 		}
 		includeNode.filenameEvaluator = filenameEvaluator
 		includeNode.lazy = true
-		includeNode.ifExists = arguments.Match(TokenIdentifier, "if_exists") != nil // "if_exists" flag
+		includeNode.ifExists = tagIncludeMatchIfExists(arguments) // "if_exists"/"ignore missing" flag
 	}
 
 	// After having parsed the filename we're gonna parse the with+only options
-	if arguments.Match(TokenIdentifier, "with") != nil {
-		for arguments.Remaining() > 0 {
-			// We have at least one key=expr pair (because of starting "with")
-			keyToken := arguments.MatchType(TokenIdentifier)
-			if keyToken == nil {
-				return nil, arguments.Error("Expected an identifier", nil)
-			}
-			if arguments.Match(TokenSymbol, "=") == nil {
-				return nil, arguments.Error("Expected '='.", nil)
-			}
-			valueExpr, err := arguments.ParseExpression()
-			if err != nil {
-				return nil, err.updateFromTokenIfNeeded(doc.template, keyToken)
-			}
-
-			includeNode.withPairs[keyToken.Val] = valueExpr
-
-			// Only?
-			if arguments.Match(TokenIdentifier, "only") != nil {
-				includeNode.only = true
-				break // stop parsing arguments because it's the last option
-			}
-		}
+	only, err := tagIncludeParseWithPairs(doc, arguments, includeNode.withPairs)
+	if err != nil {
+		return nil, err
 	}
+	includeNode.only = only
 
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error("Malformed 'include'-tag arguments.", nil)
@@ -13,16 +13,26 @@ var (
 
 type tagLoremNode struct {
 	position *Token
-	count    int    // number of paragraphs
-	method   string // w = words, p = HTML paragraphs, b = plain-text (default is b)
-	random   bool   // does not use the default paragraph "Lorem ipsum dolor sit amet, ..."
+	count    int        // number of paragraphs
+	countVar IEvaluator // count given as a variable, evaluated on execution
+	method   string     // w = words, p = HTML paragraphs, b = plain-text (default is b)
+	random   bool       // does not use the default paragraph "Lorem ipsum dolor sit amet, ..."
 }
 
 func (node *tagLoremNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	count := node.count
+	if node.countVar != nil {
+		countValue, err := node.countVar.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		count = countValue.Integer()
+	}
+
 	switch node.method {
 	case "b":
 		if node.random {
-			for i := 0; i < node.count; i++ {
+			for i := 0; i < count; i++ {
 				if i > 0 {
 					writer.WriteString("\n")
 				}
@@ -30,7 +40,7 @@ func (node *tagLoremNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 				writer.WriteString(par)
 			}
 		} else {
-			for i := 0; i < node.count; i++ {
+			for i := 0; i < count; i++ {
 				if i > 0 {
 					writer.WriteString("\n")
 				}
@@ -40,7 +50,7 @@ func (node *tagLoremNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		}
 	case "w":
 		if node.random {
-			for i := 0; i < node.count; i++ {
+			for i := 0; i < count; i++ {
 				if i > 0 {
 					writer.WriteString(" ")
 				}
@@ -48,7 +58,7 @@ func (node *tagLoremNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 				writer.WriteString(word)
 			}
 		} else {
-			for i := 0; i < node.count; i++ {
+			for i := 0; i < count; i++ {
 				if i > 0 {
 					writer.WriteString(" ")
 				}
@@ -58,7 +68,7 @@ func (node *tagLoremNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		}
 	case "p":
 		if node.random {
-			for i := 0; i < node.count; i++ {
+			for i := 0; i < count; i++ {
 				if i > 0 {
 					writer.WriteString("\n")
 				}
@@ -68,7 +78,7 @@ func (node *tagLoremNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 				writer.WriteString("</p>")
 			}
 		} else {
-			for i := 0; i < node.count; i++ {
+			for i := 0; i < count; i++ {
 				if i > 0 {
 					writer.WriteString("\n")
 				}
@@ -95,6 +105,14 @@ func tagLoremParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 
 	if countToken := arguments.MatchType(TokenNumber); countToken != nil {
 		loremNode.count = AsValue(countToken.Val).Integer()
+	} else if arguments.PeekType(TokenIdentifier) != nil &&
+		arguments.PeekOne(TokenIdentifier, "w", "p", "b", "random") == nil {
+		// Count given as a variable, e. g. {% lorem paragraphs p %}
+		countVar, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		loremNode.countVar = countVar
 	}
 
 	if methodToken := arguments.MatchType(TokenIdentifier); methodToken != nil {
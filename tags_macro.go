@@ -34,7 +34,7 @@ func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) *Value {
 			// Evaluate the default value
 			valueExpr, err := v.Evaluate(ctx)
 			if err != nil {
-				ctx.Logf(err.Error())
+				ctx.Logf("%s", err.Error())
 				return AsSafeValue(err.Error())
 			}
 
@@ -47,7 +47,7 @@ func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) *Value {
 		err := ctx.Error(fmt.Sprintf("Macro '%s' called with too many arguments (%d instead of %d).",
 			node.name, len(args), len(node.argsOrder)), nil).updateFromTokenIfNeeded(ctx.template, node.position)
 
-		ctx.Logf(err.Error()) // TODO: This is a workaround, because the error is not returned yet to the Execution()-methods
+		ctx.Logf("%s", err.Error()) // TODO: This is a workaround, because the error is not returned yet to the Execution()-methods
 		return AsSafeValue(err.Error())
 	}
 
@@ -61,8 +61,9 @@ func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) *Value {
 		macroCtx.Private[node.argsOrder[idx]] = argValue.Interface()
 	}
 
-	var b bytes.Buffer
-	err := node.wrapper.Execute(macroCtx, &b)
+	b := ctx.limits.wrapBuffer(new(bytes.Buffer))
+	err := node.wrapper.Execute(macroCtx, b)
+	b.release()
 	if err != nil {
 		return AsSafeValue(err.updateFromTokenIfNeeded(ctx.template, node.position).Error())
 	}
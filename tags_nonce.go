@@ -0,0 +1,103 @@
+package pongo2
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tagNonceNode struct {
+	position *Token
+}
+
+type tagNonceElementNode struct {
+	position *Token
+	element  string // "script" or "style"
+	wrapper  *NodeWrapper
+}
+
+// nonce returns the Content-Security-Policy nonce of the current execution
+// provided by the set's NonceFunc.
+func (ctx *ExecutionContext) nonce(position *Token) (string, *Error) {
+	set := ctx.template.set
+	if set.NonceFunc == nil {
+		return "", ctx.Error("No NonceFunc configured for the template set.", position)
+	}
+	return set.NonceFunc(ctx.Public), nil
+}
+
+func (node *tagNonceNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	nonce, err := ctx.nonce(node.position)
+	if err != nil {
+		return err
+	}
+	writer.WriteString(escapeHTML(nonce))
+	return nil
+}
+
+func (node *tagNonceElementNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	nonce, err := ctx.nonce(node.position)
+	if err != nil {
+		return err
+	}
+
+	if nonce == "" {
+		writer.WriteString(fmt.Sprintf("<%s>", node.element))
+	} else {
+		writer.WriteString(fmt.Sprintf(`<%s nonce="%s">`, node.element, escapeHTML(nonce)))
+	}
+	if err := node.wrapper.Execute(ctx, writer); err != nil {
+		return err
+	}
+	writer.WriteString(fmt.Sprintf("</%s>", node.element))
+
+	return nil
+}
+
+// tagNonceParser parses {% nonce %}, which renders the nonce for use in
+// attributes:
+//
+//	<script nonce="{% nonce %}" src="/app.js"></script>
+func tagNonceParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("The nonce-tag takes no arguments.", nil)
+	}
+
+	return &tagNonceNode{position: start}, nil
+}
+
+// tagNonceElementParser parses {% nonce_script %}...{% endnonce_script %}
+// and {% nonce_style %}...{% endnonce_style %}, which wrap their content into the element
+// carrying the nonce (or none, if the nonce is empty).
+func tagNonceElementParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	node := &tagNonceElementNode{
+		position: start,
+		element:  strings.TrimPrefix(start.Val, "nonce_"),
+	}
+
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error(fmt.Sprintf("The %s-tag takes no arguments.", start.Val), nil)
+	}
+
+	// The content is script or style (see TemplateSet.ContextualAutoescape)
+	doc.template.htmlScanner.feed(fmt.Sprintf("<%s>", node.element))
+
+	wrapper, endargs, err := doc.WrapUntilTag("end" + start.Val)
+	if err != nil {
+		return nil, err
+	}
+	node.wrapper = wrapper
+
+	if endargs.Count() > 0 {
+		return nil, endargs.Error("Arguments not allowed here.", nil)
+	}
+
+	doc.template.htmlScanner.feed(fmt.Sprintf("</%s>", node.element))
+
+	return node, nil
+}
+
+func init() {
+	RegisterTag("nonce", tagNonceParser)
+	RegisterTag("nonce_script", tagNonceElementParser)
+	RegisterTag("nonce_style", tagNonceElementParser)
+}
@@ -15,10 +15,10 @@ func (node *tagNowNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 	if node.fake {
 		t = time.Date(2014, time.February, 05, 18, 31, 45, 00, time.UTC)
 	} else {
-		t = time.Now()
+		t = ctx.template.set.now()
 	}
 
-	writer.WriteString(t.Format(node.format))
+	writer.WriteString(formatTime(t, node.format))
 
 	return nil
 }
@@ -0,0 +1,43 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+type tagOutputNode struct{}
+
+func (node *tagOutputNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	return nil
+}
+
+// tagOutputParser parses the {% output "name" %} pragma which selects the
+// output profile of the template it's in. It must be on the template's root
+// level (like extends).
+func tagOutputParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if doc.template.level > 1 {
+		return nil, arguments.Error("The 'output' tag can only be defined on root level.", start)
+	}
+
+	nameToken := arguments.MatchType(TokenString)
+	if nameToken == nil {
+		return nil, arguments.Error("Tag 'output' requires the name of an output profile as string.", nil)
+	}
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Tag 'output' takes only one argument.", nil)
+	}
+
+	profile, has := outputProfiles[nameToken.Val]
+	if !has {
+		return nil, arguments.Error(fmt.Sprintf("Unknown output profile '%s' (valid profiles are 'html', 'json', 'text' and 'xml').", nameToken.Val), nameToken)
+	}
+	if doc.template.outputProfile != nil {
+		return nil, arguments.Error("The output profile has already been set.", start)
+	}
+	doc.template.outputProfile = profile
+
+	return &tagOutputNode{}, nil
+}
+
+func init() {
+	RegisterTag("output", tagOutputParser)
+}
@@ -0,0 +1,147 @@
+package pongo2
+
+import (
+	"reflect"
+)
+
+type tagRegroupNode struct {
+	position      *Token
+	listEvaluator IEvaluator
+	attribute     []string
+	name          string
+}
+
+func (node *tagRegroupNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	list, err := node.listEvaluator.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Like Django, only consecutive items with the same grouper are grouped
+	// (the list is expected to be sorted by the attribute already).
+	var groups []map[string]interface{}
+	var lastGrouper *Value
+	var groupErr error
+	list.Iterate(func(idx, count int, item, value *Value) bool {
+		grouper, err := regroupAttribute(item, node.attribute)
+		if err != nil {
+			groupErr = err
+			return false
+		}
+		if lastGrouper == nil || !grouper.EqualValueTo(lastGrouper) {
+			groups = append(groups, map[string]interface{}{
+				"grouper": grouper,
+				"list":    []interface{}{},
+			})
+			lastGrouper = grouper
+		}
+		group := groups[len(groups)-1]
+		group["list"] = append(group["list"].([]interface{}), item.Interface())
+		return true
+	}, func() {})
+	if groupErr != nil {
+		return ctx.Error(groupErr.Error(), node.position)
+	}
+
+	ctx.Private[node.name] = groups
+	return nil
+}
+
+// regroupAttribute resolves a (dotted) attribute path like "author.name" on
+// item: methods without arguments, struct fields and map keys are supported.
+// A panicking method results in an error.
+func regroupAttribute(item *Value, attribute []string) (*Value, error) {
+	current := item.val
+	for _, name := range attribute {
+		if current.Kind() == reflect.Interface {
+			current = reflect.ValueOf(current.Interface())
+		}
+		// nil items and nil interfaces or pointers on the path
+		if !current.IsValid() || (current.Kind() == reflect.Ptr && current.IsNil()) {
+			return AsValue(nil), nil
+		}
+		if current.Type() == reflect.TypeOf(&Value{}) {
+			current = current.Interface().(*Value).val
+			if !current.IsValid() {
+				return AsValue(nil), nil
+			}
+		}
+
+		if method := current.MethodByName(name); method.IsValid() &&
+			method.Type().NumIn() == 0 && method.Type().NumOut() == 1 {
+			rv, err := callRecovered(method, nil, name, current.Type())
+			if err != nil {
+				return nil, err
+			}
+			current = rv
+		} else {
+			if current.Kind() == reflect.Ptr {
+				current = current.Elem()
+			}
+			if !current.IsValid() {
+				return AsValue(nil), nil
+			}
+			switch current.Kind() {
+			case reflect.Struct:
+				current = current.FieldByName(name)
+			case reflect.Map:
+				if current.Type().Key().Kind() != reflect.String {
+					return AsValue(nil), nil
+				}
+				current = current.MapIndex(reflect.ValueOf(name).Convert(current.Type().Key()))
+			default:
+				return AsValue(nil), nil
+			}
+		}
+
+		if !current.IsValid() || !current.CanInterface() {
+			return AsValue(nil), nil
+		}
+	}
+	return AsValue(current.Interface()), nil
+}
+
+func tagRegroupParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	node := &tagRegroupNode{position: start}
+
+	listEvaluator, err := arguments.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	node.listEvaluator = listEvaluator
+
+	if arguments.Match(TokenIdentifier, "by") == nil {
+		return nil, arguments.Error("Expected 'by'.", nil)
+	}
+
+	// Attribute path, e. g. "author.name"
+	for {
+		attributeToken := arguments.MatchType(TokenIdentifier)
+		if attributeToken == nil {
+			return nil, arguments.Error("Expected an attribute name (identifier).", nil)
+		}
+		node.attribute = append(node.attribute, attributeToken.Val)
+		if arguments.Match(TokenSymbol, ".") == nil {
+			break
+		}
+	}
+
+	if arguments.Match(TokenKeyword, "as") == nil {
+		return nil, arguments.Error("Expected 'as'.", nil)
+	}
+	nameToken := arguments.MatchType(TokenIdentifier)
+	if nameToken == nil {
+		return nil, arguments.Error("Expected an identifier.", nil)
+	}
+	node.name = nameToken.Val
+
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Malformed 'regroup'-tag arguments.", nil)
+	}
+
+	return node, nil
+}
+
+func init() {
+	RegisterTag("regroup", tagRegroupParser)
+}
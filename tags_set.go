@@ -1,11 +1,28 @@
 package pongo2
 
+import (
+	"bytes"
+)
+
 type tagSetNode struct {
 	name       string
 	expression IEvaluator
+	wrapper    *NodeWrapper // block form: {% set name %}...{% endset %}
 }
 
 func (node *tagSetNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	if node.wrapper != nil {
+		// Capture the rendered block (it's already escaped, hence safe)
+		b := ctx.limits.wrapBuffer(bytes.NewBuffer(make([]byte, 0, 1024))) // 1 KiB
+		err := node.wrapper.Execute(ctx, b)
+		b.release()
+		if err != nil {
+			return err
+		}
+		ctx.Private[node.name] = AsSafeValue(b.String())
+		return nil
+	}
+
 	// Evaluate expression
 	value, err := node.expression.Evaluate(ctx)
 	if err != nil {
@@ -26,6 +43,19 @@ func tagSetParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 	}
 	node.name = typeToken.Val
 
+	if arguments.Remaining() == 0 {
+		// Block form
+		wrapper, endargs, err := doc.WrapUntilTag("endset")
+		if err != nil {
+			return nil, err
+		}
+		if endargs.Count() > 0 {
+			return nil, endargs.Error("Arguments not allowed here.", nil)
+		}
+		node.wrapper = wrapper
+		return node, nil
+	}
+
 	if arguments.Match(TokenSymbol, "=") == nil {
 		return nil, arguments.Error("Expected '='.", nil)
 	}
@@ -0,0 +1,85 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+// SimpleTagFunction is the function signature of simple tags (see
+// RegisterSimpleTag()). It receives the evaluated arguments of the tag
+// and returns its output.
+type SimpleTagFunction func(ctx *ExecutionContext, args ...*Value) (string, error)
+
+type tagSimpleNode struct {
+	position *Token
+	name     string
+	fn       SimpleTagFunction
+	args     *TagArguments
+}
+
+func (node *tagSimpleNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	args, _, err := node.args.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, fnErr := node.fn(ctx, args...)
+	if fnErr != nil {
+		if e, ok := fnErr.(*Error); ok {
+			return e.updateFromTokenIfNeeded(ctx.template, node.position)
+		}
+		return ctx.Error(fmt.Sprintf("Tag '%s' failed: %s", node.name, fnErr.Error()), node.position)
+	}
+
+	if node.args.AsName != "" {
+		ctx.Private[node.args.AsName] = out
+		return nil
+	}
+
+	if ctx.Autoescape {
+		escaped, err := ctx.escape(AsValue(out))
+		if err != nil {
+			return err
+		}
+		out = escaped.String()
+	}
+	writer.WriteString(out)
+
+	return nil
+}
+
+func simpleTagParser(name string, fn SimpleTagFunction) TagParser {
+	return func(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+		args, err := arguments.ParseTagArguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args.Kwargs) > 0 {
+			return nil, arguments.Error(fmt.Sprintf("Tag '%s' does not take keyword arguments.", name), start)
+		}
+		return &tagSimpleNode{
+			position: start,
+			name:     name,
+			fn:       fn,
+			args:     args,
+		}, nil
+	}
+}
+
+// RegisterSimpleTag registers a tag which calls fn with the tag's evaluated
+// arguments and outputs its result (like Django's simple_tag), so tags
+// which just print the result of a Go function don't need their own parser
+// and node:
+//
+//	pongo2.RegisterSimpleTag("greet", func(ctx *pongo2.ExecutionContext, args ...*pongo2.Value) (string, error) {
+//	    return "Hello " + args[0].String(), nil
+//	})
+//
+// It's used as {% greet user.name %} and takes any number of arguments
+// (fn must check them itself). The output is autoescaped unless it's
+// assigned to a variable using {% greet user.name as greeting %}. Errors
+// returned by fn abort the execution. Like RegisterTag(), it panics if
+// there's already a tag with the same name; use
+// TemplateSet.RegisterSimpleTag() to register it for a single set.
+func RegisterSimpleTag(name string, fn SimpleTagFunction) {
+	RegisterTag(name, simpleTagParser(name, fn))
+}
@@ -2,24 +2,48 @@ package pongo2
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
+	"strings"
 )
 
 type tagSpacelessNode struct {
-	wrapper *NodeWrapper
+	wrapper  *NodeWrapper
+	collapse bool // collapse whitespace within text, too
+	preserve bool // leave pre/textarea/script/style contents untouched
 }
 
-var tagSpacelessRegexp = regexp.MustCompile(`(?U:(<.*>))([\t\n\v\f\r ]+)(?U:(<.*>))`)
+var (
+	tagSpacelessRegexp         = regexp.MustCompile(`(?U:(<.*>))([\t\n\v\f\r ]+)(?U:(<.*>))`)
+	tagSpacelessCollapseRegexp = regexp.MustCompile(`[\t\n\v\f\r ]+`)
+	tagSpacelessPreserveRegexp = regexp.MustCompile(`(?is)<pre\b.*?</pre>|<textarea\b.*?</textarea>|<script\b.*?</script>|<style\b.*?</style>`)
+)
 
 func (node *tagSpacelessNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	b := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB
+	b := ctx.limits.wrapBuffer(bytes.NewBuffer(make([]byte, 0, 1024))) // 1 KiB
 
 	err := node.wrapper.Execute(ctx, b)
+	b.release()
 	if err != nil {
 		return err
 	}
 
 	s := b.String()
+
+	// Replace elements whose whitespace is significant by tag-like
+	// placeholders and restore them after the whitespace was removed
+	var preserved []string
+	if node.preserve {
+		s = tagSpacelessPreserveRegexp.ReplaceAllStringFunc(s, func(element string) string {
+			preserved = append(preserved, element)
+			return fmt.Sprintf("<\x00%d>", len(preserved)-1)
+		})
+	}
+
+	if node.collapse {
+		s = tagSpacelessCollapseRegexp.ReplaceAllString(s, " ")
+	}
+
 	// Repeat this recursively
 	changed := true
 	for changed {
@@ -28,11 +52,19 @@ func (node *tagSpacelessNode) Execute(ctx *ExecutionContext, writer TemplateWrit
 		s = s2
 	}
 
+	for idx, element := range preserved {
+		s = strings.Replace(s, fmt.Sprintf("<\x00%d>", idx), element, 1)
+	}
+
 	writer.WriteString(s)
 
 	return nil
 }
 
+// Supports the options "collapse" (additionally collapses runs of
+// whitespace within text to a single space) and "preserve" (keeps the
+// contents of pre, textarea, script and style elements untouched; implied
+// by "collapse").
 func tagSpacelessParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	spacelessNode := &tagSpacelessNode{}
 
@@ -42,8 +74,18 @@ func tagSpacelessParser(doc *Parser, start *Token, arguments *Parser) (INodeTag,
 	}
 	spacelessNode.wrapper = wrapper
 
-	if arguments.Remaining() > 0 {
-		return nil, arguments.Error("Malformed spaceless-tag arguments.", nil)
+	for arguments.Remaining() > 0 {
+		option := arguments.MatchOne(TokenIdentifier, "collapse", "preserve")
+		if option == nil {
+			return nil, arguments.Error("Malformed spaceless-tag arguments.", nil)
+		}
+		switch option.Val {
+		case "collapse":
+			spacelessNode.collapse = true
+			spacelessNode.preserve = true
+		case "preserve":
+			spacelessNode.preserve = true
+		}
 	}
 
 	return spacelessNode, nil
@@ -5,6 +5,7 @@ import (
 )
 
 type tagSSINode struct {
+	position *Token
 	filename string
 	content  string
 	template *Template
@@ -17,9 +18,9 @@ func (node *tagSSINode) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 		includeCtx.Update(ctx.Public)
 		includeCtx.Update(ctx.Private)
 
-		err := node.template.execute(includeCtx, writer)
+		err := node.template.execute(includeCtx, writer, ctx.limits)
 		if err != nil {
-			return err.(*Error)
+			return err.(*Error).withFrames(node.position)
 		}
 	} else {
 		// Just print out the content
@@ -29,21 +30,30 @@ func (node *tagSSINode) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 }
 
 func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	SSINode := &tagSSINode{}
+	SSINode := &tagSSINode{position: start}
 
 	if fileToken := arguments.MatchType(TokenString); fileToken != nil {
 		SSINode.filename = fileToken.Val
 
 		if arguments.Match(TokenIdentifier, "parsed") != nil {
 			// parsed
-			temporaryTpl, err := doc.template.set.FromFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
+			temporaryTpl, err := doc.template.loadDependency(doc.template.set.resolveFilename(doc.template, fileToken.Val))
 			if err != nil {
 				return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, fileToken)
 			}
 			SSINode.template = temporaryTpl
 		} else {
 			// plaintext
-			buf, err := ioutil.ReadFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
+			filename := doc.template.set.resolveFilename(doc.template, fileToken.Val)
+			doc.template.trackDependency(filename)
+			fd, err := doc.template.set.getTemplateReader(filename)
+			if err != nil {
+				return nil, (&Error{
+					Sender:   "tag:ssi",
+					ErrorMsg: err.Error(),
+				}).updateFromTokenIfNeeded(doc.template, fileToken)
+			}
+			buf, err := ioutil.ReadAll(fd)
 			if err != nil {
 				return nil, (&Error{
 					Sender:   "tag:ssi",
@@ -0,0 +1,62 @@
+package pongo2
+
+type tagStaticNode struct {
+	position      *Token
+	pathEvaluator IEvaluator
+	name          string
+}
+
+func (node *tagStaticNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	path, err := node.pathEvaluator.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+
+	url := ctx.template.set.staticURL(path.String())
+
+	if node.name != "" {
+		ctx.Private[node.name] = url
+		return nil
+	}
+
+	if ctx.Autoescape {
+		escaped, err := ctx.escape(AsValue(url))
+		if err != nil {
+			return err
+		}
+		url = escaped.String()
+	}
+	writer.WriteString(url)
+
+	return nil
+}
+
+func tagStaticParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	staticNode := &tagStaticNode{
+		position: start,
+	}
+
+	pathEvaluator, err := arguments.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	staticNode.pathEvaluator = pathEvaluator
+
+	if arguments.Match(TokenKeyword, "as") != nil {
+		nameToken := arguments.MatchType(TokenIdentifier)
+		if nameToken == nil {
+			return nil, arguments.Error("Expected an identifier.", nil)
+		}
+		staticNode.name = nameToken.Val
+	}
+
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Malformed static-tag arguments.", nil)
+	}
+
+	return staticNode, nil
+}
+
+func init() {
+	RegisterTag("static", tagStaticParser)
+}
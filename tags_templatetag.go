@@ -1,5 +1,11 @@
 package pongo2
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type tagTemplateTagNode struct {
 	content string
 }
@@ -15,6 +21,16 @@ var templateTagMapping = map[string]string{
 	"closecomment":  "#}",
 }
 
+// templateTagArguments returns the valid arguments, sorted and comma-separated.
+func templateTagArguments() string {
+	names := make([]string, 0, len(templateTagMapping))
+	for name := range templateTagMapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
 func (node *tagTemplateTagNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	writer.WriteString(node.content)
 	return nil
@@ -26,7 +42,8 @@ func tagTemplateTagParser(doc *Parser, start *Token, arguments *Parser) (INodeTa
 	if argToken := arguments.MatchType(TokenIdentifier); argToken != nil {
 		output, found := templateTagMapping[argToken.Val]
 		if !found {
-			return nil, arguments.Error("Argument not found", argToken)
+			return nil, arguments.Error(fmt.Sprintf("Unknown templatetag-argument '%s' (expected one of: %s).",
+				argToken.Val, templateTagArguments()), argToken)
 		}
 		ttNode.content = output
 	} else {
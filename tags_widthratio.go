@@ -28,7 +28,11 @@ func (node *tagWidthratioNode) Execute(ctx *ExecutionContext, writer TemplateWri
 		return err
 	}
 
-	value := int(math.Ceil(current.Float()/max.Float()*width.Float() + 0.5))
+	// Rounded like Django does (half to even); a max value of zero yields 0
+	var value int
+	if max.Float() != 0 {
+		value = int(math.RoundToEven(current.Float() / max.Float() * width.Float()))
+	}
 
 	if node.ctxName == "" {
 		writer.WriteString(fmt.Sprintf("%d", value))
@@ -30,6 +30,7 @@ func tagWithParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Err
 		return nil, arguments.Error("Tag 'with' requires at least one argument.", nil)
 	}
 
+	bodyStart := doc.idx
 	wrapper, endargs, err := doc.WrapUntilTag("endwith")
 	if err != nil {
 		return nil, err
@@ -39,6 +40,8 @@ func tagWithParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Err
 	if endargs.Count() > 0 {
 		return nil, endargs.Error("Arguments not allowed here.", nil)
 	}
+	body := doc.tokens[bodyStart:doc.idx]
+	checkUsage := !includesTemplates(body)
 
 	// Scan through all arguments to see which style the user uses (old or new style).
 	// If we find any "as" keyword we will enforce old style; otherwise we will use new style.
@@ -64,6 +67,9 @@ func tagWithParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Err
 				return nil, arguments.Error("Expected an identifier", nil)
 			}
 			withNode.withPairs[keyToken.Val] = valueExpr
+			if checkUsage && !usesIdentifier(body, keyToken.Val) {
+				doc.template.warnf(keyToken, "Variable '%s' of the with-tag is never used.", keyToken.Val)
+			}
 		} else {
 			keyToken := arguments.MatchType(TokenIdentifier)
 			if keyToken == nil {
@@ -77,6 +83,9 @@ func tagWithParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Err
 				return nil, err
 			}
 			withNode.withPairs[keyToken.Val] = valueExpr
+			if checkUsage && !usesIdentifier(body, keyToken.Val) {
+				doc.template.warnf(keyToken, "Variable '%s' of the with-tag is never used.", keyToken.Val)
+			}
 		}
 	}
 
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
 )
 
 type TemplateWriter interface {
@@ -43,17 +46,61 @@ type Template struct {
 	blocks         map[string]*NodeWrapper
 	exportedMacros map[string]*tagMacroNode
 
+	// Set if the parent is determined during execution ({% extends variable %})
+	lazyExtends *tagExtendsNode
+
+	// Position of the extends tag (for Error.Stack)
+	extendsToken *Token
+
+	// The last cycle-tag parsed (for {% resetcycle %})
+	lastCycle *tagCycleNode
+
+	// Selected by the {% output %} pragma (nil to use the set's profile)
+	outputProfile *OutputProfile
+
+	// Tracks the HTML context while parsing (see
+	// TemplateSet.ContextualAutoescape)
+	htmlScanner *htmlContextScanner
+
+	// Found while compiling (see Warnings())
+	warnings []*Warning
+
+	// resolved filename -> modification time (zero if unknown) of all
+	// templates this one was compiled from (see loadDependency)
+	dependencies map[string]time.Time
+
+	// Names of the templates which led to the compilation of this one,
+	// ending with this template's name (see loadDependency)
+	includeChain []string
+
 	// Output
 	root *nodeDocument
 }
 
 func newTemplateString(set *TemplateSet, tpl []byte) (*Template, error) {
-	return newTemplate(set, "<string>", true, tpl)
+	return newTemplate(set, "<string>", true, tpl, nil)
 }
 
-func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*Template, error) {
+// includers are the names of the templates which (transitively) include,
+// extend or import the new template (nil for top-level templates).
+func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte, includers []string) (*Template, error) {
 	strTpl := string(tpl)
 
+	// Tokenize it
+	tokens, err := lex(name, strTpl)
+	if err != nil {
+		return nil, err
+	}
+
+	// For debugging purposes, show all tokens:
+	/*for i, t := range tokens {
+		fmt.Printf("%3d. %s\n", i, t)
+	}*/
+
+	return newTemplateFromTokens(set, name, isTplString, strTpl, tokens, includers)
+}
+
+func newTemplateFromTokens(set *TemplateSet, name string, isTplString bool, strTpl string, tokens []*Token, includers []string) (*Template, error) {
 	// Create the template
 	t := &Template{
 		set:            set,
@@ -61,99 +108,248 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 		name:           name,
 		tpl:            strTpl,
 		size:           len(strTpl),
+		tokens:         tokens,
 		blocks:         make(map[string]*NodeWrapper),
 		exportedMacros: make(map[string]*tagMacroNode),
+		dependencies:   make(map[string]time.Time),
+		includeChain:   append(includers[:len(includers):len(includers)], name),
 	}
 
-	// Tokenize it
-	tokens, err := lex(name, strTpl)
+	// Parse it
+	err := t.parse()
 	if err != nil {
 		return nil, err
 	}
-	t.tokens = tokens
 
-	// For debugging purposes, show all tokens:
-	/*for i, t := range tokens {
-		fmt.Printf("%3d. %s\n", i, t)
-	}*/
+	return t, nil
+}
 
-	// Parse it
-	err = t.parse()
+// loadDependency compiles a template this template depends on at compile
+// time (e. g. through extends or a static include) and keeps track of its
+// modification time, so FromCache() can detect outdated templates.
+func (tpl *Template) loadDependency(filename string) (*Template, error) {
+	if maxDepth := tpl.set.maxIncludeDepth(); len(tpl.includeChain) > maxDepth {
+		return nil, &Error{
+			Filename: tpl.name,
+			Sender:   "include",
+			ErrorMsg: fmt.Sprintf("Maximum include depth of %d exceeded: %s",
+				maxDepth, strings.Join(append(tpl.includeChain, filename), " -> ")),
+		}
+	}
+	tpl.trackDependency(filename)
+	dep, err := tpl.set.fromFile(filename, tpl.includeChain)
 	if err != nil {
 		return nil, err
 	}
+	for depFilename, modTime := range dep.dependencies {
+		tpl.dependencies[depFilename] = modTime
+	}
+	return dep, nil
+}
 
-	return t, nil
+// trackDependency remembers a file this template's compilation depends on
+// together with its current modification time (if the loader can report it).
+func (tpl *Template) trackDependency(filename string) {
+	filename = tpl.set.resolveFilename(nil, filename)
+	modTime, _ := tpl.set.templateModTime(filename)
+	tpl.dependencies[filename] = modTime
 }
 
-func (tpl *Template) execute(context Context, writer TemplateWriter) error {
+// prepareExecution creates the execution context to run the template (or
+// its outermost parent, for template inheritance) with.
+func (tpl *Template) prepareExecution(context Context, limits *executionLimits) (*ExecutionContext, *Error) {
 	// Determine the parent to be executed (for template inheritance)
 	parent := tpl
 	for parent.parent != nil {
 		parent = parent.parent
 	}
 
-	// Create context if none is given
-	newContext := make(Context)
-	newContext.Update(tpl.set.Globals)
+	// Neither the set's Globals nor the given context are copied, they are
+	// consulted by reference during the execution (see ExecutionContext.Lookup)
+	for _, c := range []Context{tpl.set.Globals, context} {
+		if len(c) == 0 {
+			continue
+		}
 
-	if context != nil {
-		newContext.Update(context)
+		// Check for context name syntax
+		err := c.checkForValidIdentifiers()
+		if err != nil {
+			return nil, err
+		}
 
-		if len(newContext) > 0 {
-			// Check for context name syntax
-			err := newContext.checkForValidIdentifiers()
-			if err != nil {
-				return err
+		// Check for clashes with macro names
+		for k := range c {
+			_, has := tpl.exportedMacros[k]
+			if has {
+				return nil, &Error{
+					Filename: tpl.name,
+					Sender:   "execution",
+					ErrorMsg: fmt.Sprintf("Context key name '%s' clashes with macro '%s'.", k, k),
+				}
 			}
+		}
+	}
 
-			// Check for clashes with macro names
-			for k := range newContext {
-				_, has := tpl.exportedMacros[k]
-				if has {
-					return &Error{
-						Filename: tpl.name,
-						Sender:   "execution",
-						ErrorMsg: fmt.Sprintf("Context key name '%s' clashes with macro '%s'.", k, k),
-					}
-				}
+	// The templates from tpl to the executed one (for Error.Stack)
+	var inheritance []*Template
+	for t := tpl; t != nil; t = t.parent {
+		inheritance = append(inheritance, t)
+	}
+
+	// Resolve parents given as variables; each of them is executed with the
+	// blocks of the templates extending it taking precedence
+	var extendedBy []*Template
+	for parent.lazyExtends != nil {
+		if maxDepth := tpl.set.maxIncludeDepth(); len(extendedBy) >= maxDepth {
+			return nil, &Error{
+				Filename: tpl.name,
+				Sender:   "extends",
+				ErrorMsg: fmt.Sprintf("Maximum include depth of %d exceeded.", maxDepth),
 			}
 		}
+
+		ctx := newExecutionContext(parent, context)
+		ctx.limits = limits
+		dynamicParent, err := parent.lazyExtends.loadParent(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		extendedBy = append(extendedBy, parent)
+		parent = dynamicParent
+		for t := parent; t != nil; t = t.parent {
+			inheritance = append(inheritance, t)
+		}
+		for parent.parent != nil {
+			parent = parent.parent
+		}
 	}
 
 	// Create operational context
-	ctx := newExecutionContext(parent, newContext)
+	ctx := newExecutionContext(parent, context)
+	ctx.limits = limits
+	ctx.extendedBy = extendedBy
+	ctx.inheritance = inheritance
+	return ctx, nil
+}
 
-	// Run the selected document
-	if err := parent.root.Execute(ctx, writer); err != nil {
+func (tpl *Template) execute(context Context, writer TemplateWriter, limits *executionLimits) error {
+	ctx, err := tpl.prepareExecution(context, limits)
+	if err != nil {
 		return err
 	}
 
+	// Run the selected document
+	if err := ctx.template.root.Execute(ctx, writer); err != nil {
+		return ctx.withInheritanceStack(err)
+	}
+
 	return nil
 }
 
+// withInheritanceStack prepends the positions of the extends tags leading
+// from the executed template to the one err occurred in to err's stack.
+func (ctx *ExecutionContext) withInheritanceStack(err *Error) *Error {
+	filename := err.outermostFilename()
+	for idx, t := range ctx.inheritance {
+		if t.name != filename {
+			continue
+		}
+		if idx == 0 {
+			return err
+		}
+		tokens := make([]*Token, 0, idx)
+		for _, derived := range ctx.inheritance[:idx] {
+			tokens = append(tokens, derived.extendsToken)
+		}
+		return err.withFrames(tokens...)
+	}
+	return err
+}
+
+// executeTopLevel starts a new execution, enforcing the set's and the
+// given options' limits.
+func (tpl *Template) executeTopLevel(context Context, writer TemplateWriter, opts ExecuteOptions) error {
+	limits := newExecutionLimits(tpl.set, opts)
+	return tpl.execute(context, limits.wrapWriter(writer), limits)
+}
+
 func (tpl *Template) newTemplateWriterAndExecute(context Context, writer io.Writer) error {
-	return tpl.execute(context, &templateWriter{w: writer})
+	return tpl.executeTopLevel(context, &templateWriter{w: writer}, ExecuteOptions{})
+}
+
+// Output buffers are pooled unless disabled using TemplateSet.DisableBufferPool
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
 }
 
-func (tpl *Template) newBufferAndExecute(context Context) (*bytes.Buffer, error) {
-	// Create output buffer
+// Larger buffers are left to the garbage collector instead of being pooled
+// to not keep huge buffers around after rendering a single huge page.
+const maxPooledBufferSize = 4 << 20
+
+func (tpl *Template) expectedOutputSize() int {
 	// We assume that the rendered template will be 30% larger
-	buffer := bytes.NewBuffer(make([]byte, 0, int(float64(tpl.size)*1.3)))
-	if err := tpl.execute(context, buffer); err != nil {
+	return int(float64(tpl.size) * 1.3)
+}
+
+func (tpl *Template) newBuffer() *bytes.Buffer {
+	size := tpl.expectedOutputSize()
+	if tpl.set.DisableBufferPool {
+		return bytes.NewBuffer(make([]byte, 0, size))
+	}
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	buffer.Grow(size)
+	return buffer
+}
+
+// releaseBuffer returns a buffer obtained by newBuffer to the pool. The
+// buffer must not be used afterwards.
+func (tpl *Template) releaseBuffer(buffer *bytes.Buffer) {
+	if tpl.set.DisableBufferPool || buffer.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buffer)
+}
+
+func (tpl *Template) newBufferAndExecute(context Context, opts ExecuteOptions) (*bytes.Buffer, error) {
+	buffer := tpl.newBuffer()
+	if err := tpl.executeTopLevel(context, buffer, opts); err != nil {
+		tpl.releaseBuffer(buffer)
 		return nil, err
 	}
 	return buffer, nil
 }
 
+// executeBuffered executes the template as part of a running execution
+// (e. g. an include) and writes its output to writer on success.
+func (tpl *Template) executeBuffered(context Context, writer io.Writer, limits *executionLimits) error {
+	buffer := tpl.newBuffer()
+	defer tpl.releaseBuffer(buffer)
+	limited := limits.wrapBuffer(buffer)
+	err := tpl.execute(context, limited, limits)
+	limited.release()
+	if err != nil {
+		return err
+	}
+	_, err = buffer.WriteTo(writer)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // Executes the template with the given context and writes to writer (io.Writer)
 // on success. Context can be nil. Nothing is written on error; instead the error
 // is being returned.
 func (tpl *Template) ExecuteWriter(context Context, writer io.Writer) error {
-	buf, err := tpl.newBufferAndExecute(context)
+	buf, err := tpl.newBufferAndExecute(context, ExecuteOptions{})
 	if err != nil {
 		return err
 	}
+	defer tpl.releaseBuffer(buf)
 	_, err = buf.WriteTo(writer)
 	if err != nil {
 		return err
@@ -170,11 +366,15 @@ func (tpl *Template) ExecuteWriterUnbuffered(context Context, writer io.Writer)
 	return tpl.newTemplateWriterAndExecute(context, writer)
 }
 
-// Executes the template and returns the rendered template as a []byte
+// Executes the template and returns the rendered template as a []byte.
+// Unlike Execute, the output isn't copied into a string, which saves an
+// allocation for large pages written to the network or hashed right away.
+// The returned slice is owned by the caller.
 func (tpl *Template) ExecuteBytes(context Context) ([]byte, error) {
-	// Execute template
-	buffer, err := tpl.newBufferAndExecute(context)
-	if err != nil {
+	// Execute template; the output buffer isn't taken from the pool since
+	// the returned slice refers to its memory
+	buffer := bytes.NewBuffer(make([]byte, 0, tpl.expectedOutputSize()))
+	if err := tpl.executeTopLevel(context, buffer, ExecuteOptions{}); err != nil {
 		return nil, err
 	}
 	return buffer.Bytes(), nil
@@ -183,11 +383,71 @@ func (tpl *Template) ExecuteBytes(context Context) ([]byte, error) {
 // Executes the template and returns the rendered template as a string
 func (tpl *Template) Execute(context Context) (string, error) {
 	// Execute template
-	buffer, err := tpl.newBufferAndExecute(context)
+	buffer, err := tpl.newBufferAndExecute(context, ExecuteOptions{})
 	if err != nil {
 		return "", err
 	}
+	defer tpl.releaseBuffer(buffer)
 
 	return buffer.String(), nil
 
 }
+
+// ExecuteBlock renders only the block named blockName (and the blocks nested
+// in it) without the surrounding layout, e. g. to serve partial page updates.
+// The block is looked up like during a normal execution: a block defined by
+// the template itself takes precedence over the ones of its parents.
+func (tpl *Template) ExecuteBlock(blockName string, context Context) (string, error) {
+	var wrapper *NodeWrapper
+	for t := tpl; t != nil && wrapper == nil; t = t.parent {
+		wrapper = t.blocks[blockName]
+	}
+	if wrapper == nil {
+		return "", &Error{
+			Filename: tpl.name,
+			Sender:   "execution",
+			ErrorMsg: fmt.Sprintf("Block '%s' not found.", blockName),
+		}
+	}
+
+	limits := newExecutionLimits(tpl.set, ExecuteOptions{})
+	ctx, err := tpl.prepareExecution(context, limits)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := tpl.newBuffer()
+	defer tpl.releaseBuffer(buffer)
+	if err := wrapper.Execute(ctx, limits.wrapWriter(buffer)); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// ExecuteOptions configures a single execution (see ExecuteWithOptions).
+type ExecuteOptions struct {
+	// Timeout aborts the execution with an error once it ran longer than
+	// this duration (zero means no limit). The error names the template
+	// element which was executed when time ran out.
+	Timeout time.Duration
+
+	// MaxLoopIterations overrides the set's MaxLoopIterations for this
+	// execution if non-zero (a negative value removes the limit).
+	MaxLoopIterations int
+
+	// Undefined overrides the set's policy for undefined variables for this
+	// execution if non-nil (see TemplateSet.Undefined).
+	Undefined UndefinedPolicy
+}
+
+// ExecuteWithOptions executes the template like Execute, but honors the
+// limits given in opts (in addition to the set's limits like MaxOutputSize).
+// Included templates count against the same limits.
+func (tpl *Template) ExecuteWithOptions(context Context, opts ExecuteOptions) (string, error) {
+	buffer, err := tpl.newBufferAndExecute(context, opts)
+	if err != nil {
+		return "", err
+	}
+	defer tpl.releaseBuffer(buffer)
+	return buffer.String(), nil
+}
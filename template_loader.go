@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 // LocalFilesystemLoader represents a local filesystem loader with basic
@@ -77,6 +82,43 @@ func (fs *LocalFilesystemLoader) Get(path string) (io.Reader, error) {
 	return bytes.NewReader(buf), nil
 }
 
+// Stat returns the modification time of the file at path.
+func (fs *LocalFilesystemLoader) Stat(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// Exists reports whether a file exists at path.
+func (fs *LocalFilesystemLoader) Exists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// List returns the paths of all files below the base directory. It fails
+// if no base directory is set.
+func (fs *LocalFilesystemLoader) List() ([]string, error) {
+	if fs.baseDir == "" {
+		return nil, fmt.Errorf("Templates can't be listed without a base directory.")
+	}
+	var paths []string
+	err := filepath.Walk(fs.baseDir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
 // Abs resolves a filename relative to the base directory. Absolute paths are allowed.
 // When there's no base dir set, the absolute path to the filename
 // will be calculated based on either the provided base directory (which
@@ -105,6 +147,236 @@ func (fs *LocalFilesystemLoader) Abs(base, name string) string {
 	return filepath.Join(fs.baseDir, name)
 }
 
+// FSLoader loads templates from any fs.FS (e. g. os.DirFS, embed.FS or
+// fstest.MapFS). All template names are resolved relative to the root of
+// the file system, so the root acts like a base directory and templates
+// can't escape it.
+type FSLoader struct {
+	fs fs.FS
+}
+
+// NewFSLoader creates a new FSLoader serving templates out of fsys.
+func NewFSLoader(fsys fs.FS) *FSLoader {
+	return &FSLoader{fs: fsys}
+}
+
+// Get reads the path's content from the underlying file system.
+func (l *FSLoader) Get(path string) (io.Reader, error) {
+	buf, err := fs.ReadFile(l.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(buf), nil
+}
+
+// Stat returns the modification time of the file at path. Some file systems
+// (like embed.FS) always report the zero time.
+func (l *FSLoader) Stat(path string) (time.Time, error) {
+	fi, err := fs.Stat(l.fs, path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// Exists reports whether a file exists at path.
+func (l *FSLoader) Exists(path string) bool {
+	fi, err := fs.Stat(l.fs, path)
+	return err == nil && !fi.IsDir()
+}
+
+// List returns the paths of all files in the file system.
+func (l *FSLoader) List() ([]string, error) {
+	var paths []string
+	err := fs.WalkDir(l.fs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// Abs resolves a filename relative to the root of the file system. The
+// including template's path (base) is ignored; leading slashes are removed
+// since fs.FS paths are always unrooted.
+func (l *FSLoader) Abs(base, name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// MemoryLoader serves templates from memory. It's useful to let templates
+// defined as strings include, extend or import each other by name. Like
+// the FSLoader, all names are resolved relative to the loader's root.
+// It's safe to call Set and Delete while templates are being loaded.
+type MemoryLoader struct {
+	templates map[string]string
+	modTimes  map[string]time.Time
+	mutex     sync.RWMutex
+}
+
+// NewMemoryLoader creates a new MemoryLoader, initially containing the
+// given templates (name -> template content). templates may be nil.
+func NewMemoryLoader(templates map[string]string) *MemoryLoader {
+	ml := &MemoryLoader{
+		templates: make(map[string]string, len(templates)),
+		modTimes:  make(map[string]time.Time, len(templates)),
+	}
+	for name, tpl := range templates {
+		ml.Set(name, tpl)
+	}
+	return ml
+}
+
+// Set adds or replaces the template with the given name.
+func (ml *MemoryLoader) Set(name, tpl string) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	name = ml.Abs("", name)
+	ml.templates[name] = tpl
+
+	// Make sure every update results in a new modification time,
+	// even on platforms with a coarse clock
+	modTime := time.Now()
+	if prev, has := ml.modTimes[name]; has && !modTime.After(prev) {
+		modTime = prev.Add(time.Nanosecond)
+	}
+	ml.modTimes[name] = modTime
+}
+
+// Delete removes the template with the given name.
+func (ml *MemoryLoader) Delete(name string) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	name = ml.Abs("", name)
+	delete(ml.templates, name)
+	delete(ml.modTimes, name)
+}
+
+// Get returns the template stored under path.
+func (ml *MemoryLoader) Get(path string) (io.Reader, error) {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	tpl, has := ml.templates[path]
+	if !has {
+		return nil, fmt.Errorf("Template '%s' not found.", path)
+	}
+	return strings.NewReader(tpl), nil
+}
+
+// Stat returns the time the template at path was set the last time.
+func (ml *MemoryLoader) Stat(path string) (time.Time, error) {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	modTime, has := ml.modTimes[path]
+	if !has {
+		return time.Time{}, fmt.Errorf("Template '%s' not found.", path)
+	}
+	return modTime, nil
+}
+
+// Exists reports whether a template is stored under path.
+func (ml *MemoryLoader) Exists(path string) bool {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	_, has := ml.templates[path]
+	return has
+}
+
+// List returns the names of all stored templates.
+func (ml *MemoryLoader) List() ([]string, error) {
+	ml.mutex.RLock()
+	defer ml.mutex.RUnlock()
+	names := make([]string, 0, len(ml.templates))
+	for name := range ml.templates {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Abs resolves a name relative to the loader's root. The including
+// template's path (base) is ignored.
+func (ml *MemoryLoader) Abs(base, name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// ChainLoader tries multiple loaders in order and returns the first template
+// found. It's useful for theme overrides, e. g. project templates shadowing
+// a vendor's default templates:
+//
+//     pongo2.NewChainLoader(projectLoader, vendorLoader)
+//
+// Template names are resolved relative to each loader's root (for
+// LocalFilesystemLoaders this means you should set a base directory);
+// the including template's path is ignored.
+type ChainLoader struct {
+	loaders []TemplateLoader
+}
+
+// NewChainLoader creates a new ChainLoader consulting the given loaders
+// in order.
+func NewChainLoader(loaders ...TemplateLoader) *ChainLoader {
+	return &ChainLoader{loaders: loaders}
+}
+
+// Get returns the template from the first loader that provides it.
+func (cl *ChainLoader) Get(path string) (io.Reader, error) {
+	errs := make([]string, 0, len(cl.loaders))
+	for _, loader := range cl.loaders {
+		fd, err := loader.Get(loader.Abs("", path))
+		if err == nil {
+			return fd, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("Template '%s' not found in any loader: %s", path, strings.Join(errs, "; "))
+}
+
+// Stat returns the modification time reported by the first loader
+// providing the template. It fails if any loader consulted before doesn't
+// implement TemplateLoaderWithMtime, since it can't tell which loader wins.
+func (cl *ChainLoader) Stat(path string) (time.Time, error) {
+	for _, loader := range cl.loaders {
+		mtimeLoader, ok := loader.(TemplateLoaderWithMtime)
+		if !ok {
+			return time.Time{}, fmt.Errorf("Loader %T does not report modification times.", loader)
+		}
+		modTime, err := mtimeLoader.Stat(loader.Abs("", path))
+		if err == nil {
+			return modTime, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Template '%s' not found in any loader.", path)
+}
+
+// Exists reports whether any of the loaders provides the template. Loaders
+// not implementing LoaderExists are asked for the template itself.
+func (cl *ChainLoader) Exists(path string) bool {
+	for _, loader := range cl.loaders {
+		if existsLoader, ok := loader.(LoaderExists); ok {
+			if existsLoader.Exists(loader.Abs("", path)) {
+				return true
+			}
+			continue
+		}
+		if _, err := loader.Get(loader.Abs("", path)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Abs cleans the name; the actual resolution is done by every single
+// loader in Get.
+func (cl *ChainLoader) Abs(base, name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
 // SandboxedFilesystemLoader is still WIP.
 type SandboxedFilesystemLoader struct {
 	*LocalFilesystemLoader
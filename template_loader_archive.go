@@ -0,0 +1,158 @@
+package pongo2
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ZipLoader serves templates directly out of a zip archive (e. g. a theme
+// bundle). Paths are resolved relative to the archive's root and can't
+// escape it.
+type ZipLoader struct {
+	*FSLoader
+	closer io.Closer
+}
+
+// NewZipLoader opens the zip archive at filename. Call Close once the
+// loader isn't needed anymore.
+func NewZipLoader(filename string) (*ZipLoader, error) {
+	rc, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &ZipLoader{
+		FSLoader: NewFSLoader(rc),
+		closer:   rc,
+	}, nil
+}
+
+// NewZipLoaderFromReader creates a ZipLoader reading the archive from r,
+// which is assumed to have the given size in bytes.
+func NewZipLoaderFromReader(r io.ReaderAt, size int64) (*ZipLoader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return &ZipLoader{
+		FSLoader: NewFSLoader(zr),
+	}, nil
+}
+
+// Close closes the underlying archive file (if opened by NewZipLoader).
+func (zl *ZipLoader) Close() error {
+	if zl.closer == nil {
+		return nil
+	}
+	return zl.closer.Close()
+}
+
+// TarLoader serves templates out of a (optionally gzip-compressed) tar
+// archive. The archive is read into memory once on creation. Paths are
+// resolved relative to the archive's root and can't escape it.
+type TarLoader struct {
+	files    map[string][]byte
+	modTimes map[string]time.Time
+}
+
+// NewTarLoader reads the tar archive (.tar or .tar.gz) at filename.
+func NewTarLoader(filename string) (*TarLoader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewTarLoaderFromReader(f)
+}
+
+// NewTarLoaderFromReader reads a tar archive (optionally gzip-compressed)
+// from r.
+func NewTarLoaderFromReader(r io.Reader) (*TarLoader, error) {
+	br := bufio.NewReader(r)
+
+	// Detect gzip compression by its magic number
+	var archive io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		archive = gr
+	}
+
+	tl := &TarLoader{
+		files:    make(map[string][]byte),
+		modTimes: make(map[string]time.Time),
+	}
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			// Skip directories, links and other special entries
+			continue
+		}
+		buf, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		name := tl.Abs("", hdr.Name)
+		tl.files[name] = buf
+		tl.modTimes[name] = hdr.ModTime
+	}
+	return tl, nil
+}
+
+// Get returns the content of the archived file at path.
+func (tl *TarLoader) Get(path string) (io.Reader, error) {
+	buf, has := tl.files[path]
+	if !has {
+		return nil, fmt.Errorf("Template '%s' not found in archive.", path)
+	}
+	return bytes.NewReader(buf), nil
+}
+
+// Stat returns the modification time of the archived file at path.
+func (tl *TarLoader) Stat(path string) (time.Time, error) {
+	modTime, has := tl.modTimes[path]
+	if !has {
+		return time.Time{}, fmt.Errorf("Template '%s' not found in archive.", path)
+	}
+	return modTime, nil
+}
+
+// Exists reports whether the archive contains a file at path.
+func (tl *TarLoader) Exists(path string) bool {
+	_, has := tl.files[path]
+	return has
+}
+
+// List returns the paths of all files in the archive.
+func (tl *TarLoader) List() ([]string, error) {
+	paths := make([]string, 0, len(tl.files))
+	for name := range tl.files {
+		paths = append(paths, name)
+	}
+	return paths, nil
+}
+
+// Abs resolves a name relative to the archive's root. The including
+// template's path (base) is ignored.
+func (tl *TarLoader) Abs(base, name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
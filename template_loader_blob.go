@@ -0,0 +1,201 @@
+package pongo2
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlobFetchFunc fetches the raw template stored under path from an object
+// storage (S3, GCS, ...). Missing objects should be reported with an error
+// wrapping fs.ErrNotExist so they can be cached negatively.
+type BlobFetchFunc func(path string) (io.ReadCloser, error)
+
+// DefaultBlobCacheEntries is the MaxEntries of new BlobLoaders.
+const DefaultBlobCacheEntries = 1000
+
+// BlobLoader is a generic loader for object storages. Backends only need
+// to provide a BlobFetchFunc; path resolution, caching of fetched (and
+// missing) templates and limiting the number of concurrent fetches are
+// done by the loader. Expired cache entries are dropped whenever a template
+// is fetched; the least recently used entries are evicted once there are
+// more than MaxEntries (paths might come from users, e. g. for missing
+// templates).
+//
+// Paths are resolved relative to the storage's root (the including
+// template's path is ignored), e. g. "mails/welcome.html".
+type BlobLoader struct {
+	fetch BlobFetchFunc
+	sem   chan struct{}
+
+	// CacheTTL is the duration a fetched template is served from memory
+	// before it's fetched again (zero disables the caching).
+	CacheTTL time.Duration
+
+	// NegativeCacheTTL is the duration a missing template is remembered as
+	// missing (zero disables the negative caching).
+	NegativeCacheTTL time.Duration
+
+	// Now returns the current time; it's used to expire cache entries
+	// (defaults to time.Now, replace it in tests).
+	Now func() time.Time
+
+	// MaxEntries bounds the number of cached (and missing) templates
+	// (defaults to DefaultBlobCacheEntries, zero means unbounded).
+	MaxEntries int
+
+	cache      map[string]*list.Element
+	lru        *list.List // of *blobLoaderEntry, most recently used first
+	cacheMutex sync.Mutex
+}
+
+type blobLoaderEntry struct {
+	path    string
+	content []byte // nil for missing templates
+	err     error
+	expires time.Time
+}
+
+// NewBlobLoader creates a new BlobLoader using fetch to retrieve templates.
+// maxConcurrent limits the number of fetches running at the same time
+// (zero or less means unlimited). Templates are cached for one minute,
+// missing templates for ten seconds; change CacheTTL and NegativeCacheTTL
+// to adjust this.
+func NewBlobLoader(fetch BlobFetchFunc, maxConcurrent int) *BlobLoader {
+	bl := &BlobLoader{
+		fetch:            fetch,
+		CacheTTL:         time.Minute,
+		NegativeCacheTTL: 10 * time.Second,
+		Now:              time.Now,
+		MaxEntries:       DefaultBlobCacheEntries,
+		cache:            make(map[string]*list.Element),
+		lru:              list.New(),
+	}
+	if maxConcurrent > 0 {
+		bl.sem = make(chan struct{}, maxConcurrent)
+	}
+	return bl
+}
+
+// Get returns the template stored under path, either from the cache or
+// by fetching it from the storage.
+func (bl *BlobLoader) Get(path string) (io.Reader, error) {
+	now := bl.Now()
+
+	if entry := bl.lookup(path, now); entry != nil {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return bytes.NewReader(entry.content), nil
+	}
+
+	buf, err := bl.fetchBlob(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && bl.NegativeCacheTTL > 0 {
+			bl.store(&blobLoaderEntry{path: path, err: err, expires: now.Add(bl.NegativeCacheTTL)}, now)
+		}
+		return nil, err
+	}
+	if bl.CacheTTL > 0 {
+		bl.store(&blobLoaderEntry{path: path, content: buf, expires: now.Add(bl.CacheTTL)}, now)
+	}
+	return bytes.NewReader(buf), nil
+}
+
+func (bl *BlobLoader) fetchBlob(path string) ([]byte, error) {
+	if bl.sem != nil {
+		bl.sem <- struct{}{}
+		defer func() { <-bl.sem }()
+	}
+
+	rc, err := bl.fetch(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	buf, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Reading template '%s' failed: %s", path, err)
+	}
+	return buf, nil
+}
+
+// lookup returns the cache entry of path unless it has expired (expired
+// entries are dropped).
+func (bl *BlobLoader) lookup(path string, now time.Time) *blobLoaderEntry {
+	bl.cacheMutex.Lock()
+	defer bl.cacheMutex.Unlock()
+	element, has := bl.cache[path]
+	if !has {
+		return nil
+	}
+	entry := element.Value.(*blobLoaderEntry)
+	if !now.Before(entry.expires) {
+		bl.remove(element)
+		return nil
+	}
+	bl.lru.MoveToFront(element)
+	return entry
+}
+
+// store caches the entry of a fetched template, dropping all expired
+// entries and the least recently used ones exceeding MaxEntries.
+func (bl *BlobLoader) store(entry *blobLoaderEntry, now time.Time) {
+	bl.cacheMutex.Lock()
+	defer bl.cacheMutex.Unlock()
+	for element := bl.lru.Front(); element != nil; {
+		next := element.Next()
+		if !now.Before(element.Value.(*blobLoaderEntry).expires) {
+			bl.remove(element)
+		}
+		element = next
+	}
+	if element, has := bl.cache[entry.path]; has {
+		element.Value = entry
+		bl.lru.MoveToFront(element)
+	} else {
+		bl.cache[entry.path] = bl.lru.PushFront(entry)
+	}
+	if bl.MaxEntries <= 0 {
+		return
+	}
+	for bl.lru.Len() > bl.MaxEntries {
+		bl.remove(bl.lru.Back())
+	}
+}
+
+// Len returns the number of cached (and missing) templates, including
+// expired ones which weren't dropped yet.
+func (bl *BlobLoader) Len() int {
+	bl.cacheMutex.Lock()
+	defer bl.cacheMutex.Unlock()
+	return bl.lru.Len()
+}
+
+// remove drops the cache entry; the caller must hold the mutex.
+func (bl *BlobLoader) remove(element *list.Element) {
+	bl.lru.Remove(element)
+	delete(bl.cache, element.Value.(*blobLoaderEntry).path)
+}
+
+// Exists reports whether the template at path exists. Only templates the
+// storage reports as missing (see BlobFetchFunc) don't exist; other
+// failures (like timeouts) are reported when the template is loaded.
+func (bl *BlobLoader) Exists(path string) bool {
+	_, err := bl.Get(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// Abs resolves a name relative to the storage's root.
+func (bl *BlobLoader) Abs(base, name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
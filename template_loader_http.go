@@ -0,0 +1,156 @@
+package pongo2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPLoader fetches templates from a remote HTTP(S) server (e. g. a central
+// asset service). Fetched templates are kept in memory together with their
+// ETag/Last-Modified headers; subsequent requests for the same template are
+// conditional and reuse the kept content if the server answers with
+// 304 Not Modified.
+//
+// Template names are resolved relative to the base URL. Requests for URLs
+// outside of the base URL are refused.
+type HTTPLoader struct {
+	baseURL *url.URL
+
+	// Client is used to perform the requests. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+
+	// Timeout limits the duration of a single fetch (zero means no limit
+	// besides the client's own timeout).
+	Timeout time.Duration
+
+	cache      map[string]*httpLoaderEntry
+	cacheMutex sync.Mutex
+}
+
+type httpLoaderEntry struct {
+	etag         string
+	lastModified string
+	content      []byte
+}
+
+// NewHTTPLoader creates a new HTTPLoader for templates located below
+// the given base URL.
+func NewHTTPLoader(baseURL string) (*HTTPLoader, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("The base URL '%s' must use http or https.", baseURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		// Make sure relative references resolve below the base path
+		u.Path += "/"
+	}
+	return &HTTPLoader{
+		baseURL: u,
+		cache:   make(map[string]*httpLoaderEntry),
+	}, nil
+}
+
+// Abs resolves a template name to a URL relative to the loader's base URL.
+// Absolute URLs are passed through (and checked against the base URL in Get).
+func (l *HTTPLoader) Abs(base, name string) string {
+	ref, err := url.Parse(name)
+	if err != nil {
+		return name
+	}
+	if ref.IsAbs() {
+		return ref.String()
+	}
+	ref.Path = strings.TrimPrefix(ref.Path, "/")
+	return l.baseURL.ResolveReference(ref).String()
+}
+
+// withinBase reports whether rawURL points below the base URL. The path is
+// cleaned first, so "../" segments can't leave the base path.
+func (l *HTTPLoader) withinBase(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, l.baseURL.Scheme) || !strings.EqualFold(u.Host, l.baseURL.Host) {
+		return false
+	}
+	return strings.HasPrefix(pathpkg.Clean("/"+u.Path), l.baseURL.Path)
+}
+
+// Get fetches the template from the remote server. Previously fetched
+// templates are revalidated using If-None-Match/If-Modified-Since.
+func (l *HTTPLoader) Get(path string) (io.Reader, error) {
+	if !l.withinBase(path) {
+		return nil, fmt.Errorf("URL '%s' is outside of the base URL '%s'.", path, l.baseURL.String())
+	}
+
+	l.cacheMutex.Lock()
+	entry := l.cache[path]
+	l.cacheMutex.Unlock()
+
+	ctx := context.Background()
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if entry != nil {
+		if entry.etag != "" {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+		if entry.lastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		return bytes.NewReader(entry.content), nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("Fetching '%s' failed: %s", path, resp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	l.cacheMutex.Lock()
+	l.cache[path] = &httpLoaderEntry{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		content:      buf,
+	}
+	l.cacheMutex.Unlock()
+
+	return bytes.NewReader(buf), nil
+}
@@ -0,0 +1,87 @@
+package pongo2
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+// Version of the format written by Template.MarshalBinary; bump it whenever
+// prelexedTemplate or Token changes.
+const prelexedTemplateVersion = 1
+
+type prelexedTemplate struct {
+	Version     int
+	Name        string
+	IsTplString bool
+	Source      string
+	Tokens      []*Token
+}
+
+// MarshalBinary serializes the template's name, source and token stream
+// (e. g. at build time) so it can be loaded again using
+// TemplateSet.LoadPrelexed without lexing it once more.
+//
+// Serializing compiled templates, i. e. skipping the parsing as well, isn't
+// supported: the parsed tree consists of the nodes of any tags registered
+// (including third-party and per-set ones), which hold unexported state,
+// evaluators and references to other templates that can't be serialized in
+// general. The template is parsed again when it's loaded; to keep that off
+// the request path, compile the templates at startup using
+// TemplateSet.PreloadDir() or CompileGlob().
+func (tpl *Template) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&prelexedTemplate{
+		Version:     prelexedTemplateVersion,
+		Name:        tpl.name,
+		IsTplString: tpl.isTplString,
+		Source:      tpl.tpl,
+		Tokens:      tpl.tokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadPrelexed loads a template serialized by Template.MarshalBinary. Only
+// lexing is skipped; the token stream is parsed as usual, which resolves
+// extends, includes and imports through the set's loader. Templates loaded
+// from files are stored in the set's cache, so FromCache() returns them
+// without touching the loader.
+func (set *TemplateSet) LoadPrelexed(data []byte) (*Template, error) {
+	var ct prelexedTemplate
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ct); err != nil {
+		return nil, &Error{
+			Sender:   "loadprelexed",
+			ErrorMsg: fmt.Sprintf("Invalid pre-lexed template: %s", err),
+		}
+	}
+	if ct.Version != prelexedTemplateVersion {
+		return nil, &Error{
+			Filename: ct.Name,
+			Sender:   "loadprelexed",
+			ErrorMsg: fmt.Sprintf("Pre-lexed template has version %d, expected version %d.", ct.Version, prelexedTemplateVersion),
+		}
+	}
+
+	set.firstTemplateCreated = true
+	start := time.Now()
+	tpl, err := newTemplateFromTokens(set, ct.Name, ct.IsTplString, ct.Source, ct.Tokens, nil)
+	if err != nil {
+		return nil, err
+	}
+	compileTime := time.Since(start)
+
+	if !ct.IsTplString {
+		cleanedFilename := set.resolveFilename(nil, ct.Name)
+		modTime, _ := set.templateModTime(cleanedFilename)
+
+		set.templateCacheMutex.Lock()
+		set.storeInCache(set.cacheKey(cleanedFilename), newTemplateCacheEntry(cleanedFilename, tpl, modTime, compileTime))
+		set.templateCacheMutex.Unlock()
+	}
+
+	return tpl, nil
+}
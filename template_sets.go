@@ -1,13 +1,21 @@
 package pongo2
 
 import (
+	"container/list"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // TemplateLoader allows to implement a virtual file system.
@@ -20,16 +28,57 @@ type TemplateLoader interface {
 	Get(path string) (io.Reader, error)
 }
 
+// TemplateLoaderWithMtime is an optional interface a TemplateLoader can
+// implement to report when a template was modified the last time. If the
+// set's loader implements it, FromCache() recompiles cached templates
+// whose source changed since they were compiled.
+type TemplateLoaderWithMtime interface {
+	TemplateLoader
+
+	// Stat returns the modification time of the template at path (as
+	// returned by Abs).
+	Stat(path string) (time.Time, error)
+}
+
+// LoaderExists is an optional interface a TemplateLoader can implement to
+// cheaply check whether a template exists. It's used by optional includes
+// ({% include "x.html" ignore missing %}) to distinguish missing templates
+// from templates which fail to load or compile.
+type LoaderExists interface {
+	// Exists reports whether the template at path (as returned by Abs) exists.
+	Exists(path string) bool
+}
+
+// Used if TemplateSet.MaxIncludeDepth is zero
+const defaultMaxIncludeDepth = 100
+
+// LoaderLister is an optional interface a TemplateLoader can implement to
+// enumerate its templates. It's required by PreloadDir() and CompileGlob().
+type LoaderLister interface {
+	// List returns the paths (as returned by Abs) of all templates.
+	List() ([]string, error)
+}
+
 // TemplateSet allows you to create your own group of templates with their own
 // global context (which is shared among all members of the set) and their own
 // configuration.
 // It's useful for a separation of different kind of templates
 // (e. g. web templates vs. mail templates).
 type TemplateSet struct {
-	name   string
-	loader TemplateLoader
+	// Cache statistics, accessed atomically (first in the struct to keep
+	// them 64-bit aligned on 32-bit platforms)
+	cacheHits   uint64
+	cacheMisses uint64
+
+	name       string
+	loader     TemplateLoader
+	namespaces map[string]TemplateLoader
 
-	// Globals will be provided to all templates created within this template set
+	// Globals will be provided to all templates created within this template set.
+	// They aren't copied for every execution but looked up by reference after
+	// the execution's context (which shadows them). Executions only read
+	// Globals, so it's safe to render concurrently as long as Globals isn't
+	// modified while templates are being executed.
 	Globals Context
 
 	// If debug is true (default false), ExecutionContext.Logf() will work and output
@@ -38,6 +87,134 @@ type TemplateSet struct {
 	// variable during program execution (and template compilation/execution).
 	Debug bool
 
+	// If CacheCheckModTime is true and the set's loader implements
+	// TemplateLoaderWithMtime, FromCache() checks the modification times of
+	// a cached template and of all its dependencies (extended, included,
+	// imported templates) on every call and recompiles it if any changed.
+	// It's off by default since every cache hit stats all these files.
+	CacheCheckModTime bool
+
+	// CacheTTL limits how long FromCache() serves a cached template before
+	// it's compiled again (default zero: cached templates never expire).
+	// It bounds the staleness of templates served by loaders which can't
+	// report modification times.
+	CacheTTL time.Duration
+
+	// CacheKeyFunc, if set, computes the key FromCache() caches a template
+	// under from its resolved filename (the default key). Use it to cache
+	// variants of the same path separately if the loader returns different
+	// content based on out-of-band state, e. g. per locale or tenant:
+	//
+	//     set.CacheKeyFunc = func(filename string) string {
+	//         return currentLocale() + ":" + filename
+	//     }
+	CacheKeyFunc func(filename string) string
+
+	// MaxOutputSize aborts executions with an error once the rendered
+	// output exceeds this number of bytes (default zero: no limit).
+	// Bodies rendered into memory first (like the ones of {% filter %} or
+	// includes) count towards it, too. Useful for user-editable templates.
+	MaxOutputSize int
+
+	// MaxLoopIterations limits the total number of {% for %} iterations of
+	// an execution, including those of included templates (default zero:
+	// no limit). It can be overridden per execution using ExecuteOptions.
+	MaxLoopIterations int
+
+	// LoopLimitError, if set, creates the error returned once
+	// MaxLoopIterations is exceeded. If it returns an *Error, the location
+	// of the loop is added unless already set.
+	LoopLimitError func(limit int) error
+
+	// MaxIncludeDepth limits how deeply templates may include, extend or
+	// import each other (zero means the default of 100), protecting against
+	// (accidentally) recursive templates. The error reports the full chain
+	// of templates.
+	MaxIncludeDepth int
+
+	// Execute, ExecuteWriter and includes render into output buffers taken
+	// from a pool shared by all sets to reduce allocations. Set
+	// DisableBufferPool to true to allocate a fresh buffer per execution.
+	DisableBufferPool bool
+
+	// NowFunc, if set, returns the current time used by {% now %} and the
+	// time filters (timesince, timeuntil, naturaltime and naturalday;
+	// default: time.Now). Inject a fixed clock for tests or deterministic
+	// builds.
+	NowFunc func() time.Time
+
+	// StaticURL is prepended to the asset paths rendered by {% static %},
+	// e. g. "/static/" or "https://cdn.example.com/assets/".
+	StaticURL string
+
+	// StaticManifest optionally maps asset paths (relative to StaticURL,
+	// e. g. "css/app.css") to their fingerprinted names (e. g.
+	// "css/app.3f2a9c.css") for cache busting. Paths missing in the
+	// manifest are rendered unchanged.
+	StaticManifest map[string]string
+
+	// CSRFTokenFunc returns the CSRF token {% csrf_token %} renders as a
+	// hidden form field. It receives the context the template is executed
+	// with (e. g. to look up the current request or session). Using
+	// {% csrf_token %} without a CSRFTokenFunc is an execution error.
+	CSRFTokenFunc func(ctx Context) string
+
+	// CSRFFieldName is the name of the hidden field rendered by
+	// {% csrf_token %} (default: "csrfmiddlewaretoken").
+	CSRFFieldName string
+
+	// NonceFunc returns the Content-Security-Policy nonce of the current
+	// request, which {% nonce %} renders and {% nonce_script %} and
+	// {% nonce_style %} add to their elements. Like CSRFTokenFunc, it receives the context
+	// the template is executed with and is called each time the nonce is
+	// rendered, so it must return the same nonce during a request. Using
+	// these tags without a NonceFunc is an execution error.
+	NonceFunc func(ctx Context) string
+
+	// FragmentCache stores the fragments rendered by {% cache %}. NewSet
+	// initializes it with a MemoryCacheBackend; set it to nil to disable
+	// fragment caching (fragments are rendered on every execution then).
+	FragmentCache CacheBackend
+
+	// AutoescapeDefault is whether the set's templates are autoescaped
+	// unless turned off using {% autoescape off %} (NewSet() enables it).
+	// Disable it for sets producing other output than HTML, e. g. plain-text
+	// emails (see also SetOutputProfile(), which sets it to the profile's
+	// default).
+	AutoescapeDefault bool
+
+	// Undefined is the policy for variables missing from the context and
+	// attributes missing from structs or maps (SilentUndefined by default,
+	// StrictUndefined, WarnUndefined, DebugUndefined, a *LoggingUndefined or
+	// your own). Variables explicitly set to nil are defined. It can be
+	// overridden for a single execution using ExecuteOptions.Undefined.
+	// Variables whose first filter provides a default (default,
+	// default_if_none or coalesce) may always be undefined:
+	// {{ title|default:"Untitled" }}
+	Undefined UndefinedPolicy
+
+	// MissingAttribute, if set, is the policy for fields missing from
+	// structs and keys missing from maps (like {{ user.nmae }}), so these
+	// can be handled differently than variables missing from the context,
+	// e. g. using StrictUndefined or WarnUndefined. It takes precedence
+	// over Undefined for them.
+	MissingAttribute UndefinedPolicy
+
+	// ContextualAutoescape makes the autoescaping pick the escaper by the
+	// HTML context a variable is output in, like html/template does:
+	// JavaScript escaping in <script> elements and event handler attributes
+	// (onclick etc.), CSS escaping in <style> elements and style attributes,
+	// URL sanitizing and encoding in URL attributes (href, src etc.) and HTML
+	// escaping anywhere else. Values of unquoted attributes are encoded
+	// as character references except for letters and digits in addition.
+	// Without it, variables output in event handler attributes or
+	// unquoted attribute values are reported as warnings (logged if Debug
+	// is enabled). The context is determined when a template is
+	// compiled by scanning its text in source order, so the branches of
+	// tags like {% if %} are expected to leave the same context behind.
+	// Explicit modes like {% autoescape js %} take precedence.
+	ContextualAutoescape bool
+
 	// Sandbox features
 	// - Disallow access to specific tags and/or filters (using BanTag() and BanFilter())
 	//
@@ -48,23 +225,127 @@ type TemplateSet struct {
 	bannedTags           map[string]bool
 	bannedFilters        map[string]bool
 
+	// Custom tags only available to this set's templates (see RegisterTag())
+	tags map[string]*tag
+
+	// Filters bound to this set, shadowing the global ones
+	filters map[string]*filter
+
+	// Renderer of the markdown filter (see SetMarkdownRenderer())
+	markdownRenderer func(string) (string, error)
+	markdownSafe     bool
+
+	// Sanitizer of the sanitize filter (see SetSanitizer())
+	sanitizer Sanitizer
+
+	// Escaper of the escape filter and the autoescaping (see SetEscaper())
+	escaper func(string) string
+
+	// See SetOutputProfile()
+	outputProfile *OutputProfile
+
+	// See OnExecutionError()
+	executionErrorHandler func(err *Error, ctx *ExecutionContext) (string, bool)
+
+	// See OnWarning()
+	warningHandler func(w *Warning)
+
+	// See SetUrlizeRel()
+	urlizeRel string
+
+	// See SetSlugTransliterator()
+	slugTransliterator func(r rune) (string, bool)
+
+	// See SetMoneyFormatter()
+	moneyFormatter func(amount float64, currency string, locale string) (string, error)
+
+	// See SetNumberSeparators()
+	thousandSeparator string
+	decimalSeparator  string
+
 	// Template cache (for FromCache())
-	templateCache      map[string]*Template
-	templateCacheMutex sync.Mutex
+	templateCache      map[string]*templateCacheEntry
+	templateCacheMutex sync.RWMutex
+	cacheCalls         map[string]*templateCacheCall // compilations in progress
+	cacheCapacity      int                           // zero means unbounded
+	cacheLRU           *list.List                    // of cache keys, most recently used first
+	cacheEvictions     uint64
+}
+
+type templateCacheEntry struct {
+	tpl         *Template
+	compiled    time.Time
+	compileTime time.Duration
+	element     *list.Element // position in the set's cacheLRU
+
+	// Modification times of the template and all its dependencies at
+	// compilation time (zero for those the loaders can't report them)
+	modTimes map[string]time.Time
+}
+
+// templateCacheCall is a compilation in progress; concurrent FromCache()
+// calls for the same template wait for it instead of compiling it again.
+type templateCacheCall struct {
+	wg  sync.WaitGroup
+	tpl *Template
+	err error
+}
+
+func newTemplateCacheEntry(filename string, tpl *Template, modTime time.Time, compileTime time.Duration) *templateCacheEntry {
+	entry := &templateCacheEntry{
+		tpl:         tpl,
+		compiled:    time.Now(),
+		compileTime: compileTime,
+		modTimes:    make(map[string]time.Time, len(tpl.dependencies)+1),
+	}
+	for dep, depModTime := range tpl.dependencies {
+		entry.modTimes[dep] = depModTime
+	}
+	entry.modTimes[filename] = modTime
+	return entry
 }
 
 // NewSet can be used to create sets with different kind of templates
 // (e. g. web from mail templates), with different globals or
 // other configurations.
 func NewSet(name string, loader TemplateLoader) *TemplateSet {
-	return &TemplateSet{
+	set := &TemplateSet{
 		name:          name,
 		loader:        loader,
+		namespaces:    make(map[string]TemplateLoader),
 		Globals:       make(Context),
 		bannedTags:    make(map[string]bool),
 		bannedFilters: make(map[string]bool),
-		templateCache: make(map[string]*Template),
+		tags:          make(map[string]*tag),
+		templateCache: make(map[string]*templateCacheEntry),
+		cacheCalls:    make(map[string]*templateCacheCall),
+		cacheLRU:      list.New(),
+		FragmentCache: NewMemoryCacheBackend(),
+		outputProfile: OutputHTML,
+
+		urlizeRel:         "nofollow",
+		thousandSeparator: ",",
+		decimalSeparator:  ".",
+
+		AutoescapeDefault: true,
+	}
+	set.filters = map[string]*filter{
+		"markdown": {fn: set.filterMarkdown},
+		"sanitize": {fn: set.filterSanitize, signature: FilterSignature{MaxArgs: 1}},
+		"escape":   {fn: set.filterEscape, signature: FilterSignature{MaxArgs: 1}},
+	}
+	return set
+}
+
+// Separates a namespace from the template's path, e. g. "admin::layout.html"
+const namespaceSeparator = "::"
+
+func splitNamespace(path string) (namespace, name string, ok bool) {
+	idx := strings.Index(path, namespaceSeparator)
+	if idx < 0 {
+		return "", path, false
 	}
+	return path[:idx], path[idx+len(namespaceSeparator):], true
 }
 
 func (set *TemplateSet) resolveFilename(tpl *Template, path string) string {
@@ -75,12 +356,349 @@ func (set *TemplateSet) resolveFilename(tpl *Template, path string) string {
 	if tpl != nil {
 		name = tpl.name
 	}
+
+	baseNamespace, baseName, baseHasNamespace := splitNamespace(name)
+	if namespace, nsPath, ok := splitNamespace(path); ok {
+		if loader, has := set.namespaces[namespace]; has {
+			if baseNamespace != namespace {
+				// Paths are only relative to templates of the same namespace
+				baseName = ""
+			}
+			return namespace + namespaceSeparator + loader.Abs(baseName, nsPath)
+		}
+	}
+	if baseHasNamespace {
+		// The base template belongs to another loader
+		name = ""
+	}
 	return set.loader.Abs(name, path)
 }
 
+// getTemplateReader returns the content of an already resolved template
+// path using either the set's loader or the one of the path's namespace.
+func (set *TemplateSet) getTemplateReader(resolvedPath string) (io.Reader, error) {
+	if namespace, nsPath, ok := splitNamespace(resolvedPath); ok {
+		if loader, has := set.namespaces[namespace]; has {
+			return loader.Get(nsPath)
+		}
+	}
+	return set.loader.Get(resolvedPath)
+}
+
+// templateModTime returns the modification time of an already resolved
+// template path if its loader implements TemplateLoaderWithMtime.
+func (set *TemplateSet) templateModTime(resolvedPath string) (time.Time, bool) {
+	loader := set.loader
+	if namespace, nsPath, ok := splitNamespace(resolvedPath); ok {
+		if nsLoader, has := set.namespaces[namespace]; has {
+			loader = nsLoader
+			resolvedPath = nsPath
+		}
+	}
+	mtimeLoader, ok := loader.(TemplateLoaderWithMtime)
+	if !ok {
+		return time.Time{}, false
+	}
+	modTime, err := mtimeLoader.Stat(resolvedPath)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return modTime, true
+}
+
+// isOutdated reports whether the source of a cached template or of any of
+// its dependencies (extended, included, imported templates) changed.
+func (set *TemplateSet) isOutdated(entry *templateCacheEntry) bool {
+	for filename, modTime := range entry.modTimes {
+		currentModTime, ok := set.templateModTime(filename)
+		if ok && !currentModTime.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpired reports whether a cached template is older than CacheTTL.
+func (set *TemplateSet) isExpired(entry *templateCacheEntry) bool {
+	return set.CacheTTL > 0 && time.Since(entry.compiled) >= set.CacheTTL
+}
+
+// templateExists reports whether an already resolved template path exists.
+// known is false if the responsible loader doesn't implement LoaderExists.
+func (set *TemplateSet) templateExists(resolvedPath string) (exists bool, known bool) {
+	loader := set.loader
+	if namespace, nsPath, ok := splitNamespace(resolvedPath); ok {
+		if nsLoader, has := set.namespaces[namespace]; has {
+			loader = nsLoader
+			resolvedPath = nsPath
+		}
+	}
+	existsLoader, ok := loader.(LoaderExists)
+	if !ok {
+		return false, false
+	}
+	return existsLoader.Exists(resolvedPath), true
+}
+
+// RegisterNamespace routes all template paths prefixed with "<prefix>::"
+// (e. g. "admin::layout.html") to the given loader, for FromFile/FromCache
+// as well as for include, extends, import and ssi. Relative paths are
+// resolved within the namespace of the including template only.
+func (set *TemplateSet) RegisterNamespace(prefix string, loader TemplateLoader) error {
+	if prefix == "" || strings.Contains(prefix, namespaceSeparator) {
+		return fmt.Errorf("Namespace '%s' is not a valid namespace prefix.", prefix)
+	}
+	if _, has := set.namespaces[prefix]; has {
+		return fmt.Errorf("Namespace '%s' is already registered.", prefix)
+	}
+	set.namespaces[prefix] = loader
+	return nil
+}
+
+// now returns the set's current time; set may be nil (see
+// newSetParamFilter).
+func (set *TemplateSet) now() time.Time {
+	if set != nil && set.NowFunc != nil {
+		return set.NowFunc()
+	}
+	return time.Now()
+}
+
+// staticURL returns the URL of the asset at path (see StaticURL and
+// StaticManifest).
+func (set *TemplateSet) staticURL(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if hashed, has := set.StaticManifest[path]; has {
+		path = hashed
+	}
+	if set.StaticURL == "" {
+		return path
+	}
+	return strings.TrimSuffix(set.StaticURL, "/") + "/" + path
+}
+
+func (set *TemplateSet) csrfFieldName() string {
+	if set.CSRFFieldName == "" {
+		return "csrfmiddlewaretoken"
+	}
+	return set.CSRFFieldName
+}
+
+func (set *TemplateSet) maxIncludeDepth() int {
+	if set.MaxIncludeDepth > 0 {
+		return set.MaxIncludeDepth
+	}
+	return defaultMaxIncludeDepth
+}
+
+// RegisterTag registers a new tag which is only available to the templates
+// of this set, unlike the global RegisterTag() which adds the tag to all
+// sets. It returns an error if a tag with the same name is already
+// registered (globally or for this set). Like with BanTag(), tags must be
+// registered before the first template is added to the set.
+func (set *TemplateSet) RegisterTag(name string, parserFn TagParser) error {
+	if set.firstTemplateCreated {
+		return errors.New("You cannot register any tags after you've added your first template to your template set.")
+	}
+	if _, has := tags[name]; has {
+		return fmt.Errorf("Tag '%s' is already registered.", name)
+	}
+	if _, has := set.tags[name]; has {
+		return fmt.Errorf("Tag '%s' is already registered for this set.", name)
+	}
+	set.tags[name] = &tag{
+		name:   name,
+		parser: parserFn,
+	}
+	return nil
+}
+
+// RegisterSimpleTag registers a simple tag (see the global
+// RegisterSimpleTag()) which is only available to the templates of this
+// set. The same restrictions as for RegisterTag() apply.
+func (set *TemplateSet) RegisterSimpleTag(name string, fn SimpleTagFunction) error {
+	return set.RegisterTag(name, simpleTagParser(name, fn))
+}
+
+// ReplaceTag replaces a tag (either a built-in/globally registered one or
+// one registered for this set) with a new implementation for the templates
+// of this set only; other sets keep using the original tag. It returns an
+// error if there's no tag with the given name. Like RegisterTag(), it must
+// be called before the first template is added to the set.
+func (set *TemplateSet) ReplaceTag(name string, parserFn TagParser) error {
+	if set.firstTemplateCreated {
+		return errors.New("You cannot replace any tags after you've added your first template to your template set.")
+	}
+	if _, has := set.lookupTag(name); !has {
+		return fmt.Errorf("Tag '%s' does not exist (therefore cannot be overridden).", name)
+	}
+	set.tags[name] = &tag{
+		name:   name,
+		parser: parserFn,
+	}
+	return nil
+}
+
+// RegisterFilter registers a new filter which is only available to the
+// templates of this set, unlike the global RegisterFilter() which adds the
+// filter to all sets. It returns an error if a filter with the same name is
+// already registered (globally or for this set). Like with BanFilter(),
+// filters must be registered before the first template is added to the set.
+func (set *TemplateSet) RegisterFilter(name string, fn FilterFunction) error {
+	return set.registerFilter(name, newParamFilter(fn))
+}
+
+// RegisterFilterWithArgs registers a filter taking the arguments declared
+// by signature (see the global RegisterFilterWithArgs()) which is only
+// available to the templates of this set. The same restrictions as for
+// RegisterFilter() apply.
+func (set *TemplateSet) RegisterFilterWithArgs(name string, signature FilterSignature, fn FilterArgsFunction) error {
+	return set.registerFilter(name, newArgsFilter(signature, fn))
+}
+
+// RegisterContextFilter registers a context-aware filter (see the global
+// RegisterContextFilter()) which is only available to the templates of this
+// set. The same restrictions as for RegisterFilter() apply.
+func (set *TemplateSet) RegisterContextFilter(name string, signature FilterSignature, fn FilterContextFunction) error {
+	return set.registerFilter(name, &filter{fn: fn, signature: signature})
+}
+
+func (set *TemplateSet) registerFilter(name string, f *filter) error {
+	if set.firstTemplateCreated {
+		return errors.New("You cannot register any filters after you've added your first template to your template set.")
+	}
+	if _, has := filters[name]; has {
+		return fmt.Errorf("Filter '%s' is already registered.", name)
+	}
+	if _, has := set.filters[name]; has {
+		return fmt.Errorf("Filter '%s' is already registered for this set.", name)
+	}
+	set.filters[name] = f
+	return nil
+}
+
+// ReplaceFilter replaces a filter (either a built-in/globally registered one
+// or one registered for this set) with a new implementation for the
+// templates of this set only; other sets keep using the original filter. It
+// returns an error if there's no filter with the given name. Like
+// RegisterFilter(), it must be called before the first template is added to
+// the set.
+func (set *TemplateSet) ReplaceFilter(name string, fn FilterFunction) error {
+	return set.replaceFilter(name, newParamFilter(fn))
+}
+
+// ReplaceFilterWithArgs is like ReplaceFilter() but replaces the filter with
+// one taking the arguments declared by signature.
+func (set *TemplateSet) ReplaceFilterWithArgs(name string, signature FilterSignature, fn FilterArgsFunction) error {
+	return set.replaceFilter(name, newArgsFilter(signature, fn))
+}
+
+func (set *TemplateSet) replaceFilter(name string, f *filter) error {
+	if set.firstTemplateCreated {
+		return errors.New("You cannot replace any filters after you've added your first template to your template set.")
+	}
+	if _, has := set.lookupFilter(name); !has {
+		return fmt.Errorf("Filter '%s' does not exist (therefore cannot be overridden).", name)
+	}
+	set.filters[name] = f
+	return nil
+}
+
+// AliasFilter makes the filter called name (either a global one or one
+// registered for this set) available to the templates of this set under
+// the additional name alias. It returns an error if there's no filter
+// called name or if alias is already taken. Like RegisterFilter(), it must
+// be called before the first template is added to the set.
+func (set *TemplateSet) AliasFilter(alias string, name string) error {
+	f, has := set.lookupFilter(name)
+	if !has {
+		return fmt.Errorf("Filter '%s' does not exist (therefore cannot be aliased).", name)
+	}
+	return set.registerFilter(alias, f)
+}
+
+// SetEscaper sets the function the escape filter and the autoescaping
+// (in its default mode) escape strings with, for sets producing other
+// output than HTML, e. g. LaTeX:
+//
+//	set.SetEscaper(strings.NewReplacer(`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`,
+//		"$", `\$`, "&", `\&`, "#", `\#`, "%", `\%`, "_", `\_`).Replace)
+//
+// nil restores the HTML escaping.
+func (set *TemplateSet) SetEscaper(escaper func(string) string) {
+	set.escaper = escaper
+}
+
+// OnExecutionError sets a handler for errors of template elements (tags and
+// variables) during executions, e. g. to log them and render a placeholder
+// instead of failing the whole page:
+//
+//	set.OnExecutionError(func(err *pongo2.Error, ctx *pongo2.ExecutionContext) (string, bool) {
+//		log.Print(err)
+//		return "<!-- unavailable -->", true
+//	})
+//
+// If the handler returns handled, the replacement is written as is (it's
+// not escaped) and the execution continues with the next element; output
+// the failing element wrote before it failed is kept. Otherwise the error
+// is passed on; the handler is called once per error, for the innermost
+// element. Exceeded limits (like MaxLoopIterations) can't be handled.
+func (set *TemplateSet) OnExecutionError(handler func(err *Error, ctx *ExecutionContext) (replacement string, handled bool)) {
+	set.executionErrorHandler = handler
+}
+
+// handleError passes err of an element to the set's execution error handler
+// (see TemplateSet.OnExecutionError); it returns nil if it was handled.
+func (ctx *ExecutionContext) handleError(err *Error, writer TemplateWriter) *Error {
+	handler := ctx.template.set.executionErrorHandler
+	if handler == nil || err.limitExceeded || err.unhandled {
+		return err
+	}
+	replacement, handled := handler(err, ctx)
+	if !handled {
+		err.unhandled = true
+		return err
+	}
+	writer.WriteString(replacement)
+	return nil
+}
+
+// filterEscape is the escape filter of the templates of a set; it uses the
+// escaper of the executed template's output profile or the set's escaper.
+func (set *TemplateSet) filterEscape(ctx *ExecutionContext, in *Value, args []*Value, kwargs map[string]*Value) (*Value, *Error) {
+	escaper := set.escaper
+	if ctx != nil && ctx.template.outputProfile != nil {
+		escaper = ctx.template.outputProfile.Escaper
+	}
+	if escaper == nil {
+		return filters["escape"].fn(ctx, in, args, kwargs)
+	}
+	return AsValue(escaper(in.String())), nil
+}
+
+// lookupFilter returns the filter registered under name for this set,
+// falling back to the globally registered filters.
+func (set *TemplateSet) lookupFilter(name string) (*filter, bool) {
+	if f, has := set.filters[name]; has {
+		return f, true
+	}
+	f, has := filters[name]
+	return f, has
+}
+
+// lookupTag returns the tag registered under name for this set, falling
+// back to the globally registered tags.
+func (set *TemplateSet) lookupTag(name string) (*tag, bool) {
+	if t, has := set.tags[name]; has {
+		return t, true
+	}
+	t, has := tags[name]
+	return t, has
+}
+
 // BanTag bans a specific tag for this template set. See more in the documentation for TemplateSet.
 func (set *TemplateSet) BanTag(name string) error {
-	_, has := tags[name]
+	_, has := set.lookupTag(name)
 	if !has {
 		return fmt.Errorf("Tag '%s' not found.", name)
 	}
@@ -98,7 +716,7 @@ func (set *TemplateSet) BanTag(name string) error {
 
 // BanFilter bans a specific filter for this template set. See more in the documentation for TemplateSet.
 func (set *TemplateSet) BanFilter(name string) error {
-	_, has := filters[name]
+	_, has := set.lookupFilter(name)
 	if !has {
 		return fmt.Errorf("Filter '%s' not found.", name)
 	}
@@ -115,10 +733,15 @@ func (set *TemplateSet) BanFilter(name string) error {
 }
 
 // FromCache is a convenient method to cache templates. It is thread-safe
-// and will only compile the template associated with a filename once.
+// and will only compile the template associated with a filename once;
+// concurrent calls for a template being compiled wait for the result while
+// cache hits for other templates are served without waiting.
 // If TemplateSet.Debug is true (for example during development phase),
 // FromCache() will not cache the template and instead recompile it on any
 // call (to make changes to a template live instantaneously).
+// A cached template is recompiled once it's older than CacheTTL or, if
+// CacheCheckModTime is enabled, once its or its dependencies' modification
+// time changed.
 func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 	if set.Debug {
 		// Recompile on any request
@@ -126,24 +749,361 @@ func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 	}
 	// Cache the template
 	cleanedFilename := set.resolveFilename(nil, filename)
+	key := set.cacheKey(cleanedFilename)
+
+	set.templateCacheMutex.RLock()
+	entry, has := set.templateCache[key]
+	set.templateCacheMutex.RUnlock()
+
+	if has && !set.isStale(entry) {
+		// Cache hit
+		atomic.AddUint64(&set.cacheHits, 1)
+		set.touchCacheEntry(entry)
+		return entry.tpl, nil
+	}
+
+	// Cache miss (or the cached template is expired or outdated)
+	return set.compileCached(cleanedFilename, key, entry)
+}
+
+// cacheKey returns the key a template is cached under (see CacheKeyFunc).
+func (set *TemplateSet) cacheKey(cleanedFilename string) string {
+	if set.CacheKeyFunc != nil {
+		return set.CacheKeyFunc(cleanedFilename)
+	}
+	return cleanedFilename
+}
+
+// isStale reports whether a cached template must be recompiled.
+func (set *TemplateSet) isStale(entry *templateCacheEntry) bool {
+	return set.isExpired(entry) || (set.CacheCheckModTime && set.isOutdated(entry))
+}
+
+// touchCacheEntry marks a cached template as recently used.
+func (set *TemplateSet) touchCacheEntry(entry *templateCacheEntry) {
+	set.templateCacheMutex.RLock()
+	bounded := set.cacheCapacity > 0
+	set.templateCacheMutex.RUnlock()
+	if !bounded {
+		// The LRU order only matters for bounded caches
+		return
+	}
 
 	set.templateCacheMutex.Lock()
 	defer set.templateCacheMutex.Unlock()
+	if entry.element != nil {
+		set.cacheLRU.MoveToFront(entry.element)
+	}
+}
+
+// compileCached compiles a template and stores it in the cache under key. The cache
+// isn't locked during the compilation; concurrent calls for the same
+// template wait for the first one to finish. stale is the cache entry (if
+// any) the caller considered as outdated.
+func (set *TemplateSet) compileCached(cleanedFilename, key string, stale *templateCacheEntry) (*Template, error) {
+	set.templateCacheMutex.Lock()
+	if call, has := set.cacheCalls[key]; has {
+		// The template is being compiled right now
+		set.templateCacheMutex.Unlock()
+		call.wg.Wait()
+		return call.tpl, call.err
+	}
+	if entry, has := set.templateCache[key]; has && entry != stale {
+		// Another call compiled the template in the meantime
+		set.templateCacheMutex.Unlock()
+		atomic.AddUint64(&set.cacheHits, 1)
+		return entry.tpl, nil
+	}
+	call := &templateCacheCall{}
+	call.wg.Add(1)
+	set.cacheCalls[key] = call
+	set.templateCacheMutex.Unlock()
 
-	tpl, has := set.templateCache[cleanedFilename]
+	atomic.AddUint64(&set.cacheMisses, 1)
+	modTime, _ := set.templateModTime(cleanedFilename)
+	start := time.Now()
+	call.tpl, call.err = set.FromFile(cleanedFilename)
+	compileTime := time.Since(start)
 
-	// Cache miss
+	set.templateCacheMutex.Lock()
+	if call.err == nil {
+		set.storeInCache(key, newTemplateCacheEntry(cleanedFilename, call.tpl, modTime, compileTime))
+	}
+	delete(set.cacheCalls, key)
+	set.templateCacheMutex.Unlock()
+	call.wg.Done()
+
+	return call.tpl, call.err
+}
+
+// InvalidateOnChange connects the template cache to a file watcher (e. g.
+// one based on fsnotify) to evict edited templates in long-running
+// processes without enabling Debug. watch is called once with an invalidate
+// function; it should set up its watcher and call invalidate (from any
+// goroutine) with the path of every changed file (see Invalidate). Paths are
+// resolved like template names, so absolute file paths work with the local
+// file system loader.
+func (set *TemplateSet) InvalidateOnChange(watch func(invalidate func(path string))) {
+	watch(set.Invalidate)
+}
+
+// Invalidate evicts the template associated with filename from the cache,
+// together with all cached templates compiled from it (templates extending,
+// including or importing it). They are recompiled on the next call to
+// FromCache().
+func (set *TemplateSet) Invalidate(filename string) {
+	set.evictFromCache(set.resolveFilename(nil, filename))
+}
+
+// ClearCache evicts all templates from the cache (e. g. after a deployment).
+func (set *TemplateSet) ClearCache() {
+	set.templateCacheMutex.Lock()
+	defer set.templateCacheMutex.Unlock()
+
+	set.templateCache = make(map[string]*templateCacheEntry)
+	set.cacheLRU = list.New()
+}
+
+// evictFromCache removes all cached templates which were compiled from the
+// already resolved path.
+func (set *TemplateSet) evictFromCache(resolvedPath string) {
+	set.templateCacheMutex.Lock()
+	defer set.templateCacheMutex.Unlock()
+
+	for key, entry := range set.templateCache {
+		if _, has := entry.modTimes[resolvedPath]; has {
+			set.removeFromCache(key)
+		}
+	}
+}
+
+// SetCacheCapacity limits the number of templates kept by FromCache() to n;
+// once the limit is reached, the least recently used template is evicted.
+// n <= 0 removes the limit (the default). Lowering the capacity evicts
+// surplus templates immediately.
+func (set *TemplateSet) SetCacheCapacity(n int) {
+	set.templateCacheMutex.Lock()
+	defer set.templateCacheMutex.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	set.cacheCapacity = n
+	set.evictSurplus()
+}
+
+// CacheEvictions returns the number of templates which have been evicted
+// from the cache so far because its capacity was exceeded.
+func (set *TemplateSet) CacheEvictions() uint64 {
+	set.templateCacheMutex.RLock()
+	defer set.templateCacheMutex.RUnlock()
+	return set.cacheEvictions
+}
+
+// TemplateCacheStats is a snapshot of a template set's cache statistics
+// (see TemplateSet.CacheStats).
+type TemplateCacheStats struct {
+	Hits      uint64 // FromCache() calls served from the cache
+	Misses    uint64 // FromCache() calls which (re)compiled the template
+	Evictions uint64 // templates evicted because the capacity was exceeded
+	Entries   int    // number of currently cached templates
+
+	// CompileTimes maps the cache key (the filename unless CacheKeyFunc is
+	// set) of every cached template to the duration its compilation took.
+	CompileTimes map[string]time.Duration
+}
+
+// CacheStats returns the current statistics of the template cache.
+func (set *TemplateSet) CacheStats() TemplateCacheStats {
+	set.templateCacheMutex.RLock()
+	defer set.templateCacheMutex.RUnlock()
+
+	stats := TemplateCacheStats{
+		Hits:         atomic.LoadUint64(&set.cacheHits),
+		Misses:       atomic.LoadUint64(&set.cacheMisses),
+		Evictions:    set.cacheEvictions,
+		Entries:      len(set.templateCache),
+		CompileTimes: make(map[string]time.Duration, len(set.templateCache)),
+	}
+	for key, entry := range set.templateCache {
+		stats.CompileTimes[key] = entry.compileTime
+	}
+	return stats
+}
+
+// CachedTemplates returns the (sorted) cache keys of all cached templates,
+// which are their filenames unless CacheKeyFunc is set.
+func (set *TemplateSet) CachedTemplates() []string {
+	set.templateCacheMutex.RLock()
+	defer set.templateCacheMutex.RUnlock()
+
+	keys := make([]string, 0, len(set.templateCache))
+	for key := range set.templateCache {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// storeInCache adds (or replaces) a cached template and evicts the least
+// recently used ones if the capacity is exceeded. The caller must hold
+// templateCacheMutex.
+func (set *TemplateSet) storeInCache(key string, entry *templateCacheEntry) {
+	set.removeFromCache(key)
+	entry.element = set.cacheLRU.PushFront(key)
+	set.templateCache[key] = entry
+	set.evictSurplus()
+}
+
+// removeFromCache removes a cached template. The caller must hold
+// templateCacheMutex.
+func (set *TemplateSet) removeFromCache(key string) {
+	entry, has := set.templateCache[key]
 	if !has {
-		tpl, err := set.FromFile(cleanedFilename)
+		return
+	}
+	set.cacheLRU.Remove(entry.element)
+	delete(set.templateCache, key)
+}
+
+// evictSurplus evicts the least recently used templates until the cache
+// fits its capacity. The caller must hold templateCacheMutex.
+func (set *TemplateSet) evictSurplus() {
+	if set.cacheCapacity <= 0 {
+		return
+	}
+	for set.cacheLRU.Len() > set.cacheCapacity {
+		set.removeFromCache(set.cacheLRU.Back().Value.(string))
+		set.cacheEvictions++
+	}
+}
+
+// PreloadFS walks fsys (typically an embed.FS containing templates compiled
+// into the binary using //go:embed), compiles every file matching glob and
+// seeds the template cache with the results, so FromCache() won't touch the
+// loader for these templates at runtime. The glob is matched (see path.Match)
+// against both the full slash-separated path and the file's base name.
+//
+// Templates are cached under the name the set's loader resolves them to;
+// use this set with NewFSLoader(fsys) so includes/extends/imports resolve
+// within the same file system.
+func (set *TemplateSet) PreloadFS(fsys fs.FS, glob string) error {
+	if _, err := path.Match(glob, ""); err != nil {
+		return err
+	}
+
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		matchedPath, _ := path.Match(glob, p)
+		matchedName, _ := path.Match(glob, d.Name())
+		if !matchedPath && !matchedName {
+			return nil
+		}
+
+		buf, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return &Error{
+				Filename: p,
+				Sender:   "preloadfs",
+				ErrorMsg: err.Error(),
+			}
+		}
+
+		set.firstTemplateCreated = true
+		cleanedFilename := set.resolveFilename(nil, p)
+		start := time.Now()
+		tpl, err := newTemplate(set, cleanedFilename, false, buf, nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		set.templateCache[cleanedFilename] = tpl
-		return tpl, nil
+		compileTime := time.Since(start)
+
+		modTime, _ := set.templateModTime(cleanedFilename)
+
+		set.templateCacheMutex.Lock()
+		set.storeInCache(set.cacheKey(cleanedFilename), newTemplateCacheEntry(cleanedFilename, tpl, modTime, compileTime))
+		set.templateCacheMutex.Unlock()
+
+		return nil
+	})
+}
+
+// PreloadDir compiles every template the loader lists below dir (use "" or
+// "." for all templates) and stores them in the cache, so broken templates
+// are detected at startup instead of on their first request. All failures
+// are collected and returned as an ErrorList. The loader (or the one of
+// dir's namespace) must implement LoaderLister.
+func (set *TemplateSet) PreloadDir(dir string) error {
+	resolvedDir := set.resolveFilename(nil, dir)
+	prefix := filepath.ToSlash(resolvedDir)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") && !strings.HasSuffix(prefix, namespaceSeparator) {
+		prefix += "/"
 	}
 
-	// Cache hit
-	return tpl, nil
+	return set.preload(resolvedDir, func(name string) bool {
+		return strings.HasPrefix(filepath.ToSlash(name), prefix)
+	})
+}
+
+// CompileGlob compiles every template the loader lists whose path matches
+// pattern (see path.Match, e. g. "mails/*.html") and stores them in the
+// cache. Like PreloadDir, it returns all failures as an ErrorList.
+func (set *TemplateSet) CompileGlob(pattern string) error {
+	resolvedPattern := filepath.ToSlash(set.resolveFilename(nil, pattern))
+	if _, err := path.Match(resolvedPattern, ""); err != nil {
+		return err
+	}
+
+	return set.preload(resolvedPattern, func(name string) bool {
+		matched, _ := path.Match(resolvedPattern, filepath.ToSlash(name))
+		return matched
+	})
+}
+
+// preload compiles and caches all templates of the loader responsible for
+// resolvedPath which are accepted by match.
+func (set *TemplateSet) preload(resolvedPath string, match func(name string) bool) error {
+	loader := set.loader
+	namespacePrefix := ""
+	if namespace, _, ok := splitNamespace(resolvedPath); ok {
+		if nsLoader, has := set.namespaces[namespace]; has {
+			loader = nsLoader
+			namespacePrefix = namespace + namespaceSeparator
+		}
+	}
+	lister, ok := loader.(LoaderLister)
+	if !ok {
+		return fmt.Errorf("Loader %T can't list its templates.", loader)
+	}
+	names, err := lister.List()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	var errs ErrorList
+	for _, name := range names {
+		name = namespacePrefix + name
+		if !match(name) {
+			continue
+		}
+		if _, err := set.FromCache(name); err != nil {
+			if e, ok := err.(*Error); ok && e.Errors != nil {
+				errs = append(errs, e.Errors...)
+				continue
+			}
+			errs = append(errs, toError(name, "preload", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 // FromString loads a template from string and returns a Template instance.
@@ -155,9 +1115,15 @@ func (set *TemplateSet) FromString(tpl string) (*Template, error) {
 
 // FromFile loads a template from a filename and returns a Template instance.
 func (set *TemplateSet) FromFile(filename string) (*Template, error) {
+	return set.fromFile(filename, nil)
+}
+
+// fromFile loads a template included (extended, imported) by the templates
+// named in includers.
+func (set *TemplateSet) fromFile(filename string, includers []string) (*Template, error) {
 	set.firstTemplateCreated = true
 
-	fd, err := set.loader.Get(set.resolveFilename(nil, filename))
+	fd, err := set.getTemplateReader(set.resolveFilename(nil, filename))
 	if err != nil {
 		return nil, &Error{
 			Filename: filename,
@@ -174,7 +1140,7 @@ func (set *TemplateSet) FromFile(filename string) (*Template, error) {
 		}
 	}
 
-	return newTemplate(set, filename, false, buf)
+	return newTemplate(set, filename, false, buf, includers)
 }
 
 // RenderTemplateString is a shortcut and renders a template string directly.
@@ -7,4 +7,13 @@
 {% endautoescape %}
 {% autoescape off %}
 {{ "<script>alert('xss');</script>"|escape }}
-{% endautoescape %}
\ No newline at end of file
+{% endautoescape %}{% autoescape js %}
+var s = '{{ simple.escape_js_test }}';
+{% autoescape on %}{{ "<b>" }}{% endautoescape %}
+{% endautoescape %}
+{% autoescape url %}
+<a href="/search?q={{ "a&b c" }}">{{ "<b>"|safe }}</a>
+{% endautoescape %}
+{% autoescape html %}
+{{ "<script>alert('xss');</script>" }}
+{% endautoescape %}
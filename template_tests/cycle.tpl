@@ -19,4 +19,7 @@
 '{% cycle "item1" simple.name simple.number as cycleitem silent %}'
 '{{ cycleitem }}'
 '{% cycle cycleitem %}'
-'{{ cycleitem }}'
\ No newline at end of file
+'{{ cycleitem }}'
+resetcycle
+{% for item in simple.multiple_item_list %}{% cycle "a" "b" "c" %}{% if forloop.Counter == 4 %}{% resetcycle %}{% endif %}{% endfor %}
+{% for item in simple.multiple_item_list %}{% cycle "x" "y" "z" as row silent %}{{ row }}{% if forloop.Counter == 2 %}{% resetcycle row %}{% endif %}{% endfor %}
@@ -0,0 +1,4 @@
+{% embed "embed.helper" %}{% block body %}Hello {{ simple.name }}!{% endblock %}{% endembed %}
+{% embed "embed.helper" with footer="bye" %}ignored{% block title %}Second{% endblock %}{% block body %}{% for c in complex.comments %}{{ c.Author.Name }}{% endfor %}{% endblock %}{% endembed %}
+{% embed "embed.helper" with footer=simple.number only %}{% block title %}{{ simple.name }}{% endblock %}{% endembed %}
+{% block title %}outer title{% endblock %}
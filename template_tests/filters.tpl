@@ -214,6 +214,11 @@ wordcount
 wordwrap
 {{ ""|wordwrap:2 }}
 {% filter wordwrap:5 %}{% lorem 26 w %}{% endfilter %}
+{% filter wordwrap(width=30) %}{% lorem 26 w %}{% endfilter %}
+{% filter wordwrap(width=5) %}Joel is a slug
+with a line   break{% endfilter %}
+{{ "a verylongword here"|wordwrap(width=6, long=true) }}
+{{ "one two three"|wordwrap(width=7, break="<br>") }}
 
 iriencode
 {{ "?foo=123&bar=yes"|iriencode }}
@@ -301,4 +306,39 @@ truncatewords_html
 {{ "<a name='link' href=\"https://....\"><p class=\"foo\">This </a>is a long test, which will be cutted after some words.</p>"|truncatewords_html:5 }}
 {{ "<p>This </a>is a long test, which will be cutted after some words.</p>"|truncatewords_html:5 }}
 {{ "<p>This is a long test which will be cutted after some words.</p>"|truncatewords_html:2 }}
-{{ "<p>This is a long test which will be cutted after some words.</p>"|truncatewords_html:0 }}
\ No newline at end of file
+{{ "<p>This is a long test which will be cutted after some words.</p>"|truncatewords_html:0 }}
+{{ complex.post.Created|date:"2006-01-02 15:04" }}
+{{ complex.post.Created|date:"django:D, N jS Y, P" }}
+{{ complex.post.Created|date:"go:Monday" }}
+{{ complex.post.Created|date:"Monday, Jan PM" }}
+{{ complex.post.Created|date:"django:\\W\\e\\e\\k W" }}
+{{ complex.post.Created|time:"django:H:i:s" }}
+{{ complex.post.Created|timesince:complex.comments.0.Date }}
+{{ complex.comments.0.Date|timesince:complex.post.Created }}
+{{ complex.comments.0.Date|timeuntil:complex.post.Created }}
+{{ 0|filesizeformat }} {{ 1|filesizeformat }} {{ 1023|filesizeformat }} {{ 1024|filesizeformat }} {{ 123456789|filesizeformat }} {{ 1048576|filesizeformat }} {{ "abc"|filesizeformat }}
+{{ 123456789|filesizeformat(units="binary") }} {{ 123456789|filesizeformat(units="decimal") }} {{ 999|filesizeformat(units="decimal") }} {{ 1000|filesizeformat(units="decimal") }} {{ 5000000000000000000|filesizeformat(units="decimal") }}
+{{ 100|intcomma }} {{ 1000|intcomma }} {{ 1234567|intcomma }} {{ 1234567.25|intcomma }} {{ "-45000"|intcomma }} {{ 1234567|intcomma:"." }} {{ "abc"|intcomma }}
+{{ 999999|intword }} {{ 1000000|intword }} {{ 1200000|intword }} {{ 1290000000|intword }} {{ 999999999|intword }} {{ "2500000000000"|intword }} {{ 1.5|intword }} {{ "abc"|intword }}
+{{ 0|apnumber }} {{ 1|apnumber }} {{ 9|apnumber }} {{ "5"|apnumber }} {{ 10|apnumber }} {{ 2.5|apnumber }} {{ "x"|apnumber }}
+{{ "</script><b>\"x\" & y</b>"|tojson }} {{ simple.multiple_item_list|tojson }} {{ nothing|tojson }} {{ 1.5|tojson }}
+{{ "abc123"|regex_match:"^[a-z]+$" }} {{ "abc"|regex_match:"^[a-z]+$" }} {% if "2024-01-02"|regex_match:"\\d{4}" %}year{% endif %}
+{{ "a1b22c333"|regex_replace:"/[0-9]+/#/" }} {{ "a/b//c"|regex_replace:"|/+|-|" }} {{ "John Smith"|regex_replace:"/(\\w+) (\\w+)/${2}, $1/" }} {{ "x1y"|regex_replace:"/[0-9]//" }}
+{{ "Hello, World!"|slugify }} {{ "  Grüße aus Köln!  "|slugify }} {{ "Crème Brûlée -- 2024"|slugify(sep="_") }} {{ "Привет мир"|slugify }} {{ "The quick brown fox"|slugify(max=12) }} {{ "abcdefgh"|slugify(max=4) }}
+{{ "<b>Visit</b> http://example.com/ünïcödé-päth or mail a@b.de & co"|urlizetrunc:26|safe }}
+{{ 1234567.891|money:"USD" }} {{ "-1234.5"|money("usd", locale="en-US") }} {{ 1234.5|money("EUR", locale="de-DE") }} {{ 1234.5|money("EUR", locale="de_AT") }} {{ 1234.5|money("EUR", locale="fr-FR") }} {{ 1234.5|money("CHF", locale="de-CH") }} {{ 1234.5|money("JPY", locale="ja") }} {{ "99.999"|money:"GBP" }} {{ 5|money("XYZ", locale="nl") }} {{ "-0.001"|money:"USD" }}
+{{ "<p class=\"x\">Hello <b onclick=\"evil()\">bold</b> & <I>it</I> <a href=\"https://example.com/?a=1&b=2\" target=_blank>link</a> <a href=\"javascript:alert(1)\">bad</a> <script>alert(1)</script><br/> 1 < 2</p>"|striptags_except:"b, i,a,br" }}
+{{ complex.comments|map(attribute="Author.Name")|join:", " }}
+{{ complex.comments|selectattr:"Author.Validated"|map:"Author.Name"|join:", " }} / {{ complex.comments|rejectattr:"Author.Validated"|length }}
+{{ simple.multiple_item_list|select:"odd"|join:"," }} / {{ simple.multiple_item_list|reject:"odd"|join:"," }} / {{ simple.misc_list|select:"string"|join:"," }}
+{{ simple.multiple_item_list|selectattr("Foo", "none")|length }}
+{{ simple.multiple_item_list|sum }} {{ simple.multiple_item_list|min }} {{ simple.multiple_item_list|max }} {{ simple.multiple_item_list|avg }} [{{ simple.multiple_item_list|select:"none"|avg }}]
+{% for row in simple.multiple_item_list|batch:4 %}[{{ row|join:"," }}]{% endfor %} {% for row in simple.misc_list|batch(3, fill="-") %}[{{ row|join:"," }}]{% endfor %} {% for col in simple.multiple_item_list|chunk:3 %}[{{ col|join:"," }}]{% endfor %} {{ simple.misc_list|chunk:6|length }} {{ simple.misc_list|batch:999999999999|length }} {{ simple.misc_list|chunk:999999999999|length }}
+{{ complex.post.Created|date(format="2006-01-02 15:04") }}
+{{ complex.post.Created|date("django:Y-m-d H:i", tz="UTC") }}
+{{ complex.post.Created|date(tz="Asia/Tokyo", format="django:Y-m-d H:i T") }}
+{{ complex.post.Created|time(format="django:H:i", tz="America/New_York") }}
+{{ complex.post.Created|date() }}
+{{ simple.name|truncatechars( 4 )|upper }}
+{{ "banana"|replace:"a","o" }} {{ "banana"|replace:"a","o",2 }} {{ "banana"|replace("an", "AN", count=1) }} {{ simple.name|replace:simple.name,"x"|upper }}
+{{ "a b/c&d=é"|escapeurl }} {{ "a b/c&d=é"|escapeurl:"path" }} {{ "red; x: url(\"y\")"|escapecss }}{% autoescape css %} {{ "</style>" }}{% endautoescape %}
\ No newline at end of file
@@ -4,4 +4,8 @@
 {% firstof doesnotexist simple.uint 42 %}
 {% firstof doesnotexist "test" simple.number 42 %}
 {% firstof %}
-{% firstof "test" "test2" %}
\ No newline at end of file
+{% firstof "test" "test2" %}
+{% firstof doesnotexist simple.name "fallback" as chosen %}[{{ chosen }}]
+{% firstof doesnotexist "<b>"|safe as chosen %}[{{ chosen }}]
+{% firstof doesnotexist "<b>" as chosen %}[{{ chosen }}]
+{% firstof doesnotexist as chosen %}[{{ chosen }}]
\ No newline at end of file
@@ -25,3 +25,13 @@ reversed sorted string map
 
 reversed sorted int map
 '{% for key in simple.intmap reversed sorted %}{{ key }} {% endfor %}'
+
+
+key, value in map
+'{% for key, value in simple.strmap sorted %}{{ key }}={{ value }} {% endfor %}'
+
+unpacking pairs
+'{% for name, number in simple.pairs %}{{ name }}={{ number }} {% endfor %}'
+
+unpacking structs
+'{% for author, date, text in complex.comments %}{{ author.Name }} {% endfor %}'
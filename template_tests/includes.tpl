@@ -4,4 +4,12 @@ Start '{% include "includes.helper" with what_am_i=simple.name only %}' End
 Start '{% include "includes.helper" with what_am_i=simple.name %}' End
 Start '{% include simple.included_file|lower with number=7 what_am_i="guest" %}' End
 Start '{% include "includes.helper.not_exists" if_exists %}' End
-Start '{% include simple.included_file_not_exists if_exists with number=7 what_am_i="guest" %}' End
\ No newline at end of file
+Start '{% include simple.included_file_not_exists if_exists with number=7 what_am_i="guest" %}' End
+Start '{% include "includes.helper.not_exists" ignore missing %}' End
+Start '{% include simple.included_file_not_exists ignore missing with number=7 what_am_i="guest" %}' End
+Start '{% include "includes.helper" ignore missing with what_am_i=simple.name only %}' End
+Start '{% include "includes.helper" only %}' End
+Start '{% include simple.included_file|lower only %}' End
+Start '{% include ["includes.helper.not_exists", "includes.helper"] %}' End
+Start '{% include ["includes.helper.not_exists", "includes.helper.not_exists2"] ignore missing %}' End
+Start '{% include simple.included_file_fallbacks with number=3 %}' End
\ No newline at end of file
@@ -6,4 +6,8 @@
 {% lorem 3 p %}
 -----
 {% lorem 100 w %}
+-----
+{% lorem simple.number w %}
+-----
+{% lorem complex.comments|length w %}
 -----
\ No newline at end of file
@@ -27,4 +27,10 @@ Importing macros
 
 Chaining macros{% import "macro2.helper" greeter_macro %}
 {{ greeter_macro() }}
+
+Namespace import{% import "macro.helper" as helpers %}
+{{ helpers.imported_macro("Namespace") }} - {{ helpers.imported_macro_void() }}
+
+From import{% from "macro.helper" import imported_macro as from_macro, imported_macro_void %}
+{{ from_macro("From") }} - {{ imported_macro_void() }}
 End
\ No newline at end of file
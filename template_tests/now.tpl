@@ -1,2 +1,6 @@
 {# The 'fake' argument exists to have tests for the now-tag; it will set the time to a specific date instead of now #}
-{% now "Mon Jan 2 15:04:05 -0700 MST 2006" fake %}
\ No newline at end of file
+{% now "Mon Jan 2 15:04:05 -0700 MST 2006" fake %}
+{% now "django:Y-m-d H:i" fake %}
+{% now "django:D, jS F Y \\a\\t P" fake %}
+{% now "django:l N j, y g:i:s A O" fake %}
+{% now "django:c U w W z t L" fake %}
@@ -0,0 +1,5 @@
+{% regroup complex.comments by Author.Validated as by_validation %}{% for group in by_validation %}{{ group.grouper }}: {% for c in group.list %}{{ c.Author.Name }} {% endfor %}
+{% endfor %}{% regroup complex.comments2 by Author.Name as by_author %}{% for group in by_author %}{{ group.grouper }} ({{ group.list|length }})
+{% endfor %}{% regroup complex.comments by Author.Is_admin2 as by_method %}{{ by_method|length }}
+{% regroup simple.multiple_item_list by nonexistent as by_missing %}{{ by_missing|length }} {{ by_missing.0.list|length }}
+{% regroup simple.nothing by Name as empty %}{{ empty|length }}
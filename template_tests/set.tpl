@@ -3,4 +3,6 @@
 {{ new_var }}{% for item in simple.misc_list %}
 {% set new_var = item %}{{ new_var }}{% endfor %}
 {{ new_var }}
-{% set car=someUndefinedVar %}{{ car.Drive }}No Panic
\ No newline at end of file
+{% set car=someUndefinedVar %}{{ car.Drive }}No Panic
+{% set snippet %}<b>{{ simple.name }}</b> {{ simple.xss }}{% endset %}{{ snippet }}
+{% include "includes.helper" with what_am_i=snippet %}
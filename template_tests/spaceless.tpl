@@ -15,4 +15,24 @@
     </p>
 
 </div>
-{% endspaceless %}
\ No newline at end of file
+{% endspaceless %}{% spaceless collapse %}
+<div>
+    <p>
+        Collapsed   text,
+        <b> bold </b>
+    </p>
+    <pre>
+  keep   this
+    </pre>
+    <script>
+        var a  =  1;
+    </script>
+</div>
+{% endspaceless %}
+{% spaceless preserve %}
+<ul>
+    <li>A</li>
+    <li><textarea>
+  x  </textarea></li>
+</ul>
+{% endspaceless %}
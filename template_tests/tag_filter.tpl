@@ -1,3 +1,5 @@
 {% filter lower %}This is a nice test; let's see whether it works. Foobar. {{ simple.xss }}{% endfilter %}
 
-{% filter truncatechars:10|lower|length %}This is a nice test; let's see whether it works. Foobar. {{ simple.number }}{% endfilter %}
\ No newline at end of file
+{% filter truncatechars:10|lower|length %}This is a nice test; let's see whether it works. Foobar. {{ simple.number }}{% endfilter %}
+{% filter lower|truncatewords:simple.number|title %}THIS is A NICE test{% endfilter %}
+{% filter cut:" "|upper %}a b c{% endfilter %}
@@ -4,4 +4,5 @@
 {% test %}
 {% endverbatim %}{{ simple.number }}.
 
-.{{ simple.number }}{% verbatim %}{{ test }}{% endverbatim %}{{ simple.number }}.
\ No newline at end of file
+.{{ simple.number }}{% verbatim %}{{ test }}{% endverbatim %}{{ simple.number }}.
+.{% verbatim myblock %}{% verbatim %}{{ test }}{% endverbatim %}{% endverbatim myblock %}{{ simple.number }}.
@@ -1,4 +1,5 @@
 {# Tip: In pongo2 you can easily use arithmetic expressions like value/100.0, but widthratio is supported as well #}
 {% widthratio 175 200 100 %}
 {% widthratio 175 200 100 as width %}
-{{ width }}
\ No newline at end of file
+{{ width }}
+{% widthratio 87 200 100 %} {% widthratio 0 200 100 %} {% widthratio 10 0 100 %} {% widthratio 1 8 100 %}
\ No newline at end of file
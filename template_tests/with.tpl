@@ -13,4 +13,8 @@ Start '{% include "with.helper" with what_am_i=simple.name number=10 %}' End
 more with tests
 {% with first_comment=complex.comments|first %}{{ first_comment.Author }}{% endwith %}
 {% with first_comment=complex.comments|first %}{{ first_comment.Author.Name }}{% endwith %}
-{% with first_comment=complex.comments|last %}{{ first_comment.Author.Name }}{% endwith %}
\ No newline at end of file
+{% with first_comment=complex.comments|last %}{{ first_comment.Author.Name }}{% endwith %}
+
+scoping
+{% with total=simple.multiple_item_list|length %}{{ total }} items{% endwith %} [{{ total }}]
+{% with name="outer" %}{% with name="inner" %}{{ name }}{% endwith %} {{ name }}{% endwith %}
\ No newline at end of file
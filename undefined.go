@@ -0,0 +1,135 @@
+package pongo2
+
+import (
+	"fmt"
+	"sync"
+)
+
+// UndefinedVariable describes a variable missing from the context (or an
+// attribute missing from a struct or map) for an UndefinedPolicy.
+type UndefinedVariable struct {
+	Variable  string // as written in the template, e. g. "user.email"
+	Name      string // missing part of the variable, e. g. "email"
+	Attribute bool   // whether a struct field or map key is missing
+
+	Filename string
+	Line     int
+	Column   int
+}
+
+// UndefinedPolicy decides what undefined variables resolve to. It's
+// selected using TemplateSet.Undefined or ExecuteOptions.Undefined.
+type UndefinedPolicy interface {
+	// Undefined returns the value of the undefined variable or an error
+	// failing the execution.
+	Undefined(ctx *ExecutionContext, variable *UndefinedVariable) (*Value, error)
+}
+
+type silentUndefined struct{}
+
+func (silentUndefined) Undefined(ctx *ExecutionContext, variable *UndefinedVariable) (*Value, error) {
+	return AsValue(nil), nil
+}
+
+type strictUndefined struct{}
+
+func (strictUndefined) Undefined(ctx *ExecutionContext, variable *UndefinedVariable) (*Value, error) {
+	return nil, fmt.Errorf("'%s' is undefined (variable %s)", variable.Name, variable.Variable)
+}
+
+type warnUndefined struct{}
+
+func (warnUndefined) Undefined(ctx *ExecutionContext, variable *UndefinedVariable) (*Value, error) {
+	set := ctx.template.set
+	w := &Warning{
+		Filename: variable.Filename,
+		Line:     variable.Line,
+		Column:   variable.Column,
+		Message:  fmt.Sprintf("'%s' is undefined (variable %s)", variable.Name, variable.Variable),
+	}
+	if set.warningHandler != nil {
+		set.warningHandler(w)
+	}
+	logger.Printf("[template set: %s] %s", set.name, w)
+	return AsValue(nil), nil
+}
+
+type debugUndefined struct{}
+
+func (debugUndefined) Undefined(ctx *ExecutionContext, variable *UndefinedVariable) (*Value, error) {
+	return AsValue(fmt.Sprintf("{{ %s }}", variable.Variable)), nil
+}
+
+var (
+	// SilentUndefined resolves undefined variables to nil, i. e. they're
+	// rendered as empty strings (the default).
+	SilentUndefined UndefinedPolicy = silentUndefined{}
+
+	// StrictUndefined fails the execution with an error naming the variable
+	// and its position.
+	StrictUndefined UndefinedPolicy = strictUndefined{}
+
+	// WarnUndefined reports a warning (see TemplateSet.OnWarning()), logs
+	// it regardless of TemplateSet.Debug and resolves undefined variables
+	// to nil.
+	WarnUndefined UndefinedPolicy = warnUndefined{}
+
+	// DebugUndefined resolves undefined variables to a placeholder naming
+	// them, e. g. "{{ user.email }}", to spot them on rendered pages. Note
+	// that the placeholder is true in conditions.
+	DebugUndefined UndefinedPolicy = debugUndefined{}
+)
+
+// Filters providing a default for undefined variables; variables using one
+// of them as their first filter aren't passed to the UndefinedPolicy.
+var defaultingFilters = map[string]bool{
+	"default":         true,
+	"default_if_none": true,
+	"coalesce":        true,
+}
+
+// LoggingUndefined records the undefined variables (resolving them like
+// SilentUndefined). It's safe to use it for concurrent executions.
+type LoggingUndefined struct {
+	mu     sync.Mutex
+	misses []UndefinedVariable
+}
+
+// Undefined records the variable.
+func (l *LoggingUndefined) Undefined(ctx *ExecutionContext, variable *UndefinedVariable) (*Value, error) {
+	l.mu.Lock()
+	l.misses = append(l.misses, *variable)
+	l.mu.Unlock()
+	return AsValue(nil), nil
+}
+
+// Misses returns the undefined variables recorded so far, in order.
+func (l *LoggingUndefined) Misses() []UndefinedVariable {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]UndefinedVariable(nil), l.misses...)
+}
+
+// Reset forgets the recorded variables.
+func (l *LoggingUndefined) Reset() {
+	l.mu.Lock()
+	l.misses = nil
+	l.mu.Unlock()
+}
+
+// undefinedPolicy returns the policy of the execution: the set's
+// MissingAttribute for attributes if set, otherwise the one given by
+// ExecuteOptions or the set's.
+func (ctx *ExecutionContext) undefinedPolicy(attribute bool) UndefinedPolicy {
+	set := ctx.template.set
+	if attribute && set.MissingAttribute != nil {
+		return set.MissingAttribute
+	}
+	if ctx.limits != nil && ctx.limits.undefined != nil {
+		return ctx.limits.undefined
+	}
+	if set.Undefined != nil {
+		return set.Undefined
+	}
+	return SilentUndefined
+}
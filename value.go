@@ -13,6 +13,14 @@ type Value struct {
 	safe bool // used to indicate whether a Value needs explicit escaping in the template
 }
 
+// SafeHTMLer is implemented by Go values which render themselves as HTML
+// that is safe to output as is, e. g. the output of a sanitizer or a widget
+// library: SafeHTML() is used as their string representation and they
+// aren't autoescaped, as if they were wrapped using AsSafeValue().
+type SafeHTMLer interface {
+	SafeHTML() string
+}
+
 // AsValue converts any given value to a pongo2.Value
 // Usually being used within own functions passed to a template
 // through a Context or within filter functions.
@@ -33,6 +41,16 @@ func AsSafeValue(i interface{}) *Value {
 	}
 }
 
+// isSafe checks whether the value must not be escaped (see AsSafeValue()
+// and SafeHTMLer).
+func (v *Value) isSafe() bool {
+	if v.safe {
+		return true
+	}
+	_, ok := v.Interface().(SafeHTMLer)
+	return ok
+}
+
 func (v *Value) getResolvedValue() reflect.Value {
 	if v.val.IsValid() && v.val.Kind() == reflect.Ptr {
 		return v.val.Elem()
@@ -82,6 +100,27 @@ func (v *Value) IsNil() bool {
 	return !v.getResolvedValue().IsValid()
 }
 
+// isNone reports whether the underlying value is "None" for the null-aware
+// filters: NIL as well as nil pointers, interfaces, maps, slices, channels
+// and functions (but not empty strings or zero numbers).
+func (v *Value) isNone() bool {
+	rv := v.val
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return rv.IsNil()
+	}
+	return false
+}
+
 // Returns a string for the underlying value. If this value is not
 // of type string, pongo2 tries to convert it. Currently the following
 // types for underlying values are supported:
@@ -93,12 +132,16 @@ func (v *Value) IsNil() bool {
 //     5. time.Time
 //     6. String() will be called on the underlying value if provided
 //
+// Values implementing SafeHTMLer are represented by their SafeHTML().
 // NIL values will lead to an empty string. Unsupported types are leading
 // to their respective type name.
 func (v *Value) String() string {
 	if v.IsNil() {
 		return ""
 	}
+	if h, ok := v.Interface().(SafeHTMLer); ok {
+		return h.SafeHTML()
+	}
 
 	switch v.getResolvedValue().Kind() {
 	case reflect.String:
@@ -353,7 +396,59 @@ func (v *Value) CanSlice() bool {
 	return false
 }
 
-// Iterates over a map, array, slice or a string. It calls the
+// Iterator is implemented by values producing their items lazily, e. g.
+// database cursors. Such values (and channels, which are received from
+// until they're closed) can be passed to templates without materializing
+// all items: {% for %} loops and filters like first, join and slice only
+// consume the items they need. An iterator can be consumed only once.
+type Iterator interface {
+	// Next returns the next item; ok is false once there are no more items.
+	Next() (item interface{}, ok bool)
+}
+
+// IsIterator checks whether the underlying value produces its items lazily,
+// i. e. implements Iterator or is a channel.
+func (v *Value) IsIterator() bool {
+	if v.val.IsValid() && v.val.CanInterface() {
+		if _, ok := v.val.Interface().(Iterator); ok {
+			return true
+		}
+	}
+	rv := v.getResolvedValue()
+	return rv.Kind() == reflect.Chan && rv.Type().ChanDir()&reflect.RecvDir != 0
+}
+
+// nextItem returns the next item of an iterator (see IsIterator()).
+func (v *Value) nextItem() (*Value, bool) {
+	if it, ok := v.Interface().(Iterator); ok {
+		item, ok := it.Next()
+		if !ok {
+			return nil, false
+		}
+		return AsValue(item), true
+	}
+	item, ok := v.getResolvedValue().Recv()
+	if !ok {
+		return nil, false
+	}
+	return &Value{val: item}, true
+}
+
+// iteratorItems consumes up to limit items of an iterator (all if limit is
+// negative) and returns them.
+func (v *Value) iteratorItems(limit int) []interface{} {
+	var items []interface{}
+	for limit < 0 || len(items) < limit {
+		item, ok := v.nextItem()
+		if !ok {
+			break
+		}
+		items = append(items, item.Interface())
+	}
+	return items
+}
+
+// Iterates over a map, array, slice, string or iterator. It calls the
 // function's first argument for every value with the following arguments:
 //
 //     idx      current 0-index
@@ -361,6 +456,9 @@ func (v *Value) CanSlice() bool {
 //     key      *Value for the key or item
 //     value    *Value (only for maps, the respective value for a specific key)
 //
+// Iterators (see IsIterator()) are consumed lazily, so their total amount
+// of items isn't known upfront: count is -1 for all items but the last one.
+//
 // If the underlying value has no items or is not one of the types above,
 // the empty function (function's second argument) will be called.
 func (v *Value) Iterate(fn func(idx, count int, key, value *Value) bool, empty func()) {
@@ -369,7 +467,33 @@ func (v *Value) Iterate(fn func(idx, count int, key, value *Value) bool, empty f
 
 // Like Value.Iterate, but can iterate through an array/slice/string in reverse. Does
 // not affect the iteration through a map because maps don't have any particular order.
+// Iterators are consumed completely if reverse or sorted is set.
 func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, empty func(), reverse bool, sorted bool) {
+	if v.IsIterator() {
+		if reverse || sorted {
+			AsValue(v.iteratorItems(-1)).IterateOrder(fn, empty, reverse, sorted)
+			return
+		}
+
+		// Look one item ahead to tell the last item
+		item, ok := v.nextItem()
+		if !ok {
+			empty()
+			return
+		}
+		for idx := 0; ; idx++ {
+			next, more := v.nextItem()
+			count := -1
+			if !more {
+				count = idx + 1
+			}
+			if !fn(idx, count, item, nil) || !more {
+				return
+			}
+			item = next
+		}
+	}
+
 	switch v.getResolvedValue().Kind() {
 	case reflect.Map:
 		keys := sortedKeys(v.getResolvedValue().MapKeys())
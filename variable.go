@@ -50,6 +50,11 @@ type variableResolver struct {
 	locationToken *Token
 
 	parts []*variablePart
+
+	// Whether the variable may be undefined regardless of the
+	// UndefinedPolicy (like in {{ name|default:"guest" }}, see
+	// defaultingFilters)
+	undefinedOK bool
 }
 
 type nodeFilteredVariable struct {
@@ -62,6 +67,8 @@ type nodeFilteredVariable struct {
 type nodeVariable struct {
 	locationToken *Token
 	expr          IEvaluator
+	escapeContext escapeContext // see TemplateSet.ContextualAutoescape
+	unquotedAttr  bool          // output in an unquoted attribute value
 }
 
 func (v *nodeFilteredVariable) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
@@ -184,9 +191,10 @@ func (nv *nodeVariable) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 		return err
 	}
 
-	if !nv.expr.FilterApplied("safe") && !value.safe && value.IsString() && ctx.Autoescape {
-		// apply escape filter
-		value, err = filters["escape"](value, nil)
+	if !nv.expr.FilterApplied("safe") && !value.isSafe() && value.IsString() && ctx.Autoescape {
+		// apply escape filter (of the active autoescape mode or the
+		// variable's HTML context)
+		value, err = ctx.escapeIn(value, nv.escapeContext, nv.unquotedAttr)
 		if err != nil {
 			return err
 		}
@@ -220,14 +228,15 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 	var isSafe bool
 
 	for idx, part := range vr.parts {
+		var receiver reflect.Type // of the method to call
 		if idx == 0 {
 			// We're looking up the first part of the variable.
 			// First we're having a look in our private
-			// context (e. g. information provided by tags, like the forloop)
-			val, inPrivate := ctx.Private[vr.parts[0].s]
-			if !inPrivate {
-				// Nothing found? Then have a final lookup in the public context
-				val = ctx.Public[vr.parts[0].s]
+			// context (e. g. information provided by tags, like the forloop),
+			// then in the public context and finally in the set's globals
+			val, has := ctx.Lookup(vr.parts[0].s)
+			if !has {
+				return vr.undefined(ctx, part, false)
 			}
 			current = reflect.ValueOf(val) // Get the initial value
 		} else {
@@ -239,6 +248,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			if part.typ == varTypeIdent {
 				funcValue := current.MethodByName(part.s)
 				if funcValue.IsValid() {
+					receiver = current.Type()
 					current = funcValue
 					isFunc = true
 				}
@@ -284,6 +294,9 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 						return nil, fmt.Errorf("Can't access a field by name on type %s (variable %s)",
 							current.Kind().String(), vr.String())
 					}
+					if !current.IsValid() {
+						return vr.undefined(ctx, part, true)
+					}
 				default:
 					panic("unimplemented")
 				}
@@ -386,7 +399,10 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			}
 
 			// Call it and get first return parameter back
-			rv := current.Call(parameters)[0]
+			rv, err := vr.call(current, parameters, part.s, receiver)
+			if err != nil {
+				return nil, err
+			}
 
 			if rv.Type() != reflect.TypeOf(new(Value)) {
 				current = reflect.ValueOf(rv.Interface())
@@ -406,6 +422,48 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 	return &Value{val: current, safe: isSafe}, nil
 }
 
+// call calls the function (or method of receiver) fn named name, turning a
+// panic into an error.
+func (vr *variableResolver) call(fn reflect.Value, args []reflect.Value, name string, receiver reflect.Type) (reflect.Value, error) {
+	rv, err := callRecovered(fn, args, name, receiver)
+	if err != nil {
+		return rv, fmt.Errorf("%v (variable %s)", err, vr.String())
+	}
+	return rv, nil
+}
+
+// callRecovered calls the function (or method of receiver) fn named name
+// and returns its first return value; a panic is turned into an error.
+func callRecovered(fn reflect.Value, args []reflect.Value, name string, receiver reflect.Type) (rv reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if receiver != nil {
+				err = fmt.Errorf("Method '%s' of type %s panicked: %v", name, receiver, r)
+			} else {
+				err = fmt.Errorf("Function '%s' panicked: %v", name, r)
+			}
+		}
+	}()
+	return fn.Call(args)[0], nil
+}
+
+// undefined resolves the variable whose part is undefined (a struct field
+// or map key if attribute is set) using the execution's UndefinedPolicy
+// (see TemplateSet.Undefined).
+func (vr *variableResolver) undefined(ctx *ExecutionContext, part *variablePart, attribute bool) (*Value, error) {
+	if vr.undefinedOK {
+		return AsValue(nil), nil
+	}
+	return ctx.undefinedPolicy(attribute).Undefined(ctx, &UndefinedVariable{
+		Variable:  vr.String(),
+		Name:      part.s,
+		Attribute: attribute,
+		Filename:  vr.locationToken.Filename,
+		Line:      vr.locationToken.Line,
+		Column:    vr.locationToken.Col,
+	})
+}
+
 func (vr *variableResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 	value, err := vr.resolve(ctx)
 	if err != nil {
@@ -633,6 +691,10 @@ filterLoop:
 			return nil, p.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), nil)
 		}
 
+		if vr, ok := v.resolver.(*variableResolver); ok && len(v.filterChain) == 0 && defaultingFilters[filter.name] {
+			vr.undefinedOK = true
+		}
+
 		v.filterChain = append(v.filterChain, filter)
 
 		continue filterLoop
@@ -658,5 +720,15 @@ func (p *Parser) parseVariableElement() (INode, *Error) {
 		return nil, p.Error("'}}' expected", nil)
 	}
 
+	if sc := p.template.htmlScanner; sc != nil {
+		if p.template.set.ContextualAutoescape {
+			node.escapeContext = sc.context()
+			node.unquotedAttr = sc.unquoted()
+		} else {
+			p.template.checkAttributeOutput(node)
+		}
+		sc.output()
+	}
+
 	return node, nil
 }
@@ -0,0 +1,122 @@
+package pongo2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warning is a non-fatal issue found while compiling or executing a
+// template, e. g. the use of a deprecated filter or a block which is never
+// rendered. See Template.Warnings() and TemplateSet.OnWarning().
+type Warning struct {
+	Filename string
+	Line     int
+	Column   int
+	Message  string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("[Warning in %s | Line %d Col %d] %s", w.Filename, w.Line, w.Column, w.Message)
+}
+
+// Deprecated filters and tags with hints on what to use instead.
+var (
+	deprecatedFilters = map[string]string{
+		"length_is": "use {% if value|length == n %} instead",
+	}
+	deprecatedTags = map[string]string{
+		"ifequal":    "use {% if a == b %} instead",
+		"ifnotequal": "use {% if a != b %} instead",
+	}
+)
+
+// Warnings returns the warnings found while compiling the template (not
+// the ones of included or parent templates, they are reported by their
+// own templates).
+func (tpl *Template) Warnings() []*Warning {
+	return tpl.warnings
+}
+
+// OnWarning sets a handler for warnings of the set's templates, found while
+// compiling (see Template.Warnings()) or executing them (like undefined
+// variables of WarnUndefined). CI jobs can use it to fail on warnings:
+//
+//	var warnings []*pongo2.Warning
+//	set.OnWarning(func(w *pongo2.Warning) { warnings = append(warnings, w) })
+//
+// The handler may be called concurrently by concurrent executions.
+func (set *TemplateSet) OnWarning(handler func(w *Warning)) {
+	set.warningHandler = handler
+}
+
+// warn passes w to the set's warning handler and logs it (if the set's
+// Debug is enabled).
+func (set *TemplateSet) warn(w *Warning) {
+	if set.warningHandler != nil {
+		set.warningHandler(w)
+	}
+	set.logf("%s", w)
+}
+
+// warnf records a warning about the template at token's position.
+func (tpl *Template) warnf(token *Token, format string, args ...interface{}) {
+	w := &Warning{
+		Filename: tpl.name,
+		Line:     token.Line,
+		Column:   token.Col,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	tpl.warnings = append(tpl.warnings, w)
+	tpl.set.warn(w)
+}
+
+// checkOutsideBlocks warns about the first content of a template extending
+// another one which is outside of blocks (it's never rendered).
+func (tpl *Template) checkOutsideBlocks(doc *nodeDocument) {
+	if tpl.parent == nil && tpl.lazyExtends == nil {
+		return
+	}
+	for i, node := range doc.Nodes {
+		switch n := node.(type) {
+		case *nodeHTML:
+			if strings.TrimSpace(n.token.Val) == "" {
+				continue
+			}
+		case *nodeVariable:
+		default:
+			continue
+		}
+		tpl.warnf(doc.tokens[i], "Content outside of blocks is never rendered since the template extends another one.")
+		return
+	}
+}
+
+// usesIdentifier reports whether tokens refer to the variable name (not
+// counting attributes like "user.name").
+func usesIdentifier(tokens []*Token, name string) bool {
+	for i, t := range tokens {
+		if t.Typ != TokenIdentifier || t.Val != name {
+			continue
+		}
+		if i > 0 && tokens[i-1].Typ == TokenSymbol && tokens[i-1].Val == "." {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// includesTemplates reports whether tokens contain tags rendering other
+// templates (which might use any variable of the context).
+func includesTemplates(tokens []*Token) bool {
+	for i, t := range tokens {
+		if t.Typ != TokenSymbol || t.Val != "{%" || i+1 >= len(tokens) {
+			continue
+		}
+		switch tokens[i+1].Val {
+		case "include", "embed", "ssi":
+			return true
+		}
+	}
+	return false
+}